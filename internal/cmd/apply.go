@@ -8,8 +8,7 @@ import (
 	"path/filepath"
 	"strings"
 
-	"gopkg.in/yaml.v3"
-
+	"userclouds.com/cmd/ucconfig/internal/engine"
 	"userclouds.com/cmd/ucconfig/internal/liveresource"
 	"userclouds.com/cmd/ucconfig/internal/manifest"
 	"userclouds.com/cmd/ucconfig/internal/tfconfig"
@@ -35,18 +34,14 @@ func writeTerraformRC(ctx context.Context, rcPath string, tfProviderDevDirPath s
 	return ucerr.Wrap(os.WriteFile(rcPath, []byte(config), 0644))
 }
 
-func genTerraform(ctx context.Context, mfestPath string, mfest *manifest.Manifest, fqtn string, resources *[]liveresource.Resource, tfDir string, tfProviderVersionConstraint string) error {
-	if tfProviderVersionConstraint == "" {
-		// Require at least v0.1.8 for support for column search indexing
-		tfProviderVersionConstraint = ">= 0.1.8"
-	}
-	tfText, err := tfconfig.GenConfig(&tfconfig.GenerationContext{
-		ManifestFilePath:            mfestPath,
-		Manifest:                    mfest,
-		FQTN:                        fqtn,
-		LiveResources:               resources,
-		TFProviderVersionConstraint: tfProviderVersionConstraint,
-	})
+// defaultTFProviderVersionConstraint requires at least v0.1.8 for support for
+// column search indexing
+const defaultTFProviderVersionConstraint = ">= 0.1.8"
+
+// writeTerraformConfig generates the Terraform config for genCtx and writes it
+// to main.tf in tfDir
+func writeTerraformConfig(genCtx *tfconfig.GenerationContext, tfDir string) error {
+	tfText, err := tfconfig.GenConfig(genCtx)
 	if err != nil {
 		return ucerr.Friendlyf(err, "Failed to generate Terraform config")
 	}
@@ -55,12 +50,35 @@ func genTerraform(ctx context.Context, mfestPath string, mfest *manifest.Manifes
 	if err != nil {
 		return ucerr.Friendlyf(err, "Failed to write generated Terraform config")
 	}
+	return nil
+}
+
+func genTerraform(ctx context.Context, genCtx *tfconfig.GenerationContext, tfDir string, tfVersion terraformVersion) error {
+	useImportBlocks := tfVersion.AtLeast(minImportBlockVersion)
+	if !useImportBlocks {
+		uclog.Infof(ctx, "Terraform %s doesn't support import blocks, so generating Terraform state instead", tfVersion)
+	}
+	genCtx.ImportLiveResources = useImportBlocks
+	if err := writeTerraformConfig(genCtx, tfDir); err != nil {
+		return ucerr.Wrap(err)
+	}
 
-	// Generate Terraform state for existing resources
-	state, err := tfstate.CreateState(resources)
+	// Generate Terraform state for existing resources. With import blocks,
+	// only the resources that are going to be deleted need to be in the state.
+	var state tfstate.State
+	var err error
+	if useImportBlocks {
+		state, err = tfstate.CreateUnmatchedState(genCtx.LiveResources)
+		if err == nil && len(state.Resources) == 0 {
+			return nil
+		}
+	} else {
+		state, err = tfstate.CreateState(genCtx.LiveResources)
+	}
 	if err != nil {
 		return ucerr.Friendlyf(err, "Failed to generate Terraform state")
 	}
+	state.TerraformVersion = tfVersion.String()
 	stateBytes, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return ucerr.Friendlyf(err, "Failed to marshal Terraform state")
@@ -68,106 +86,465 @@ func genTerraform(ctx context.Context, mfestPath string, mfest *manifest.Manifes
 	return ucerr.Wrap(os.WriteFile(filepath.Join(tfDir, "terraform.tfstate"), stateBytes, 0644))
 }
 
+// syncTerraformState brings a persistent Terraform state (in a reused working
+// directory or a remote backend) up to date with the live resources, after
+// terraform init has run in tfDir. Rather than replacing the state, matched
+// live resources that aren't in it yet are imported with import blocks (or
+// moved, if the state has them under another name), and the live resources
+// that are going to be deleted are pushed to it if it doesn't have them yet.
+func syncTerraformState(ctx context.Context, genCtx *tfconfig.GenerationContext, tfDir string, env []string, tfVersion terraformVersion) error {
+	pullCmd := exec.Command("terraform", "state", "pull")
+	pullCmd.Dir = tfDir
+	pullCmd.Stderr = os.Stderr
+	pullCmd.Env = env
+	existingJSON, err := pullCmd.Output()
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to run terraform state pull. Generated terraform files are in %s", tfDir)
+	}
+	existing, err := tfstate.ExistingResourceNames(existingJSON)
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to read Terraform state")
+	}
+	uclog.Infof(ctx, "Terraform state has %d existing resources", len(existing))
+
+	genCtx.ImportLiveResources = true
+	genCtx.ManagedResourceNames = existing
+	if err := writeTerraformConfig(genCtx, tfDir); err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	state, err := tfstate.CreateMissingState(genCtx.LiveResources, existing)
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to generate Terraform state")
+	}
+	if len(state.Resources) == 0 {
+		return nil
+	}
+	state.TerraformVersion = tfVersion.String()
+	merged, err := state.MergeInto(existingJSON)
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to update Terraform state")
+	}
+	pushPath := filepath.Join(tfDir, "ucconfig-push.tfstate")
+	if err := os.WriteFile(pushPath, merged, 0644); err != nil {
+		return ucerr.Friendlyf(err, "Failed to write Terraform state")
+	}
+	defer os.Remove(pushPath)
+	uclog.Infof(ctx, "Adding %d live resources that will be deleted to the Terraform state...", len(state.Resources))
+	if err := runTerraform(tfDir, env, true, "state", "push", filepath.Base(pushPath)); err != nil {
+		return ucerr.Friendlyf(err, "Failed to run terraform state push. Generated terraform files are in %s", tfDir)
+	}
+	return nil
+}
+
+// workDirTenantFile records which tenant a persistent working directory is
+// used for, since its Terraform state only describes that tenant
+const workDirTenantFile = ".ucconfig-tenant"
+
+// terraformWorkDir returns the directory to generate Terraform files in:
+// workDir if set, or otherwise a new temporary directory
+func terraformWorkDir(workDir string, fqtn string) (string, error) {
+	if workDir == "" {
+		dname, err := os.MkdirTemp("", "ucconfig-terraform")
+		if err != nil {
+			return "", ucerr.Friendlyf(err, "Failed to create temporary directory")
+		}
+		return dname, nil
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return "", ucerr.Friendlyf(err, "Failed to create working directory %s", workDir)
+	}
+	tenantPath := filepath.Join(workDir, workDirTenantFile)
+	recorded, err := os.ReadFile(tenantPath)
+	if err == nil && strings.TrimSpace(string(recorded)) != fqtn {
+		return "", ucerr.Friendlyf(nil, "Working directory %s is used for tenant %s, not %s. Use a separate working directory for each tenant.", workDir, strings.TrimSpace(string(recorded)), fqtn)
+	} else if err != nil && !os.IsNotExist(err) {
+		return "", ucerr.Friendlyf(err, "Failed to read %s", tenantPath)
+	}
+	if err := os.WriteFile(tenantPath, []byte(fqtn+"\n"), 0644); err != nil {
+		return "", ucerr.Friendlyf(err, "Failed to write %s", tenantPath)
+	}
+	return workDir, nil
+}
+
+// ApplyOptions stores the settings for the apply subcommand
+type ApplyOptions struct {
+	DryRun       bool
+	AutoApprove  bool
+	TenantURL    string
+	ClientID     string
+	ClientSecret string
+	ManifestPath string
+	// TFProviderVersionConstraint specifies the version constraint that should be used for the terraform-provider-userclouds provider instantiation
+	TFProviderVersionConstraint string
+	// TFProviderDevDirPath is the path to a local build of the terraform-provider-userclouds provider
+	TFProviderDevDirPath string
+	// OutputFormat is OutputFormatText (the default) to stream Terraform output,
+	// or OutputFormatJSON to print a machine-readable Report to stdout
+	OutputFormat string
+	// Engine is EngineTerraform (the default) or EngineNative, which calls the
+	// UC API directly and doesn't require a terraform binary
+	Engine string
+	// WriteBack records the tenant's resource UUIDs in the manifest file after
+	// a successful apply
+	WriteBack bool
+	// MaxDeletes, if set, aborts the apply if more than this many live
+	// resources would be deleted or replaced
+	MaxDeletes *int
+	// BackupDir, if set, is where a snapshot of the tenant's live resources is
+	// saved before making changes, for use with Rollback
+	BackupDir string
+	// WorkDir, if set, is a directory that is reused for the Terraform files
+	// across runs (instead of a new temporary directory), so that the provider
+	// cache and local Terraform state are kept
+	WorkDir string
+	// BackendConfigPath, if set, is a file containing a Terraform backend
+	// block, for keeping the Terraform state in a remote backend
+	BackendConfigPath string
+}
+
+// checkMaxDeletes returns an error if the plan would delete (or delete and
+// recreate) more live resources than maxDeletes allows. deletes lists those
+// resources, e.g. the Deleted and Replaced resources in a Report.
+func checkMaxDeletes(ctx context.Context, deletes []ResourceReport, maxDeletes *int) error {
+	if maxDeletes == nil || len(deletes) <= *maxDeletes {
+		return nil
+	}
+	for _, d := range deletes {
+		uclog.Errorf(ctx, "Would delete %s resource %s", d.TerraformTypeSuffix, d.ResourceUUID)
+	}
+	return ucerr.Friendlyf(nil, "Applying this manifest would delete or replace %d resources, which is more than the --max-deletes limit of %d. Add the resources to the manifest (or to its scope's ignore list), or raise the limit if the deletes are intended.", len(deletes), *maxDeletes)
+}
+
+// checkPreventDestroy returns an error if the plan would delete (or delete and
+// recreate) a live resource whose manifest entry sets
+// lifecycle.prevent_destroy. Entries are matched by manifest ID, or by their
+// resource UUID in this tenant for resources that are deleted because the
+// entry no longer applies to it. Terraform enforces this itself, but checking
+// it here stops multi-tenant applies before any tenant is changed, and the
+// native engine relies on it.
+func checkPreventDestroy(ctx context.Context, mfest *manifest.Manifest, fqtn string, destroyed []ResourceReport) error {
+	protectedIDs := map[string]bool{}
+	protectedUUIDs := map[string]bool{}
+	for _, r := range mfest.Resources {
+		if r.Lifecycle == nil || !r.Lifecycle.PreventDestroy {
+			continue
+		}
+		protectedIDs[r.ManifestID] = true
+		if id := r.ResourceUUIDs[fqtn]; id != "" {
+			protectedUUIDs[id] = true
+		} else if id := r.ResourceUUIDs["__DEFAULT"]; id != "" {
+			protectedUUIDs[id] = true
+		}
+	}
+	blocked := 0
+	for _, d := range destroyed {
+		if (d.ManifestID != "" && protectedIDs[d.ManifestID]) || protectedUUIDs[d.ResourceUUID] {
+			uclog.Errorf(ctx, "Would delete %s resource %s (id %s), which has lifecycle.prevent_destroy set", d.TerraformTypeSuffix, d.ManifestID, d.ResourceUUID)
+			blocked++
+		}
+	}
+	if blocked > 0 {
+		return ucerr.Friendlyf(nil, "Applying this manifest would delete or replace %d resources with lifecycle.prevent_destroy set. Change the manifest so that they are kept, or remove prevent_destroy if the deletes are intended.", blocked)
+	}
+	return nil
+}
+
+// checkDestructiveChanges runs the deletion safeguards against a report of
+// planned changes, before anything is applied: resources that would be
+// replaced count as deletes for --max-deletes, and neither may touch a
+// manifest entry with lifecycle.prevent_destroy set. Every apply path uses
+// this, whichever engine computed the plan.
+func checkDestructiveChanges(ctx context.Context, mfest *manifest.Manifest, fqtn string, report *Report, maxDeletes *int) error {
+	destroyed := append(append([]ResourceReport{}, report.Deleted...), report.Replaced...)
+	if err := checkPreventDestroy(ctx, mfest, fqtn, destroyed); err != nil {
+		return ucerr.Wrap(err)
+	}
+	return ucerr.Wrap(checkMaxDeletes(ctx, destroyed, maxDeletes))
+}
+
+func runTerraform(dir string, env []string, jsonOutput bool, args ...string) error {
+	cmd := exec.Command("terraform", args...)
+	cmd.Dir = dir
+	cmd.Stdin = os.Stdin
+	if jsonOutput {
+		// Keep stdout clean for the JSON report
+		cmd.Stdout = os.Stderr
+	} else {
+		cmd.Stdout = os.Stdout
+	}
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+	return ucerr.Wrap(cmd.Run())
+}
+
+// preparedApply is a plan for applying a manifest to a tenant that has been
+// computed, printed, and checked against the deletion safeguards, but not yet
+// carried out. Running it applies exactly the changes in the plan.
+type preparedApply struct {
+	fqtn      string
+	opts      ApplyOptions
+	idpClient *idp.Client
+	mfest     *manifest.Manifest
+	resources []liveresource.Resource
+	report    *Report
+	// steps are the changes that the native engine will make
+	steps []engine.Step
+	// terraformDir contains the saved Terraform plan for the Terraform engine,
+	// which is applied with terraformEnv
+	terraformDir string
+	terraformEnv []string
+}
+
 // Apply implements a "ucconfig apply" subcommand that applies a manifest.
-func Apply(ctx context.Context, dryRun, autoApprove bool, idpClient *idp.Client, fqtn string, tenantURL string, clientID string, clientSecret string, manifestPath string, tfProviderVersionConstraint string, tfProviderDevDirPath string) error {
-	if dryRun && autoApprove {
+func Apply(ctx context.Context, idpClient *idp.Client, fqtn string, opts ApplyOptions) error {
+	if opts.DryRun && opts.AutoApprove {
 		return ucerr.Friendlyf(nil, "dry run and auto approve flags are mutually exclusive")
 	}
+	jsonOutput := opts.OutputFormat == OutputFormatJSON
+	if jsonOutput && !opts.DryRun && !opts.AutoApprove {
+		return ucerr.Friendlyf(nil, "JSON output requires either the dry run or the auto approve flag, since there is no interactive confirmation prompt")
+	}
+	if opts.DryRun && opts.WriteBack {
+		return ucerr.Friendlyf(nil, "dry run and write back flags are mutually exclusive")
+	}
 
-	uclog.Infof(ctx, "Reading manifest from %s...", manifestPath)
-	manifestText, err := os.ReadFile(manifestPath)
+	pa, err := planApply(ctx, idpClient, fqtn, opts)
 	if err != nil {
-		return ucerr.Friendlyf(err, "Failed to read manifest file")
+		return ucerr.Wrap(err)
 	}
-
-	mfest := manifest.Manifest{}
-	switch filepath.Ext(manifestPath) {
-	case ".json":
-		if err := json.Unmarshal(manifestText, &mfest); err != nil {
-			return ucerr.Friendlyf(err, "Failed to decode JSON")
+	if !opts.DryRun {
+		// A saved plan is applied without Terraform asking for confirmation,
+		// so ask here instead
+		if pa.report.hasChanges() && !opts.AutoApprove {
+			approved, err := confirm("Do you want to perform these actions?")
+			if err != nil {
+				return ucerr.Friendlyf(err, "Failed to read confirmation")
+			}
+			if !approved {
+				return ucerr.Friendlyf(nil, "Apply cancelled")
+			}
 		}
-	case ".yaml":
-		if err := yaml.Unmarshal(manifestText, &mfest); err != nil {
-			return ucerr.Friendlyf(err, "Failed to decode YAML")
+		if err := pa.run(ctx); err != nil {
+			return ucerr.Wrap(err)
 		}
-	default:
-		return ucerr.Friendlyf(nil, "Manifest path must have .json or .yaml extension")
+	}
+	if jsonOutput {
+		return ucerr.Wrap(pa.report.write())
+	}
+	return nil
+}
+
+// planApply reads and validates the manifest, matches it against the tenant's
+// live resources, and computes and prints the plan with the engine that
+// opts.Engine selects.
+func planApply(ctx context.Context, idpClient *idp.Client, fqtn string, opts ApplyOptions) (*preparedApply, error) {
+	report := newReport("apply", fqtn, opts.ManifestPath)
+	report.DryRun = opts.DryRun
+
+	mfest, err := readManifest(ctx, opts.ManifestPath)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
 	}
 	if err := mfest.Validate(fqtn); err != nil {
-		return ucerr.Friendlyf(err, "Failed to validate manifest")
+		return nil, ucerr.Friendlyf(err, "Failed to validate manifest for %s", fqtn)
+	}
+
+	resources, warnings, err := fetchAndMatchLiveResources(ctx, idpClient, &mfest, fqtn)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
 	}
+	report.Warnings = append(report.Warnings, warnings...)
 
-	uclog.Infof(ctx, "Fetching live resources...")
-	resources, err := liveresource.GetLiveResources(ctx, idpClient)
+	pa := &preparedApply{
+		fqtn:      fqtn,
+		opts:      opts,
+		idpClient: idpClient,
+		mfest:     &mfest,
+		resources: resources,
+		report:    report,
+	}
+	if opts.Engine == EngineNative {
+		pa.steps, err = planNative(ctx, &tfconfig.GenerationContext{
+			ManifestFilePath: opts.ManifestPath,
+			Manifest:         &mfest,
+			FQTN:             fqtn,
+			LiveResources:    &pa.resources,
+		}, opts, report)
+	} else {
+		pa.terraformDir, pa.terraformEnv, err = planTerraform(ctx, &mfest, fqtn, &pa.resources, opts, report)
+	}
 	if err != nil {
-		return ucerr.Friendlyf(err, "Failed to fetch live resources")
+		return nil, ucerr.Wrap(err)
 	}
-	err = mfest.MatchLiveResources(ctx, &resources, fqtn)
+	return pa, nil
+}
+
+// planTerraform generates the Terraform files for the tenant, runs terraform
+// init and plan, and saves the plan so that run can apply exactly that plan.
+// It returns the Terraform directory and the environment to run Terraform
+// with.
+func planTerraform(ctx context.Context, mfest *manifest.Manifest, fqtn string, resources *[]liveresource.Resource, opts ApplyOptions, report *Report) (string, []string, error) {
+	jsonOutput := opts.OutputFormat == OutputFormatJSON
+
+	uclog.Infof(ctx, "Checking Terraform version...")
+	tfVersion, err := detectTerraformVersion()
 	if err != nil {
-		return ucerr.Friendlyf(err, "Failed to match manifest entries to live resources")
+		return "", nil, ucerr.Friendlyf(err, "Failed to run terraform version. Make sure Terraform is installed, or use --engine=native, which doesn't need Terraform")
+	}
+	if err := checkTerraformVersion(tfVersion); err != nil {
+		return "", nil, ucerr.Wrap(err)
+	}
+
+	// With a persistent state, the state is updated rather than generated
+	// from scratch, which relies on import blocks
+	persistentState := opts.WorkDir != "" || opts.BackendConfigPath != ""
+	if persistentState && !tfVersion.AtLeast(minImportBlockVersion) {
+		return "", nil, ucerr.Friendlyf(nil, "--workdir and --backend-config require Terraform %s or later, but Terraform %s is installed", minImportBlockVersion, tfVersion)
+	}
+	var backend string
+	if opts.BackendConfigPath != "" {
+		backendBytes, err := os.ReadFile(opts.BackendConfigPath)
+		if err != nil {
+			return "", nil, ucerr.Friendlyf(err, "Failed to read backend config %s", opts.BackendConfigPath)
+		}
+		backend = string(backendBytes)
 	}
 
 	uclog.Infof(ctx, "Generating Terraform...")
-	dname, err := os.MkdirTemp("", "ucconfig-terraform")
+	dname, err := terraformWorkDir(opts.WorkDir, fqtn)
 	if err != nil {
-		return ucerr.Friendlyf(err, "Failed to create temporary directory")
+		return "", nil, ucerr.Wrap(err)
 	}
 	uclog.Infof(ctx, "Terraform files will be generated in %s", dname)
+	report.TerraformDir = dname
 
-	err = genTerraform(ctx, manifestPath, &mfest, fqtn, &resources, dname, tfProviderVersionConstraint)
+	tfProviderVersionConstraint := opts.TFProviderVersionConstraint
+	if tfProviderVersionConstraint == "" {
+		tfProviderVersionConstraint = defaultTFProviderVersionConstraint
+	}
+	genCtx := &tfconfig.GenerationContext{
+		ManifestFilePath:            opts.ManifestPath,
+		Manifest:                    mfest,
+		FQTN:                        fqtn,
+		LiveResources:               resources,
+		TFProviderVersionConstraint: tfProviderVersionConstraint,
+		Backend:                     backend,
+	}
+	if persistentState {
+		// Import blocks are added by syncTerraformState once the existing
+		// state can be read
+		err = writeTerraformConfig(genCtx, dname)
+	} else {
+		err = genTerraform(ctx, genCtx, dname, tfVersion)
+	}
 	if err != nil {
-		return ucerr.Friendlyf(err, "Error during Terraform generation")
+		return "", nil, ucerr.Friendlyf(err, "Error during Terraform generation")
 	}
 
 	env := os.Environ()
-	if tfProviderDevDirPath != "" {
+	if opts.TFProviderDevDirPath != "" {
 		terraformRCPath := dname + "/.terraformrc"
-		if err := writeTerraformRC(ctx, terraformRCPath, tfProviderDevDirPath); err != nil {
-			return ucerr.Friendlyf(err, "Failed to write Terraform RC file")
+		if err := writeTerraformRC(ctx, terraformRCPath, opts.TFProviderDevDirPath); err != nil {
+			return "", nil, ucerr.Friendlyf(err, "Failed to write Terraform RC file")
 		}
 		uclog.Infof(ctx, "Setting TF_CLI_CONFIG_FILE=%v to enable usage of local dev build of UC TF provider", terraformRCPath)
 		env = append(env, "TF_CLI_CONFIG_FILE="+terraformRCPath)
 	}
 
 	uclog.Infof(ctx, "Running terraform init...")
-	cmd := exec.Command("terraform", "init")
-	cmd.Dir = dname
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Env = env
-	if err := cmd.Run(); err != nil {
-		return ucerr.Friendlyf(err, "Failed to run terraform init. Generated terraform files are in %s", dname)
+	if err := runTerraform(dname, env, jsonOutput, "init"); err != nil {
+		return "", nil, ucerr.Friendlyf(err, "Failed to run terraform init. Generated terraform files are in %s", dname)
+	}
+	if persistentState {
+		if err := syncTerraformState(ctx, genCtx, dname, env, tfVersion); err != nil {
+			return "", nil, ucerr.Wrap(err)
+		}
 	}
 
-	cmdArgs := make([]string, 0, 3)
-	if dryRun {
-		cmdArgs = append(cmdArgs, "plan")
+	uclog.Infof(ctx, "Checking manifest attributes against the provider schema...")
+	if err := checkProviderSchema(ctx, dname, env, mfest, fqtn); err != nil {
+		return "", nil, ucerr.Wrap(err)
+	}
+
+	env = append(env, "USERCLOUDS_TENANT_URL="+opts.TenantURL)
+	env = append(env, "USERCLOUDS_CLIENT_ID="+opts.ClientID)
+	env = append(env, "USERCLOUDS_CLIENT_SECRET="+opts.ClientSecret)
+
+	// Save the plan so that we can check and report exactly what Terraform is
+	// going to do, and then apply that same plan
+	uclog.Infof(ctx, "Running terraform plan...")
+	if err := runTerraform(dname, env, jsonOutput, "plan", "-input=false", "-out=ucconfig.tfplan"); err != nil {
+		return "", nil, ucerr.Friendlyf(err, "Failed to run terraform plan. Generated terraform files are in %s", dname)
+	}
+	showCmd := exec.Command("terraform", "show", "-json", "ucconfig.tfplan")
+	showCmd.Dir = dname
+	showCmd.Stderr = os.Stderr
+	showCmd.Env = env
+	planJSON, err := showCmd.Output()
+	if err != nil {
+		return "", nil, ucerr.Friendlyf(err, "Failed to run terraform show. Generated terraform files are in %s", dname)
+	}
+	if err := report.addTerraformPlan(planJSON); err != nil {
+		return "", nil, ucerr.Wrap(err)
+	}
+	if err := checkDestructiveChanges(ctx, mfest, fqtn, report, opts.MaxDeletes); err != nil {
+		return "", nil, ucerr.Wrap(err)
+	}
+	return dname, env, nil
+}
+
+// run carries out the plan: it saves a snapshot first if there are changes
+// and opts.BackupDir is set, and records the tenant's resource UUIDs in the
+// manifest afterwards if opts.WriteBack is set. Confirmation is up to the
+// caller.
+func (pa *preparedApply) run(ctx context.Context) error {
+	jsonOutput := pa.opts.OutputFormat == OutputFormatJSON
+	if pa.opts.BackupDir != "" && pa.report.hasChanges() {
+		if _, err := writeSnapshot(ctx, pa.opts.BackupDir, pa.fqtn, pa.opts.ManifestPath, pa.mfest, pa.resources); err != nil {
+			return ucerr.Wrap(err)
+		}
+	}
+	if pa.opts.Engine == EngineNative {
+		completed, err := engine.Run(ctx, pa.idpClient, pa.steps)
+		if err != nil {
+			return ucerr.Friendlyf(err, "Apply failed after %d of %d changes", completed, len(pa.steps))
+		}
+		uclog.Infof(ctx, "Apply complete! %d changes made.", completed)
 	} else {
-		cmdArgs = append(cmdArgs, "apply")
-		if autoApprove {
-			cmdArgs = append(cmdArgs, "-auto-approve")
+		uclog.Infof(ctx, "Running terraform apply...")
+		if err := runTerraform(pa.terraformDir, pa.terraformEnv, jsonOutput, "apply", "-input=false", "ucconfig.tfplan"); err != nil {
+			return ucerr.Friendlyf(err, "Failed to run terraform apply. Generated terraform files are in %s", pa.terraformDir)
 		}
 	}
-	uclog.Infof(ctx, "Running terraform %s...", strings.Join(cmdArgs, " "))
-	cmd = exec.Command("terraform", cmdArgs...)
-	cmd.Dir = dname
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Env = env
-	cmd.Env = append(cmd.Env, "USERCLOUDS_TENANT_URL="+tenantURL)
-	cmd.Env = append(cmd.Env, "USERCLOUDS_CLIENT_ID="+clientID)
-	cmd.Env = append(cmd.Env, "USERCLOUDS_CLIENT_SECRET="+clientSecret)
-	if err := cmd.Run(); err != nil {
-		return ucerr.Friendlyf(err, "Failed to run terraform apply. Generated terraform files are in %s", dname)
+	if pa.opts.WriteBack {
+		return ucerr.Wrap(writeBackResourceUUIDs(ctx, pa.opts.ManifestPath, pa.mfest, pa.fqtn))
 	}
+	return nil
+}
 
-	// TODO: it could be a nice feature to prompt the user to ask whether to
-	// write the manifest with updated matched resource<->manifest ID mappings.
-	// However, if they have added comments to the manifest or made any
-	// formatting customizations, those would get overwritten, so I have been
-	// waiting to see whether anyone asks for this.
-
+// checkProviderSchema fetches the provider schema with `terraform providers
+// schema -json` (which requires terraform init to have run in dir), and returns
+// an error listing any manifest attributes that the provider doesn't support.
+func checkProviderSchema(ctx context.Context, dir string, env []string, mfest *manifest.Manifest, fqtn string) error {
+	schemaCmd := exec.Command("terraform", "providers", "schema", "-json")
+	schemaCmd.Dir = dir
+	schemaCmd.Stderr = os.Stderr
+	schemaCmd.Env = env
+	schemaJSON, err := schemaCmd.Output()
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to run terraform providers schema. Generated terraform files are in %s", dir)
+	}
+	schema, err := tfconfig.ParseProviderSchema(schemaJSON)
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to read provider schema")
+	}
+	errs := tfconfig.ValidateAgainstSchema(mfest, fqtn, schema)
+	for _, err := range errs {
+		uclog.Errorf(ctx, "%v", err)
+	}
+	if len(errs) > 0 {
+		return ucerr.Friendlyf(nil, "Found %d manifest attribute(s) that the installed terraform-provider-userclouds doesn't support. Check for typos, or use a newer provider version.", len(errs))
+	}
 	return nil
 }
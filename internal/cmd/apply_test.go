@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"context"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/infra/assert"
+	"userclouds.com/test/testlogtransport"
+)
+
+func TestCheckMaxDeletes(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	ctx := context.Background()
+	report := newReport("apply", "mycompany-prod", "manifest.yaml")
+	assert.NoErr(t, report.addTerraformPlan([]byte(`{
+  "resource_changes": [
+    {"type": "userclouds_userstore_column", "name": "unmatched-fe20fd48-a006-4ad8-9208-4aad540d8794", "change": {"actions": ["delete"], "before": {"id": "fe20fd48-a006-4ad8-9208-4aad540d8794"}, "after": null}},
+    {"type": "userclouds_userstore_column", "name": "manifestid-phone", "change": {"actions": ["delete", "create"], "before": {"id": "c860a6d7-c632-4f81-8f5f-597290a9f437"}, "after": {"id": "c860a6d7-c632-4f81-8f5f-597290a9f437"}}},
+    {"type": "userclouds_userstore_accessor", "name": "manifestid-acc", "change": {"actions": ["update"], "before": {"id": "633fac47-c6c1-4459-93e0-0bb4043e60a0"}, "after": {"id": "633fac47-c6c1-4459-93e0-0bb4043e60a0"}}}
+  ]
+}`)))
+	deletes := append(append([]ResourceReport{}, report.Deleted...), report.Replaced...)
+	assert.Equal(t, len(deletes), 2)
+
+	zero, two := 0, 2
+	assert.NoErr(t, checkMaxDeletes(ctx, deletes, nil))
+	assert.NoErr(t, checkMaxDeletes(ctx, deletes, &two))
+	assert.NotNil(t, checkMaxDeletes(ctx, deletes, &zero))
+	assert.NoErr(t, checkMaxDeletes(ctx, nil, &zero))
+}
+
+func TestCheckPreventDestroy(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	ctx := context.Background()
+	mfest := manifest.Manifest{Resources: []manifest.Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "phone",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+			Lifecycle:           &manifest.Lifecycle{PreventDestroy: true},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		},
+	}}
+
+	// Replacing the protected column, by manifest ID
+	assert.NotNil(t, checkPreventDestroy(ctx, &mfest, "mycompany-prod", []ResourceReport{
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "phone", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+	}))
+	// Deleting the protected column, which no longer matches its entry
+	assert.NotNil(t, checkPreventDestroy(ctx, &mfest, "mycompany-prod", []ResourceReport{
+		{TerraformTypeSuffix: "userstore_column", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+	}))
+	assert.NoErr(t, checkPreventDestroy(ctx, &mfest, "mycompany-prod", []ResourceReport{
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "email", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+	}))
+}
+
+func TestCheckDestructiveChangesCountsReplacements(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	ctx := context.Background()
+	report := newReport("apply", "mycompany-prod", "manifest.yaml")
+	addPlanToReport(report, &plan.Plan{FQTN: "mycompany-prod", Changes: []plan.ResourceChange{
+		{Action: plan.ActionReplace, TerraformTypeSuffix: "userstore_column", ManifestID: "phone", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+		{Action: plan.ActionDelete, TerraformTypeSuffix: "userstore_column", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+	}})
+	mfest := manifest.Manifest{}
+
+	one, two := 1, 2
+	assert.NoErr(t, checkDestructiveChanges(ctx, &mfest, "mycompany-prod", report, &two))
+	assert.NotNil(t, checkDestructiveChanges(ctx, &mfest, "mycompany-prod", report, &one))
+
+	mfest.Resources = []manifest.Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "phone",
+		ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+		Lifecycle:           &manifest.Lifecycle{PreventDestroy: true},
+	}}
+	assert.NotNil(t, checkDestructiveChanges(ctx, &mfest, "mycompany-prod", report, nil))
+}
@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"context"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// readManifest reads and decodes a JSON or YAML manifest file, along with any
+// files it includes.
+func readManifest(ctx context.Context, manifestPath string) (manifest.Manifest, error) {
+	uclog.Infof(ctx, "Reading manifest from %s...", manifestPath)
+	mfest, err := manifest.Load(manifestPath)
+	if err != nil {
+		return manifest.Manifest{}, ucerr.Friendlyf(err, "Failed to read manifest")
+	}
+	return mfest, nil
+}
+
+// fetchAndMatchLiveResources fetches the live resources from the tenant, drops
+// those outside of the manifest's scope, and matches the rest against the
+// entries in the manifest, returning the matched resources and any warnings
+// from matching.
+func fetchAndMatchLiveResources(ctx context.Context, idpClient *idp.Client, mfest *manifest.Manifest, fqtn string) ([]liveresource.Resource, []manifest.MatchWarning, error) {
+	uclog.Infof(ctx, "Fetching live resources...")
+	resources, err := liveresource.GetLiveResources(ctx, idpClient)
+	if err != nil {
+		return nil, nil, ucerr.Friendlyf(err, "Failed to fetch live resources")
+	}
+	resources, numOutOfScope := mfest.FilterToScope(resources)
+	if numOutOfScope > 0 {
+		uclog.Infof(ctx, "Ignoring %d live resources outside of the manifest's scope", numOutOfScope)
+	}
+	warnings, err := mfest.MatchLiveResources(ctx, &resources, fqtn)
+	if err != nil {
+		return nil, nil, ucerr.Friendlyf(err, "Failed to match manifest entries to live resources")
+	}
+	return resources, warnings, nil
+}
@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// ErrDriftDetected is returned by Drift when the live tenant differs from the
+// manifest, so that the caller can exit with a distinct status code.
+var ErrDriftDetected = errors.New("live tenant has drifted from the manifest")
+
+// DriftReport lists the resources in a live tenant that differ from a
+// manifest
+type DriftReport struct {
+	FQTN         string `json:"fqtn"`
+	ManifestPath string `json:"manifest_path"`
+	// Changed lists resources that exist in both the manifest and the live
+	// tenant, but whose attributes differ, or that were matched by name and
+	// have a different UUID than the manifest gives them (listed as a change
+	// to a resource_uuid attribute). Before is the live value and After is
+	// the manifest value.
+	Changed []plan.ResourceChange `json:"changed"`
+	// LiveOnly lists live resources that aren't in the manifest
+	LiveOnly []plan.ResourceChange `json:"live_only"`
+	// ManifestOnly lists manifest entries that don't exist in the live tenant
+	ManifestOnly []plan.ResourceChange `json:"manifest_only"`
+}
+
+// driftUUIDAttribute is the attribute under which a resource's UUID is listed
+// in a DriftReport, for resources matched by name whose UUID differs from the
+// manifest
+const driftUUIDAttribute = "resource_uuid"
+
+func newDriftReport(p *plan.Plan, manifestPath string, mfest *manifest.Manifest, warnings []manifest.MatchWarning) *DriftReport {
+	r := &DriftReport{
+		FQTN:         p.FQTN,
+		ManifestPath: manifestPath,
+		Changed:      []plan.ResourceChange{},
+		LiveOnly:     []plan.ResourceChange{},
+		ManifestOnly: []plan.ResourceChange{},
+	}
+	for _, c := range p.Changes {
+		switch c.Action {
+		case plan.ActionUpdate, plan.ActionReplace:
+			r.Changed = append(r.Changed, c)
+		case plan.ActionDelete:
+			r.LiveOnly = append(r.LiveOnly, c)
+		case plan.ActionCreate:
+			r.ManifestOnly = append(r.ManifestOnly, c)
+		}
+	}
+
+	// Resources matched by name were matched with a different UUID than the
+	// manifest gives them (its __DEFAULT UUID, since entries with a UUID for
+	// the tenant aren't matched by name)
+	for _, w := range warnings {
+		if w.Kind != manifest.MatchWarningMatchedByName {
+			continue
+		}
+		var manifestUUID any
+		for _, entry := range mfest.Resources {
+			if entry.ManifestID == w.ManifestID {
+				if id := entry.ResourceUUIDs["__DEFAULT"]; id != "" {
+					manifestUUID = id
+				}
+				break
+			}
+		}
+		change := plan.AttributeChange{Attribute: driftUUIDAttribute, Before: w.ResourceUUID, After: manifestUUID}
+		found := false
+		for i := range r.Changed {
+			if r.Changed[i].ManifestID == w.ManifestID {
+				r.Changed[i].Attributes = append([]plan.AttributeChange{change}, r.Changed[i].Attributes...)
+				found = true
+				break
+			}
+		}
+		if !found {
+			r.Changed = append(r.Changed, plan.ResourceChange{
+				Action:              plan.ActionUpdate,
+				TerraformTypeSuffix: w.TerraformTypeSuffix,
+				ManifestID:          w.ManifestID,
+				ResourceUUID:        w.ResourceUUID,
+				Attributes:          []plan.AttributeChange{change},
+			})
+		}
+	}
+	return r
+}
+
+// HasDrift returns true if the live tenant differs from the manifest
+func (r *DriftReport) HasDrift() bool {
+	return len(r.Changed)+len(r.LiveOnly)+len(r.ManifestOnly) > 0
+}
+
+func writeDriftSection(w io.Writer, heading string, changes []plan.ResourceChange) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "%s:\n", heading); err != nil {
+		return ucerr.Wrap(err)
+	}
+	for _, c := range changes {
+		label := c.ManifestID
+		if label == "" {
+			label = c.Name
+		}
+		if _, err := fmt.Fprintf(w, "  %s %s (id %s)\n", c.TerraformTypeSuffix, label, c.ResourceUUID); err != nil {
+			return ucerr.Wrap(err)
+		}
+		if c.Action != plan.ActionUpdate && c.Action != plan.ActionReplace {
+			continue
+		}
+		for _, a := range c.Attributes {
+			if _, err := fmt.Fprintf(w, "      %s: live %s, manifest %s\n", a.Attribute, plan.FormatValue(a.Before), plan.FormatValue(a.After)); err != nil {
+				return ucerr.Wrap(err)
+			}
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return ucerr.Wrap(err)
+}
+
+// WriteText writes a human-readable rendering of the report to w.
+func (r *DriftReport) WriteText(w io.Writer) error {
+	if err := writeDriftSection(w, "Changed in the live tenant", r.Changed); err != nil {
+		return ucerr.Wrap(err)
+	}
+	if err := writeDriftSection(w, "Only in the live tenant", r.LiveOnly); err != nil {
+		return ucerr.Wrap(err)
+	}
+	if err := writeDriftSection(w, "Only in the manifest", r.ManifestOnly); err != nil {
+		return ucerr.Wrap(err)
+	}
+	if !r.HasDrift() {
+		_, err := fmt.Fprintf(w, "No drift for %s.\n", r.FQTN)
+		return ucerr.Wrap(err)
+	}
+	_, err := fmt.Fprintf(w, "Drift for %s: %d changed, %d only live, %d only in manifest.\n", r.FQTN, len(r.Changed), len(r.LiveOnly), len(r.ManifestOnly))
+	return ucerr.Wrap(err)
+}
+
+// Drift implements a "ucconfig drift" subcommand that reports the resources in
+// a live tenant that differ from a manifest. It returns ErrDriftDetected if
+// there are any.
+func Drift(ctx context.Context, idpClient *idp.Client, fqtn string, manifestPath string, outputFormat string) error {
+	mfest, err := readManifest(ctx, manifestPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	if err := mfest.Validate(fqtn); err != nil {
+		return ucerr.Friendlyf(err, "Failed to validate manifest")
+	}
+
+	resources, warnings, err := fetchAndMatchLiveResources(ctx, idpClient, &mfest, fqtn)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	uclog.Infof(ctx, "Comparing live resources to the manifest...")
+	p, err := plan.Compute(&tfconfig.GenerationContext{
+		ManifestFilePath: manifestPath,
+		Manifest:         &mfest,
+		FQTN:             fqtn,
+		LiveResources:    &resources,
+	})
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to compare live resources to the manifest")
+	}
+	report := newDriftReport(p, manifestPath, &mfest, warnings)
+
+	switch outputFormat {
+	case OutputFormatJSON:
+		serialized, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to serialize drift report")
+		}
+		if _, err := os.Stdout.Write(append(serialized, '\n')); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write drift report")
+		}
+	case OutputFormatText, "":
+		if err := report.WriteText(os.Stdout); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write drift report")
+		}
+	default:
+		return ucerr.Friendlyf(nil, "Unknown output format %s", outputFormat)
+	}
+
+	if report.HasDrift() {
+		return ucerr.Wrap(ErrDriftDetected)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/infra/assert"
+)
+
+func TestDriftReport(t *testing.T) {
+	p := &plan.Plan{
+		FQTN: "mycompany-prod",
+		Changes: []plan.ResourceChange{
+			{
+				Action:              plan.ActionUpdate,
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email_col",
+				ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+				Attributes:          []plan.AttributeChange{{Attribute: "index_type", Before: "indexed", After: "none"}},
+			},
+			{
+				Action:              plan.ActionCreate,
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "accessor",
+				ResourceUUID:        "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+			},
+			{
+				Action:              plan.ActionDelete,
+				TerraformTypeSuffix: "userstore_column",
+				ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+				Name:                "phone",
+			},
+		},
+	}
+	r := newDriftReport(p, "manifest.yaml", &manifest.Manifest{}, nil)
+	assert.True(t, r.HasDrift())
+	assert.Equal(t, len(r.Changed), 1)
+	assert.Equal(t, len(r.LiveOnly), 1)
+	assert.Equal(t, len(r.ManifestOnly), 1)
+
+	var b strings.Builder
+	assert.NoErr(t, r.WriteText(&b))
+	assert.Equal(t, b.String(), `Changed in the live tenant:
+  userstore_column email_col (id fe20fd48-a006-4ad8-9208-4aad540d8794)
+      index_type: live "indexed", manifest "none"
+
+Only in the live tenant:
+  userstore_column phone (id dc42da22-4c49-459d-9572-3b5db6d61959)
+
+Only in the manifest:
+  userstore_accessor accessor (id 633fac47-c6c1-4459-93e0-0bb4043e60a0)
+
+Drift for mycompany-prod: 1 changed, 1 only live, 1 only in manifest.
+`)
+
+	r = newDriftReport(&plan.Plan{FQTN: "mycompany-prod"}, "manifest.yaml", &manifest.Manifest{}, nil)
+	assert.False(t, r.HasDrift())
+}
+
+func TestDriftReportMatchedByName(t *testing.T) {
+	p := &plan.Plan{
+		FQTN: "mycompany-prod",
+		Changes: []plan.ResourceChange{{
+			Action:              plan.ActionUpdate,
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email_col",
+			ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+			Attributes:          []plan.AttributeChange{{Attribute: "index_type", Before: "indexed", After: "none"}},
+		}},
+	}
+	mfest := &manifest.Manifest{Resources: []manifest.Resource{
+		{ManifestID: "email_col", ResourceUUIDs: map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"}},
+		{ManifestID: "phone_col", ResourceUUIDs: map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"}},
+	}}
+	warnings := []manifest.MatchWarning{
+		{Kind: manifest.MatchWarningMatchedByName, TerraformTypeSuffix: "userstore_column", ResourceUUID: "dc42da22-4c49-459d-9572-3b5db6d61959", ManifestID: "email_col"},
+		{Kind: manifest.MatchWarningMatchedByName, TerraformTypeSuffix: "userstore_column", ResourceUUID: "633fac47-c6c1-4459-93e0-0bb4043e60a0", ManifestID: "phone_col"},
+	}
+	r := newDriftReport(p, "manifest.yaml", mfest, warnings)
+	assert.True(t, r.HasDrift())
+	assert.Equal(t, len(r.Changed), 2)
+
+	var b strings.Builder
+	assert.NoErr(t, r.WriteText(&b))
+	assert.Equal(t, b.String(), `Changed in the live tenant:
+  userstore_column email_col (id dc42da22-4c49-459d-9572-3b5db6d61959)
+      resource_uuid: live "dc42da22-4c49-459d-9572-3b5db6d61959", manifest "fe20fd48-a006-4ad8-9208-4aad540d8794"
+      index_type: live "indexed", manifest "none"
+  userstore_column phone_col (id 633fac47-c6c1-4459-93e0-0bb4043e60a0)
+      resource_uuid: live "633fac47-c6c1-4459-93e0-0bb4043e60a0", manifest "c860a6d7-c632-4f81-8f5f-597290a9f437"
+
+Drift for mycompany-prod: 2 changed, 0 only live, 0 only in manifest.
+`)
+}
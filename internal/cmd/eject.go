@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// writeEjectedModule writes the generated files of an ejected module to
+// outDir, and copies the files it references into it
+func writeEjectedModule(module *tfconfig.EjectedModule, outDir string) error {
+	var paths []string
+	for path := range module.Files {
+		paths = append(paths, path)
+	}
+	for path := range module.CopiedFiles {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		contents, ok := module.Files[path]
+		if !ok {
+			copied, err := os.ReadFile(module.CopiedFiles[path])
+			if err != nil {
+				return ucerr.Friendlyf(err, "Failed to read %s", module.CopiedFiles[path])
+			}
+			contents = string(copied)
+		}
+		outPath := filepath.Join(outDir, path)
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+			return ucerr.Friendlyf(err, "Failed to create directory for %s", outPath)
+		}
+		if err := os.WriteFile(outPath, []byte(contents), 0644); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write %s", outPath)
+		}
+	}
+	return nil
+}
+
+// Eject implements the "ucconfig eject" subcommand, which writes a standalone
+// Terraform module for the manifest's resources in a tenant to outDir, so that
+// they can be maintained with Terraform directly instead of with ucconfig.
+// outDir must not exist yet, or be empty.
+func Eject(ctx context.Context, idpClient *idp.Client, fqtn string, tenantURL string, manifestPath string, outDir string, tfProviderVersionConstraint string) error {
+	if entries, err := os.ReadDir(outDir); err == nil && len(entries) > 0 {
+		return ucerr.Friendlyf(nil, "Output directory %s is not empty", outDir)
+	} else if err != nil && !os.IsNotExist(err) {
+		return ucerr.Friendlyf(err, "Failed to read output directory %s", outDir)
+	}
+
+	mfest, err := readManifest(ctx, manifestPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	if err := mfest.Validate(fqtn); err != nil {
+		return ucerr.Friendlyf(err, "Failed to validate manifest")
+	}
+	resources, _, err := fetchAndMatchLiveResources(ctx, idpClient, &mfest, fqtn)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	if tfProviderVersionConstraint == "" {
+		tfProviderVersionConstraint = defaultTFProviderVersionConstraint
+	}
+	module, err := tfconfig.GenEjectedModule(&tfconfig.GenerationContext{
+		ManifestFilePath:            manifestPath,
+		Manifest:                    &mfest,
+		FQTN:                        fqtn,
+		LiveResources:               &resources,
+		TFProviderVersionConstraint: tfProviderVersionConstraint,
+	}, tenantURL)
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to generate Terraform module")
+	}
+	if err := writeEjectedModule(module, outDir); err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	numUnmanaged := 0
+	for _, r := range resources {
+		if !r.IsSystem && r.ManifestID == "" {
+			numUnmanaged++
+		}
+	}
+	if numUnmanaged > 0 {
+		uclog.Warningf(ctx, "%d live resources are not in the manifest, so they won't be managed by the Terraform module. Applying the manifest with ucconfig would have deleted them.", numUnmanaged)
+	}
+	uclog.Infof(ctx, "Wrote Terraform module to %s. Set TF_VAR_client_id and TF_VAR_client_secret, then run terraform init and terraform plan in that directory.", outDir)
+	return nil
+}
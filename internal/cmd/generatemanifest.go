@@ -5,59 +5,300 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 
 	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
 	"userclouds.com/idp"
 	"userclouds.com/infra/ucerr"
 	"userclouds.com/infra/uclog"
 )
 
-// GenerateNewManifest implements a "ucconfig gen-manifest" subcommand that generates a new manifest.
-func GenerateNewManifest(ctx context.Context, idpClient *idp.Client, fqtn string, manifestPath string) error {
-	uclog.Infof(ctx, "Generating new manifest from live resource state...")
+// Ways that gen-manifest can split the generated manifest across files
+const (
+	SplitByNone = "none"
+	SplitByType = "type"
+)
+
+// typeFileName returns the name of the file that resources of the given type
+// are written to when splitting by type, e.g. "columns.yaml" for
+// userstore_column resources
+func typeFileName(terraformTypeSuffix string, ext string) string {
+	name := strings.TrimPrefix(terraformTypeSuffix, "userstore_")
+	if strings.HasSuffix(name, "y") {
+		name = strings.TrimSuffix(name, "y") + "ies"
+	} else {
+		name += "s"
+	}
+	return name + ext
+}
+
+func serializeManifest(mfest *manifest.Manifest, ext string) ([]byte, error) {
+	switch ext {
+	case ".json":
+		return json.MarshalIndent(mfest, "", "  ")
+	case ".yaml":
+		return yaml.Marshal(mfest)
+	}
+	return nil, ucerr.Friendlyf(nil, "manifest path must have .json or .yaml extension")
+}
+
+func writeManifest(mfest *manifest.Manifest, path string) error {
+	serialized, err := serializeManifest(mfest, filepath.Ext(path))
+	if err != nil {
+		return ucerr.Friendlyf(err, "failed to serialize manifest")
+	}
+	if err := os.WriteFile(path, serialized, 0644); err != nil {
+		return ucerr.Friendlyf(err, "failed to write manifest")
+	}
+	return nil
+}
+
+// splitByType splits a manifest into one manifest per resource type, keyed by
+// file name, and returns a root manifest that includes them all. The included
+// files are listed in the order that their types first appear in mfest.
+func splitByType(mfest *manifest.Manifest, ext string) (*manifest.Manifest, map[string]*manifest.Manifest) {
+	root := &manifest.Manifest{Resources: []manifest.Resource{}}
+	files := map[string]*manifest.Manifest{}
+	for _, r := range mfest.Resources {
+		fileName := typeFileName(r.TerraformTypeSuffix, ext)
+		if _, ok := files[fileName]; !ok {
+			root.Includes = append(root.Includes, fileName)
+			files[fileName] = &manifest.Manifest{}
+		}
+		files[fileName].Resources = append(files[fileName].Resources, r)
+	}
+	return root, files
+}
 
+// prepareExternValuesDir creates a "<manifest name>_values" directory next to
+// the manifest for storing attribute values externally. If clearExisting is
+// true, any previous contents are removed.
+func prepareExternValuesDir(manifestPath string, clearExisting bool) (*manifest.ExternValuesDirConfig, error) {
 	manifestBasename := filepath.Base(manifestPath)
 	externValuesDirName := manifestBasename[:len(manifestBasename)-len(filepath.Ext(manifestBasename))] + "_values"
 	externValuesDirPath, err := filepath.Abs(filepath.Dir(manifestPath) + "/" + externValuesDirName)
 	if err != nil {
-		return ucerr.Friendlyf(err, "failed to get absolute path for storing attribute values externally")
+		return nil, ucerr.Friendlyf(err, "failed to get absolute path for storing attribute values externally")
 	}
 
 	// Clear out the target directory if it already exists
-	if err := os.RemoveAll(externValuesDirPath); err != nil {
-		return ucerr.Friendlyf(err, "failed to clear directory %s for storing attribute values externally", externValuesDirPath)
+	if clearExisting {
+		if err := os.RemoveAll(externValuesDirPath); err != nil {
+			return nil, ucerr.Friendlyf(err, "failed to clear directory %s for storing attribute values externally", externValuesDirPath)
+		}
 	}
 	if err := os.MkdirAll(externValuesDirPath, 0755); err != nil {
-		return ucerr.Friendlyf(err, "failed to create directory %s for storing attribute values externally", externValuesDirPath)
+		return nil, ucerr.Friendlyf(err, "failed to create directory %s for storing attribute values externally", externValuesDirPath)
 	}
-
-	mfest, err := manifest.GenerateNewManifest(ctx, idpClient, fqtn, &manifest.ExternValuesDirConfig{
+	return &manifest.ExternValuesDirConfig{
 		AbsolutePath:             externValuesDirPath,
 		RelativePathFromManifest: "./" + externValuesDirName,
-	})
+	}, nil
+}
+
+// GenerateNewManifest implements a "ucconfig gen-manifest" subcommand that generates a new manifest.
+// If splitBy is SplitByType, the manifest at manifestPath only includes other manifest files, one
+// per resource type, which are written next to it. If outputFormat is OutputFormatJSON, a Report
+// listing the generated resources is printed to stdout.
+func GenerateNewManifest(ctx context.Context, idpClient *idp.Client, fqtn string, manifestPath string, splitBy string, outputFormat string) error {
+	uclog.Infof(ctx, "Generating new manifest from live resource state...")
+
+	externValuesDir, err := prepareExternValuesDir(manifestPath, true)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	mfest, err := manifest.GenerateNewManifest(ctx, idpClient, fqtn, externValuesDir)
 	if err != nil {
 		return ucerr.Friendlyf(err, "failed to generate manifest")
 	}
 
-	var serialized []byte
-	switch filepath.Ext(manifestPath) {
-	case ".json":
-		serialized, err = json.MarshalIndent(mfest, "", "  ")
-	case ".yaml":
-		serialized, err = yaml.Marshal(mfest)
-	default:
-		return ucerr.Friendlyf(nil, "manifest path must have .json or .yaml extension")
+	if splitBy == SplitByType {
+		root, files := splitByType(&mfest, filepath.Ext(manifestPath))
+		for _, fileName := range root.Includes {
+			if filepath.Base(manifestPath) == fileName {
+				return ucerr.Friendlyf(nil, "manifest path %s has the same name as the file for %s resources; choose a different name when splitting by type", manifestPath, files[fileName].Resources[0].TerraformTypeSuffix)
+			}
+		}
+		for _, fileName := range root.Includes {
+			path := filepath.Join(filepath.Dir(manifestPath), fileName)
+			if err := writeManifest(files[fileName], path); err != nil {
+				return ucerr.Wrap(err)
+			}
+			uclog.Infof(ctx, "Wrote %d resources into manifest: %s", len(files[fileName].Resources), path)
+		}
+		if err := writeManifest(root, manifestPath); err != nil {
+			return ucerr.Wrap(err)
+		}
+		uclog.Infof(ctx, "Wrote root manifest including %d files: %s", len(root.Includes), manifestPath)
+	} else {
+		if err := writeManifest(&mfest, manifestPath); err != nil {
+			return ucerr.Wrap(err)
+		}
+		uclog.Infof(ctx, "Wrote %d resources into manifest: %s", len(mfest.Resources), manifestPath)
 	}
+
+	if outputFormat == OutputFormatJSON {
+		report := newReport("gen-manifest", fqtn, manifestPath)
+		report.ValuesDir = externValuesDir.AbsolutePath
+		for _, r := range mfest.Resources {
+			report.Created = append(report.Created, ResourceReport{
+				TerraformTypeSuffix: r.TerraformTypeSuffix,
+				ManifestID:          r.ManifestID,
+				ResourceUUID:        r.ResourceUUIDs[fqtn],
+			})
+		}
+		return ucerr.Wrap(report.write())
+	}
+	return nil
+}
+
+// syncManifestFiles writes the changes made to mfest by a merge back to the
+// files it was loaded from, editing the entries in place so that comments and
+// formatting are kept. New resources (without a SourceFile) are added to the
+// file at manifestPath, and files without any changes aren't rewritten.
+func syncManifestFiles(ctx context.Context, manifestPath string, mfest *manifest.Manifest, fqtn string) error {
+	var files []string
+	resourcesByFile := map[string][]manifest.Resource{}
+	for _, r := range mfest.Resources {
+		file := r.SourceFile
+		if file == "" {
+			file = manifestPath
+		}
+		if _, ok := resourcesByFile[file]; !ok {
+			files = append(files, file)
+		}
+		resourcesByFile[file] = append(resourcesByFile[file], r)
+	}
+
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to read manifest file %s", file)
+		}
+		updated, changed, err := manifest.SyncResources(text, filepath.Ext(file), fqtn, resourcesByFile[file])
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to update manifest file %s", file)
+		}
+		if changed == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to stat manifest file %s", file)
+		}
+		if err := os.WriteFile(file, updated, info.Mode().Perm()); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write manifest file %s", file)
+		}
+		uclog.Infof(ctx, "Updated %d resources in manifest file %s", changed, file)
+	}
+	return nil
+}
+
+// mergeIntoManifest updates the manifest at manifestPath from the live
+// resources of a tenant, as described for MergeManifest, and writes it back.
+func mergeIntoManifest(ctx context.Context, idpClient *idp.Client, fqtn string, manifestPath string) (*manifest.Manifest, manifest.MergeResult, *manifest.ExternValuesDirConfig, error) {
+	mfest, err := readManifest(ctx, manifestPath)
 	if err != nil {
-		return ucerr.Friendlyf(err, "failed to serialize manifest")
+		return nil, manifest.MergeResult{}, nil, ucerr.Wrap(err)
+	}
+	if errs := mfest.ValidateEntries(); len(errs) > 0 {
+		return nil, manifest.MergeResult{}, nil, ucerr.Friendlyf(errs[0], "Failed to validate manifest")
 	}
 
-	if err := os.WriteFile(manifestPath, serialized, 0644); err != nil {
-		return ucerr.Friendlyf(err, "failed to write manifest")
+	resources, _, err := fetchAndMatchLiveResources(ctx, idpClient, &mfest, fqtn)
+	if err != nil {
+		return nil, manifest.MergeResult{}, nil, ucerr.Wrap(err)
+	}
+
+	// Only update the attributes of entries that have drifted, so that
+	// function invocations in unchanged entries are kept
+	p, err := plan.Compute(&tfconfig.GenerationContext{
+		ManifestFilePath: manifestPath,
+		Manifest:         &mfest,
+		FQTN:             fqtn,
+		LiveResources:    &resources,
+	})
+	if err != nil {
+		return nil, manifest.MergeResult{}, nil, ucerr.Friendlyf(err, "Failed to compare live resources to the manifest")
+	}
+	changed := map[string]bool{}
+	for _, c := range p.Changes {
+		if c.Action == plan.ActionUpdate || c.Action == plan.ActionReplace {
+			changed[c.ManifestID] = true
+		}
 	}
 
-	uclog.Infof(ctx, "Wrote %d resources into manifest: %s", len(mfest.Resources), manifestPath)
+	uclog.Infof(ctx, "Merging live resources from %s into manifest...", fqtn)
+	externValuesDir, err := prepareExternValuesDir(manifestPath, false)
+	if err != nil {
+		return nil, manifest.MergeResult{}, nil, ucerr.Wrap(err)
+	}
+	// Attributes that keep their function invocations are compared to the
+	// live values after resolving them the same way apply does
+	resolveCtx := &tfconfig.GenerationContext{
+		ManifestFilePath: manifestPath,
+		Manifest:         &mfest,
+		FQTN:             fqtn,
+		LiveResources:    &resources,
+	}
+	resolve := func(r *manifest.Resource, val any) (any, error) {
+		return tfconfig.ResolveValue(val, resolveCtx.ForResource(r))
+	}
+	result, err := manifest.MergeLiveResources(ctx, &mfest, &resources, fqtn, changed, externValuesDir, resolve)
+	if err != nil {
+		return nil, manifest.MergeResult{}, nil, ucerr.Friendlyf(err, "failed to merge live resources into manifest")
+	}
+
+	if err := syncManifestFiles(ctx, manifestPath, &mfest, fqtn); err != nil {
+		return nil, manifest.MergeResult{}, nil, ucerr.Wrap(err)
+	}
+	uclog.Infof(ctx, "Updated %d and added %d resources in manifest: %s", len(result.Updated), len(result.Added), manifestPath)
+	return &mfest, result, externValuesDir, nil
+}
+
+// MergeManifest implements "ucconfig gen-manifest --merge", which updates an
+// existing manifest from a live tenant instead of overwriting it. Manifest
+// entries keep their manifest IDs and resource_uuids for other tenants, entries
+// whose attributes differ from the live tenant are updated, and live resources
+// that aren't in the manifest are added. Resources are written back to the
+// manifest files they were loaded from, and new resources are added to the
+// manifest at manifestPath. If outputFormat is OutputFormatJSON, a Report
+// listing the added and updated resources is printed to stdout.
+func MergeManifest(ctx context.Context, idpClient *idp.Client, fqtn string, manifestPath string, outputFormat string) error {
+	mfest, result, externValuesDir, err := mergeIntoManifest(ctx, idpClient, fqtn, manifestPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	if outputFormat == OutputFormatJSON {
+		report := newReport("gen-manifest", fqtn, manifestPath)
+		report.ValuesDir = externValuesDir.AbsolutePath
+		report.Warnings = result.Warnings
+		tenantUUIDs := mfest.TenantResourceUUIDs(fqtn)
+		byManifestID := map[string]manifest.Resource{}
+		for _, r := range mfest.Resources {
+			byManifestID[r.ManifestID] = r
+		}
+		for _, id := range result.Added {
+			report.Created = append(report.Created, ResourceReport{
+				TerraformTypeSuffix: byManifestID[id].TerraformTypeSuffix,
+				ManifestID:          id,
+				ResourceUUID:        tenantUUIDs[id],
+			})
+		}
+		for _, id := range result.Updated {
+			report.Updated = append(report.Updated, ResourceReport{
+				TerraformTypeSuffix: byManifestID[id].TerraformTypeSuffix,
+				ManifestID:          id,
+				ResourceUUID:        tenantUUIDs[id],
+			})
+		}
+		return ucerr.Wrap(report.write())
+	}
 	return nil
 }
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+)
+
+func TestTypeFileName(t *testing.T) {
+	assert.Equal(t, typeFileName("userstore_column", ".yaml"), "columns.yaml")
+	assert.Equal(t, typeFileName("userstore_accessor", ".json"), "accessors.json")
+	assert.Equal(t, typeFileName("access_policy", ".yaml"), "access_policies.yaml")
+	assert.Equal(t, typeFileName("access_policy_template", ".yaml"), "access_policy_templates.yaml")
+}
+
+func TestSplitByType(t *testing.T) {
+	mfest := manifest.Manifest{Resources: []manifest.Resource{
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "col1", ResourceUUIDs: map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"}, Attributes: map[string]any{"name": "a"}},
+		{TerraformTypeSuffix: "access_policy", ManifestID: "policy", ResourceUUIDs: map[string]string{"__DEFAULT": "633fac47-c6c1-4459-93e0-0bb4043e60a0"}, Attributes: map[string]any{"name": "p"}},
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "col2", ResourceUUIDs: map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"}, Attributes: map[string]any{"name": "b"}},
+	}}
+	root, files := splitByType(&mfest, ".yaml")
+	assert.Equal(t, root.Includes, []string{"columns.yaml", "access_policies.yaml"})
+	assert.Equal(t, len(root.Resources), 0)
+	assert.Equal(t, len(files["columns.yaml"].Resources), 2)
+	assert.Equal(t, files["columns.yaml"].Resources[1].ManifestID, "col2")
+	assert.Equal(t, len(files["access_policies.yaml"].Resources), 1)
+
+	// The split files should load back into the same set of resources
+	dir := t.TempDir()
+	for name, m := range files {
+		assert.NoErr(t, writeManifest(m, filepath.Join(dir, name)))
+	}
+	assert.NoErr(t, writeManifest(root, filepath.Join(dir, "manifest.yaml")))
+	loaded, err := manifest.Load(filepath.Join(dir, "manifest.yaml"))
+	assert.NoErr(t, err)
+	var ids []string
+	for _, r := range loaded.Resources {
+		ids = append(ids, r.ManifestID)
+	}
+	assert.Equal(t, ids, []string{"col1", "col2", "policy"})
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// Tenant stores what's needed to apply a manifest to one of several tenants
+type Tenant struct {
+	FQTN         string
+	IDPClient    *idp.Client
+	TenantURL    string
+	ClientID     string
+	ClientSecret string
+}
+
+// Outcomes of applying a manifest to one of several tenants
+const (
+	TenantResultApplied   = "applied"
+	TenantResultNoChanges = "no changes"
+	TenantResultFailed    = "failed"
+	TenantResultSkipped   = "skipped"
+)
+
+// TenantResult records what happened when applying a manifest to one of
+// several tenants
+type TenantResult struct {
+	FQTN   string
+	Result string
+	Err    error
+}
+
+// writeTenantSummary writes one line per tenant with the number of changes in
+// the plan that was computed for it
+func writeTenantSummary(w io.Writer, reports []*Report) error {
+	if _, err := io.WriteString(w, "Summary:\n"); err != nil {
+		return ucerr.Wrap(err)
+	}
+	for _, r := range reports {
+		if _, err := fmt.Fprintf(w, "  %s: %d to create, %d to update, %d to replace, %d to delete\n", r.FQTN, len(r.Created), len(r.Updated), len(r.Replaced), len(r.Deleted)); err != nil {
+			return ucerr.Wrap(err)
+		}
+	}
+	_, err := io.WriteString(w, "\n")
+	return ucerr.Wrap(err)
+}
+
+// writeTenantResults writes one line per tenant with the outcome of applying
+// the manifest to it
+func writeTenantResults(w io.Writer, results []TenantResult) error {
+	if _, err := io.WriteString(w, "Results:\n"); err != nil {
+		return ucerr.Wrap(err)
+	}
+	for _, r := range results {
+		line := fmt.Sprintf("  %s: %s\n", r.FQTN, r.Result)
+		if r.Err != nil {
+			line = fmt.Sprintf("  %s: %s: %v\n", r.FQTN, r.Result, r.Err)
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return ucerr.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// ApplyToTenants implements "ucconfig apply --tenants", which applies a
+// manifest to several tenants. It first plans every tenant with the engine
+// that will apply it, printing each plan followed by a combined summary, so
+// that nothing is changed if any tenant fails to plan (or fails the deletion
+// safeguards). After a single confirmation, it carries out exactly those plans
+// in order (for Terraform, the saved plan files), stopping at the first
+// failure, and prints the result for each tenant.
+func ApplyToTenants(ctx context.Context, tenants []Tenant, opts ApplyOptions) error {
+	if opts.OutputFormat == OutputFormatJSON {
+		return ucerr.Friendlyf(nil, "JSON output is not supported when applying to multiple tenants")
+	}
+	if opts.DryRun && opts.AutoApprove {
+		return ucerr.Friendlyf(nil, "dry run and auto approve flags are mutually exclusive")
+	}
+	if opts.DryRun && opts.WriteBack {
+		return ucerr.Friendlyf(nil, "dry run and write back flags are mutually exclusive")
+	}
+	if opts.BackendConfigPath != "" {
+		return ucerr.Friendlyf(nil, "--backend-config can't be used when applying to multiple tenants, since each tenant needs its own Terraform state")
+	}
+	seen := map[string]bool{}
+	for _, t := range tenants {
+		if seen[t.FQTN] {
+			return ucerr.Friendlyf(nil, "Tenant %s is listed more than once", t.FQTN)
+		}
+		seen[t.FQTN] = true
+	}
+
+	prepared := make([]*preparedApply, 0, len(tenants))
+	reports := make([]*Report, 0, len(tenants))
+	for _, t := range tenants {
+		uclog.Infof(ctx, "Planning changes to %s...", t.FQTN)
+		tenantOpts := opts
+		tenantOpts.TenantURL = t.TenantURL
+		tenantOpts.ClientID = t.ClientID
+		tenantOpts.ClientSecret = t.ClientSecret
+		if opts.WorkDir != "" {
+			// Each tenant has its own Terraform state
+			tenantOpts.WorkDir = filepath.Join(opts.WorkDir, t.FQTN)
+		}
+		pa, err := planApply(ctx, t.IDPClient, t.FQTN, tenantOpts)
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to plan changes to %s", t.FQTN)
+		}
+		if _, err := io.WriteString(os.Stdout, "\n"); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write plan")
+		}
+		prepared = append(prepared, pa)
+		reports = append(reports, pa.report)
+	}
+	if err := writeTenantSummary(os.Stdout, reports); err != nil {
+		return ucerr.Friendlyf(err, "Failed to write summary")
+	}
+	if opts.DryRun {
+		return nil
+	}
+
+	if !opts.AutoApprove {
+		approved, err := confirm(fmt.Sprintf("Do you want to apply these changes to %d tenants?", len(tenants)))
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to read confirmation")
+		}
+		if !approved {
+			return ucerr.Friendlyf(nil, "Apply cancelled")
+		}
+	}
+
+	results := make([]TenantResult, 0, len(tenants))
+	var applyErr error
+	for _, pa := range prepared {
+		if applyErr != nil {
+			results = append(results, TenantResult{FQTN: pa.fqtn, Result: TenantResultSkipped})
+			continue
+		}
+		// Plans without changes are still run, since a Terraform plan may
+		// import resources into the state, and write back may need to record
+		// UUIDs of resources matched by name
+		uclog.Infof(ctx, "Applying manifest to %s...", pa.fqtn)
+		if err := pa.run(ctx); err != nil {
+			applyErr = ucerr.Friendlyf(err, "Failed to apply manifest to %s; later tenants were skipped", pa.fqtn)
+			results = append(results, TenantResult{FQTN: pa.fqtn, Result: TenantResultFailed, Err: err})
+			continue
+		}
+		if pa.report.hasChanges() {
+			results = append(results, TenantResult{FQTN: pa.fqtn, Result: TenantResultApplied})
+		} else {
+			results = append(results, TenantResult{FQTN: pa.fqtn, Result: TenantResultNoChanges})
+		}
+	}
+	if err := writeTenantResults(os.Stdout, results); err != nil {
+		return ucerr.Friendlyf(err, "Failed to write results")
+	}
+	return ucerr.Wrap(applyErr)
+}
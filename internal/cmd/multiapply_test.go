@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/infra/assert"
+	"userclouds.com/infra/ucerr"
+)
+
+func TestTenantSummaryAndResults(t *testing.T) {
+	dev := newReport("apply", "mycompany-dev", "manifest.yaml")
+	addPlanToReport(dev, &plan.Plan{FQTN: "mycompany-dev", Changes: []plan.ResourceChange{{Action: plan.ActionCreate}, {Action: plan.ActionReplace}, {Action: plan.ActionDelete}}})
+	prod := newReport("apply", "mycompany-prod", "manifest.yaml")
+	var b strings.Builder
+	assert.NoErr(t, writeTenantSummary(&b, []*Report{dev, prod}))
+	assert.Equal(t, b.String(), `Summary:
+  mycompany-dev: 1 to create, 0 to update, 1 to replace, 1 to delete
+  mycompany-prod: 0 to create, 0 to update, 0 to replace, 0 to delete
+
+`)
+
+	b.Reset()
+	assert.NoErr(t, writeTenantResults(&b, []TenantResult{
+		{FQTN: "mycompany-dev", Result: TenantResultApplied},
+		{FQTN: "mycompany-staging", Result: TenantResultFailed, Err: ucerr.Errorf("boom")},
+		{FQTN: "mycompany-prod", Result: TenantResultSkipped},
+	}))
+	assert.True(t, strings.HasPrefix(b.String(), "Results:\n  mycompany-dev: applied\n  mycompany-staging: failed: "))
+	assert.True(t, strings.HasSuffix(b.String(), "\n  mycompany-prod: skipped\n"))
+}
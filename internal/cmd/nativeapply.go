@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"userclouds.com/cmd/ucconfig/internal/engine"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// Engines that can be used to apply a manifest
+const (
+	EngineTerraform = "terraform"
+	EngineNative    = "native"
+)
+
+// confirm asks the user to type "yes" to continue, like `terraform apply` does
+func confirm(prompt string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s\n  Only 'yes' will be accepted to approve.\n\n  Enter a value: ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, ucerr.Wrap(err)
+	}
+	return strings.TrimSpace(answer) == "yes", nil
+}
+
+func addPlanToReport(report *Report, p *plan.Plan) {
+	for _, c := range p.Changes {
+		r := ResourceReport{
+			TerraformTypeSuffix: c.TerraformTypeSuffix,
+			ManifestID:          c.ManifestID,
+			ResourceUUID:        c.ResourceUUID,
+		}
+		switch c.Action {
+		case plan.ActionCreate:
+			report.Created = append(report.Created, r)
+		case plan.ActionUpdate:
+			report.Updated = append(report.Updated, r)
+		case plan.ActionReplace:
+			report.Replaced = append(report.Replaced, r)
+		case plan.ActionDelete:
+			report.Deleted = append(report.Deleted, r)
+		}
+	}
+}
+
+// planNative computes and prints the plan for applying a manifest by calling
+// the UC API directly instead of running Terraform, and returns the steps
+// that carry it out
+func planNative(ctx context.Context, genCtx *tfconfig.GenerationContext, opts ApplyOptions, report *Report) ([]engine.Step, error) {
+	uclog.Infof(ctx, "Computing plan...")
+	p, err := plan.Compute(genCtx)
+	if err != nil {
+		return nil, ucerr.Friendlyf(err, "Failed to compute plan")
+	}
+
+	planOutput := os.Stdout
+	if opts.OutputFormat == OutputFormatJSON {
+		planOutput = os.Stderr
+	}
+	if err := p.WriteText(planOutput); err != nil {
+		return nil, ucerr.Friendlyf(err, "Failed to write plan")
+	}
+	addPlanToReport(report, p)
+	if err := checkDestructiveChanges(ctx, genCtx.Manifest, genCtx.FQTN, report, opts.MaxDeletes); err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	// Ordering the changes also rejects replacements, which the native engine
+	// can't carry out
+	steps, err := engine.Order(p, genCtx)
+	if err != nil {
+		return nil, ucerr.Friendlyf(err, "Failed to order changes")
+	}
+	return steps, nil
+}
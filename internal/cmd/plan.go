@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// Plan implements a "ucconfig plan" subcommand that prints the changes that
+// applying a manifest would make, without running Terraform.
+func Plan(ctx context.Context, idpClient *idp.Client, fqtn string, manifestPath string, outputFormat string) error {
+	mfest, err := readManifest(ctx, manifestPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	if err := mfest.Validate(fqtn); err != nil {
+		return ucerr.Friendlyf(err, "Failed to validate manifest")
+	}
+
+	resources, _, err := fetchAndMatchLiveResources(ctx, idpClient, &mfest, fqtn)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	uclog.Infof(ctx, "Computing plan...")
+	p, err := plan.Compute(&tfconfig.GenerationContext{
+		ManifestFilePath: manifestPath,
+		Manifest:         &mfest,
+		FQTN:             fqtn,
+		LiveResources:    &resources,
+	})
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to compute plan")
+	}
+
+	switch outputFormat {
+	case OutputFormatJSON:
+		serialized, err := json.MarshalIndent(p, "", "  ")
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to serialize plan")
+		}
+		if _, err := os.Stdout.Write(append(serialized, '\n')); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write plan")
+		}
+	case OutputFormatText, "":
+		if err := p.WriteText(os.Stdout); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write plan")
+		}
+	default:
+		return ucerr.Friendlyf(nil, "Unknown output format %s", outputFormat)
+	}
+	return nil
+}
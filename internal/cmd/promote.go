@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"context"
+
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// Promote implements a "ucconfig promote" subcommand that copies configuration
+// from one tenant to another through a manifest. It merges the live resources
+// of the source tenant into the manifest (as gen-manifest --merge does), so
+// that resources created in the source tenant are added with their source
+// UUIDs as __DEFAULT and existing entries keep their UUIDs for other tenants,
+// and then prints the plan for applying the updated manifest to the target
+// tenant. It doesn't change the target tenant; apply the manifest to do that.
+func Promote(ctx context.Context, fromClient *idp.Client, fromFQTN string, toClient *idp.Client, toFQTN string, manifestPath string, outputFormat string) error {
+	if fromFQTN == toFQTN {
+		return ucerr.Friendlyf(nil, "Source and target tenants are both %s", fromFQTN)
+	}
+
+	if _, _, _, err := mergeIntoManifest(ctx, fromClient, fromFQTN, manifestPath); err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	uclog.Infof(ctx, "Planning changes to %s...", toFQTN)
+	return ucerr.Wrap(Plan(ctx, toClient, toFQTN, manifestPath, outputFormat))
+}
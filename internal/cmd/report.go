@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/ucerr"
+)
+
+// Output formats supported by subcommands that take an --output flag
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json"
+)
+
+// ResourceReport identifies a single resource in a Report
+type ResourceReport struct {
+	TerraformTypeSuffix string `json:"uc_terraform_type"`
+	// ManifestID is blank for live resources that weren't matched to a manifest
+	// entry
+	ManifestID   string `json:"manifest_id,omitempty"`
+	ResourceUUID string `json:"resource_uuid"`
+}
+
+// Report is the machine-readable summary printed by subcommands when run with
+// --output=json
+type Report struct {
+	Command      string `json:"command"`
+	FQTN         string `json:"fqtn"`
+	ManifestPath string `json:"manifest_path"`
+	DryRun       bool   `json:"dry_run,omitempty"`
+	// TerraformDir is the directory containing the generated Terraform files
+	TerraformDir string `json:"terraform_dir,omitempty"`
+	// ValuesDir is the directory that gen-manifest wrote external attribute
+	// values to
+	ValuesDir string                  `json:"values_dir,omitempty"`
+	Created   []ResourceReport        `json:"created"`
+	Updated   []ResourceReport        `json:"updated"`
+	Replaced  []ResourceReport        `json:"replaced"`
+	Deleted   []ResourceReport        `json:"deleted"`
+	Warnings  []manifest.MatchWarning `json:"warnings"`
+}
+
+func newReport(command string, fqtn string, manifestPath string) *Report {
+	return &Report{
+		Command:      command,
+		FQTN:         fqtn,
+		ManifestPath: manifestPath,
+		Created:      []ResourceReport{},
+		Updated:      []ResourceReport{},
+		Replaced:     []ResourceReport{},
+		Deleted:      []ResourceReport{},
+		Warnings:     []manifest.MatchWarning{},
+	}
+}
+
+// hasChanges returns true if the report lists any resources that are created,
+// updated, replaced, or deleted
+func (r *Report) hasChanges() bool {
+	return len(r.Created)+len(r.Updated)+len(r.Replaced)+len(r.Deleted) > 0
+}
+
+// write prints the report as JSON to stdout
+func (r *Report) write() error {
+	serialized, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return ucerr.Friendlyf(err, "Failed to serialize report")
+	}
+	if _, err := os.Stdout.Write(append(serialized, '\n')); err != nil {
+		return ucerr.Friendlyf(err, "Failed to write report")
+	}
+	return nil
+}
+
+// terraformPlanJSON contains the parts of the `terraform show -json <planfile>`
+// output that we use. The full format is documented at
+// https://developer.hashicorp.com/terraform/internals/json-format
+type terraformPlanJSON struct {
+	ResourceChanges []struct {
+		Type   string `json:"type"`
+		Name   string `json:"name"`
+		Change struct {
+			Actions []string       `json:"actions"`
+			Before  map[string]any `json:"before"`
+			After   map[string]any `json:"after"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// addTerraformPlan adds the resource changes from a `terraform show -json`
+// plan to the report
+func (r *Report) addTerraformPlan(planJSON []byte) error {
+	var tfPlan terraformPlanJSON
+	if err := json.Unmarshal(planJSON, &tfPlan); err != nil {
+		return ucerr.Friendlyf(err, "Failed to decode Terraform plan JSON")
+	}
+	for _, rc := range tfPlan.ResourceChanges {
+		resource := ResourceReport{
+			TerraformTypeSuffix: strings.TrimPrefix(rc.Type, "userclouds_"),
+		}
+		if strings.HasPrefix(rc.Name, "manifestid-") {
+			resource.ManifestID = strings.TrimPrefix(rc.Name, "manifestid-")
+		}
+		if id, ok := rc.Change.After["id"].(string); ok {
+			resource.ResourceUUID = id
+		} else if id, ok := rc.Change.Before["id"].(string); ok {
+			resource.ResourceUUID = id
+		}
+
+		switch strings.Join(rc.Change.Actions, ",") {
+		case "create":
+			r.Created = append(r.Created, resource)
+		case "update":
+			r.Updated = append(r.Updated, resource)
+		case "delete":
+			r.Deleted = append(r.Deleted, resource)
+		case "delete,create", "create,delete":
+			r.Replaced = append(r.Replaced, resource)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+
+	"userclouds.com/infra/assert"
+)
+
+func TestReportAddTerraformPlan(t *testing.T) {
+	planJSON := `{
+		"format_version": "1.2",
+		"resource_changes": [
+			{
+				"address": "userclouds_userstore_column.manifestid-email_col",
+				"type": "userclouds_userstore_column",
+				"name": "manifestid-email_col",
+				"change": {"actions": ["create"], "before": null, "after": {"id": "2c7a7c9b-90e8-47e4-8f6e-ec73bd2dec16"}}
+			},
+			{
+				"address": "userclouds_userstore_accessor.manifestid-demo",
+				"type": "userclouds_userstore_accessor",
+				"name": "manifestid-demo",
+				"change": {"actions": ["no-op"], "before": {"id": "fe20fd48-a006-4ad8-9208-4aad540d8794"}, "after": {"id": "fe20fd48-a006-4ad8-9208-4aad540d8794"}}
+			},
+			{
+				"address": "userclouds_transformer.unmatched-c860a6d7-c632-4f81-8f5f-597290a9f437",
+				"type": "userclouds_transformer",
+				"name": "unmatched-c860a6d7-c632-4f81-8f5f-597290a9f437",
+				"change": {"actions": ["delete"], "before": {"id": "c860a6d7-c632-4f81-8f5f-597290a9f437"}, "after": null}
+			}
+		]
+	}`
+	report := newReport("apply", "mycompany-prod", "manifest.yaml")
+	assert.NoErr(t, report.addTerraformPlan([]byte(planJSON)))
+	assert.Equal(t, report.Created, []ResourceReport{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "email_col",
+		ResourceUUID:        "2c7a7c9b-90e8-47e4-8f6e-ec73bd2dec16",
+	}})
+	assert.Equal(t, len(report.Updated), 0)
+	assert.Equal(t, report.Deleted, []ResourceReport{{
+		TerraformTypeSuffix: "transformer",
+		ResourceUUID:        "c860a6d7-c632-4f81-8f5f-597290a9f437",
+	}})
+}
@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// A snapshot is a directory containing a manifest generated from a tenant's
+// live resources just before an apply (plus its values directory), and a
+// metadata file describing where it came from. Applying the snapshot's
+// manifest reverts the tenant to how it was before the apply.
+const (
+	snapshotManifestName = "manifest.yaml"
+	snapshotMetadataName = "snapshot.json"
+)
+
+// snapshotMetadata is stored alongside the manifest in a snapshot directory
+type snapshotMetadata struct {
+	FQTN      string    `json:"fqtn"`
+	CreatedAt time.Time `json:"created_at"`
+	// ManifestPath is the manifest that was being applied when the snapshot
+	// was taken
+	ManifestPath string `json:"manifest_path"`
+}
+
+// writeSnapshot saves the live resources of a tenant into a new timestamped
+// directory under backupDir, returning the path to that directory. The live
+// resources should already have been matched against mfest, so that the
+// snapshot uses the same manifest IDs, and the snapshot keeps mfest's scope so
+// that rolling back leaves out-of-scope resources alone.
+func writeSnapshot(ctx context.Context, backupDir string, fqtn string, manifestPath string, mfest *manifest.Manifest, liveResources []liveresource.Resource) (string, error) {
+	now := time.Now().UTC()
+	dir := filepath.Join(backupDir, fqtn+"-"+now.Format("20060102T150405Z"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", ucerr.Friendlyf(err, "Failed to create snapshot directory %s", dir)
+	}
+
+	snapshotManifestPath := filepath.Join(dir, snapshotManifestName)
+	externValuesDir, err := prepareExternValuesDir(snapshotManifestPath, true)
+	if err != nil {
+		return "", ucerr.Wrap(err)
+	}
+	snapshot, err := manifest.GenerateFromLiveResources(ctx, &liveResources, fqtn, mfest.Scope, externValuesDir)
+	if err != nil {
+		return "", ucerr.Friendlyf(err, "Failed to generate snapshot manifest")
+	}
+	if snapshot.Resources == nil {
+		snapshot.Resources = []manifest.Resource{}
+	}
+	if err := writeManifest(&snapshot, snapshotManifestPath); err != nil {
+		return "", ucerr.Wrap(err)
+	}
+
+	metadata, err := json.MarshalIndent(snapshotMetadata{
+		FQTN:         fqtn,
+		CreatedAt:    now,
+		ManifestPath: manifestPath,
+	}, "", "  ")
+	if err != nil {
+		return "", ucerr.Friendlyf(err, "Failed to serialize snapshot metadata")
+	}
+	if err := os.WriteFile(filepath.Join(dir, snapshotMetadataName), metadata, 0644); err != nil {
+		return "", ucerr.Friendlyf(err, "Failed to write snapshot metadata")
+	}
+	uclog.Infof(ctx, "Saved snapshot of %d live resources to %s", len(snapshot.Resources), dir)
+	return dir, nil
+}
+
+// readSnapshot returns the path to a snapshot's manifest along with its
+// metadata. snapshotPath may be the snapshot directory or its manifest file.
+func readSnapshot(snapshotPath string) (string, snapshotMetadata, error) {
+	dir := snapshotPath
+	if info, err := os.Stat(snapshotPath); err == nil && !info.IsDir() {
+		dir = filepath.Dir(snapshotPath)
+	}
+	metadataBytes, err := os.ReadFile(filepath.Join(dir, snapshotMetadataName))
+	if err != nil {
+		return "", snapshotMetadata{}, ucerr.Friendlyf(err, "Failed to read snapshot metadata; %s does not look like a snapshot directory", snapshotPath)
+	}
+	var metadata snapshotMetadata
+	if err := json.Unmarshal(metadataBytes, &metadata); err != nil {
+		return "", snapshotMetadata{}, ucerr.Friendlyf(err, "Failed to decode snapshot metadata")
+	}
+	return filepath.Join(dir, snapshotManifestName), metadata, nil
+}
+
+// Rollback implements a "ucconfig rollback" subcommand that applies a snapshot
+// taken by a previous apply, reverting the tenant to how it was at the time.
+// opts.ManifestPath is ignored in favor of the snapshot's manifest.
+func Rollback(ctx context.Context, idpClient *idp.Client, fqtn string, snapshotPath string, opts ApplyOptions) error {
+	manifestPath, metadata, err := readSnapshot(snapshotPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	if metadata.FQTN != fqtn {
+		return ucerr.Friendlyf(nil, "Snapshot %s was taken from tenant %s, but the current tenant is %s", snapshotPath, metadata.FQTN, fqtn)
+	}
+	uclog.Infof(ctx, "Rolling back %s to snapshot taken at %s (before applying %s)", fqtn, metadata.CreatedAt.Format(time.RFC3339), metadata.ManifestPath)
+	opts.ManifestPath = manifestPath
+	return ucerr.Wrap(Apply(ctx, idpClient, fqtn, opts))
+}
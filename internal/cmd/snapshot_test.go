@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+	"userclouds.com/test/testlogtransport"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	ctx := context.Background()
+	backupDir := t.TempDir()
+
+	live := []liveresource.Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+			ManifestID:          "email_col",
+			Attributes:          map[string]any{"name": "email", "type": "string"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_accessor",
+			ResourceUUID:        "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+			ManifestID:          "accessor",
+			Attributes: map[string]any{
+				"name":    "acc",
+				"columns": []any{map[string]any{"column": "fe20fd48-a006-4ad8-9208-4aad540d8794"}},
+				// Outside of the manifest's scope, so not in the live resources
+				"access_policy": "dc42da22-4c49-459d-9572-3b5db6d61959",
+			},
+		},
+	}
+	mfest := manifest.Manifest{Scope: &manifest.Scope{Types: []string{"userstore_column", "userstore_accessor"}}}
+	dir, err := writeSnapshot(ctx, backupDir, "mycompany-prod", "manifest.yaml", &mfest, live)
+	assert.NoErr(t, err)
+
+	// Snapshotting shouldn't modify the live resources, which are still used
+	// for the apply
+	assert.Equal(t, live[1].Attributes["columns"], []any{map[string]any{"column": "fe20fd48-a006-4ad8-9208-4aad540d8794"}})
+
+	manifestPath, metadata, err := readSnapshot(dir)
+	assert.NoErr(t, err)
+	assert.Equal(t, metadata.FQTN, "mycompany-prod")
+	assert.Equal(t, metadata.ManifestPath, "manifest.yaml")
+	// The manifest file itself can also be passed
+	samePath, _, err := readSnapshot(manifestPath)
+	assert.NoErr(t, err)
+	assert.Equal(t, samePath, manifestPath)
+
+	snapshot, err := manifest.Load(manifestPath)
+	assert.NoErr(t, err)
+	assert.NoErr(t, snapshot.Validate("mycompany-prod"))
+	assert.Equal(t, snapshot.Scope.Types, []string{"userstore_column", "userstore_accessor"})
+	assert.Equal(t, len(snapshot.Resources), 2)
+	assert.Equal(t, snapshot.Resources[1].ManifestID, "accessor")
+	assert.Equal(t, snapshot.Resources[1].Attributes["columns"], []any{map[string]any{"column": `@UC_MANIFEST_ID("email_col").id`}})
+	assert.Equal(t, snapshot.Resources[1].Attributes["access_policy"], "dc42da22-4c49-459d-9572-3b5db6d61959")
+
+	_, err = os.Stat(filepath.Join(dir, "manifest_values"))
+	assert.NoErr(t, err)
+
+	// Rolling back a snapshot onto a different tenant is refused before
+	// connecting to it
+	err = Rollback(ctx, nil, "mycompany-staging", dir, ApplyOptions{})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// userCloudsTenantDomainSuffix is the domain that tenants are hosted under
+// when they aren't using a custom domain, e.g.
+// mycompany-mytenant.tenant.userclouds.com
+const userCloudsTenantDomainSuffix = ".userclouds.com"
+
+// fqtnFromHostname returns the fully-qualified tenant name for a hostname
+// under userCloudsTenantDomainSuffix, which is its first label
+func fqtnFromHostname(hostname string) string {
+	return strings.Split(hostname, ".")[0]
+}
+
+// oidcDiscoveryDocument contains the parts of a tenant's OIDC discovery
+// document that we use
+type oidcDiscoveryDocument struct {
+	Issuer string `json:"issuer"`
+}
+
+// fqtnFromIssuer fetches the tenant's OIDC discovery document and derives the
+// tenant name from its issuer, which is the tenant's userclouds.com URL even
+// when the tenant is accessed through a custom domain.
+func fqtnFromIssuer(ctx context.Context, client *http.Client, tenantURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(tenantURL, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", ucerr.Wrap(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", ucerr.Wrap(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", ucerr.Errorf("unexpected status %d fetching OIDC discovery document", resp.StatusCode)
+	}
+	var doc oidcDiscoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return "", ucerr.Errorf("error decoding OIDC discovery document: %v", err)
+	}
+	issuer, err := url.Parse(doc.Issuer)
+	if err != nil {
+		return "", ucerr.Errorf("error parsing OIDC issuer \"%s\": %v", doc.Issuer, err)
+	}
+	if !strings.HasSuffix(issuer.Hostname(), userCloudsTenantDomainSuffix) {
+		return "", ucerr.Errorf("OIDC issuer %s is not a userclouds.com URL", doc.Issuer)
+	}
+	return fqtnFromHostname(issuer.Hostname()), nil
+}
+
+// ResolveFQTN returns the fully-qualified tenant name for a tenant URL. For
+// userclouds.com URLs, this is the first label of the hostname. For tenants
+// behind a custom domain, the name is taken from the issuer in the tenant's
+// OIDC discovery document. If that fails, it falls back to the first label of
+// the hostname, and returns derived=true to indicate that the name is only a
+// guess that should be checked against the manifest with CheckFQTN. client is
+// used to fetch the discovery document, and should be the same (retrying)
+// client that is used for the UC API.
+func ResolveFQTN(ctx context.Context, client *http.Client, tenantURL string) (fqtn string, derived bool, err error) {
+	parsed, err := url.Parse(tenantURL)
+	if err != nil {
+		return "", false, ucerr.Friendlyf(err, "Failed to parse tenant URL")
+	}
+	hostname := parsed.Hostname()
+	if strings.HasSuffix(hostname, userCloudsTenantDomainSuffix) {
+		return fqtnFromHostname(hostname), false, nil
+	}
+	fqtn, err = fqtnFromIssuer(ctx, client, tenantURL)
+	if err != nil {
+		fallback := fqtnFromHostname(hostname)
+		uclog.Warningf(ctx, "Could not look up the tenant name for %s (%v), so assuming it is \"%s\". Pass --fqtn to set it explicitly.", tenantURL, err, fallback)
+		return fallback, true, nil
+	}
+	return fqtn, false, nil
+}
+
+// CheckFQTN returns an error if the manifest at manifestPath has
+// tenant-specific resource_uuids, but none of them are for fqtn. This catches
+// tenant names that were derived incorrectly (e.g. from a custom domain),
+// which would otherwise silently match every resource by __DEFAULT UUID or by
+// name instead. If the manifest only has __DEFAULT UUIDs, the name can't be
+// checked, so it logs a warning instead.
+func CheckFQTN(ctx context.Context, manifestPath string, fqtn string) error {
+	mfest, err := readManifest(ctx, manifestPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	tenants := map[string]bool{}
+	for _, r := range mfest.Resources {
+		for tenant := range r.ResourceUUIDs {
+			if tenant == fqtn {
+				return nil
+			}
+			if tenant != "__DEFAULT" {
+				tenants[tenant] = true
+			}
+		}
+	}
+	if len(tenants) == 0 {
+		if len(mfest.Resources) > 0 {
+			uclog.Warningf(ctx, "Using tenant name \"%s\", which was guessed from the tenant URL and couldn't be checked because %s only has __DEFAULT resource_uuids. If it is wrong, UUIDs written back for this tenant will be recorded under the wrong name; pass --fqtn to set it explicitly.", fqtn, manifestPath)
+		}
+		return nil
+	}
+	var names []string
+	for tenant := range tenants {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+	return ucerr.Friendlyf(nil, "Tenant name \"%s\" does not appear in the resource_uuids of any resource in %s (found: %s). If the tenant name is wrong, pass the right one with --fqtn; if this is a new tenant, pass --fqtn %s to confirm it.", fqtn, manifestPath, strings.Join(names, ", "), fqtn)
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+	"userclouds.com/infra/uclog"
+	"userclouds.com/test/testlogtransport"
+)
+
+func TestResolveFQTN(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	ctx := context.Background()
+
+	fqtn, derived, err := ResolveFQTN(ctx, http.DefaultClient, "https://mycompany-prod.tenant.userclouds.com")
+	assert.NoErr(t, err)
+	assert.Equal(t, fqtn, "mycompany-prod")
+	assert.False(t, derived)
+
+	// A custom domain, whose discovery document names the real tenant
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/.well-known/openid-configuration")
+		_, _ = w.Write([]byte(`{"issuer": "https://mycompany-prod.tenant.userclouds.com"}`))
+	}))
+	defer server.Close()
+	fqtn, derived, err = ResolveFQTN(ctx, http.DefaultClient, server.URL)
+	assert.NoErr(t, err)
+	assert.Equal(t, fqtn, "mycompany-prod")
+	assert.False(t, derived)
+
+	// If the lookup fails, fall back to the hostname
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+	fqtn, derived, err = ResolveFQTN(ctx, http.DefaultClient, failing.URL)
+	assert.NoErr(t, err)
+	assert.Equal(t, fqtn, "127")
+	assert.True(t, derived)
+}
+
+func TestCheckFQTN(t *testing.T) {
+	tt := testlogtransport.InitLoggerAndTransportsForTests(t)
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	assert.NoErr(t, writeManifest(&manifest.Manifest{Resources: []manifest.Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "email_col",
+		ResourceUUIDs: map[string]string{
+			"__DEFAULT":      "fe20fd48-a006-4ad8-9208-4aad540d8794",
+			"mycompany-prod": "c860a6d7-c632-4f81-8f5f-597290a9f437",
+		},
+		Attributes: map[string]any{"name": "email"},
+	}}}, path))
+
+	assert.NoErr(t, CheckFQTN(ctx, path, "mycompany-prod"))
+	assert.NotNil(t, CheckFQTN(ctx, path, "auth"))
+	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 0)
+
+	// Manifests with only __DEFAULT UUIDs can't be checked, so only a warning
+	// is logged
+	assert.NoErr(t, writeManifest(&manifest.Manifest{Resources: []manifest.Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "email_col",
+		ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		Attributes:          map[string]any{"name": "email"},
+	}}}, path))
+	assert.NoErr(t, CheckFQTN(ctx, path, "auth"))
+	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 1)
+}
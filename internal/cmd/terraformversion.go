@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// terraformVersion is a parsed Terraform version number
+type terraformVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// minImportBlockVersion is the first Terraform version that supports import
+// blocks in the configuration
+var minImportBlockVersion = terraformVersion{Major: 1, Minor: 5}
+
+// The range of Terraform versions that ucconfig supports. The generated state
+// uses version 4 of the state format, which all 1.x versions use.
+var (
+	minSupportedTerraformVersion = terraformVersion{Major: 1}
+	// exclusive
+	maxSupportedTerraformVersion = terraformVersion{Major: 2}
+)
+
+func (v terraformVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// AtLeast returns true if v is the same as or newer than other
+func (v terraformVersion) AtLeast(other terraformVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+// parseTerraformVersion parses a version like "1.5.7" or "1.6.0-beta1"
+func parseTerraformVersion(s string) (terraformVersion, error) {
+	core, _, _ := strings.Cut(strings.TrimPrefix(s, "v"), "-")
+	parts := strings.Split(core, ".")
+	if len(parts) != 3 {
+		return terraformVersion{}, ucerr.Errorf("unrecognized Terraform version \"%s\"", s)
+	}
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return terraformVersion{}, ucerr.Errorf("unrecognized Terraform version \"%s\"", s)
+		}
+		nums[i] = n
+	}
+	return terraformVersion{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+// detectTerraformVersion returns the version of the installed terraform
+// binary
+func detectTerraformVersion() (terraformVersion, error) {
+	out, err := exec.Command("terraform", "version", "-json").Output()
+	if err != nil {
+		return terraformVersion{}, ucerr.Wrap(err)
+	}
+	var parsed struct {
+		TerraformVersion string `json:"terraform_version"`
+	}
+	if err := json.Unmarshal(out, &parsed); err != nil {
+		return terraformVersion{}, ucerr.Errorf("error decoding `terraform version -json` output: %v", err)
+	}
+	return parseTerraformVersion(parsed.TerraformVersion)
+}
+
+// checkTerraformVersion returns an error if ucconfig doesn't support the given
+// Terraform version
+func checkTerraformVersion(v terraformVersion) error {
+	if !v.AtLeast(minSupportedTerraformVersion) || v.AtLeast(maxSupportedTerraformVersion) {
+		return ucerr.Friendlyf(nil, "Terraform %s is not supported. ucconfig requires Terraform %s or later, and earlier than %s.", v, minSupportedTerraformVersion, maxSupportedTerraformVersion)
+	}
+	return nil
+}
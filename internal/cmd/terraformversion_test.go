@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"userclouds.com/infra/assert"
+)
+
+func TestParseTerraformVersion(t *testing.T) {
+	v, err := parseTerraformVersion("1.5.7")
+	assert.NoErr(t, err)
+	assert.Equal(t, v, terraformVersion{Major: 1, Minor: 5, Patch: 7})
+	assert.True(t, v.AtLeast(minImportBlockVersion))
+
+	v, err = parseTerraformVersion("1.4.6")
+	assert.NoErr(t, err)
+	assert.False(t, v.AtLeast(minImportBlockVersion))
+
+	v, err = parseTerraformVersion("1.6.0-beta1")
+	assert.NoErr(t, err)
+	assert.Equal(t, v.String(), "1.6.0")
+
+	_, err = parseTerraformVersion("dev")
+	assert.NotNil(t, err)
+
+	assert.NoErr(t, checkTerraformVersion(terraformVersion{Major: 1, Minor: 9, Patch: 2}))
+	assert.NotNil(t, checkTerraformVersion(terraformVersion{Minor: 15, Patch: 5}))
+	assert.NotNil(t, checkTerraformVersion(terraformVersion{Major: 2}))
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// Validate implements a "ucconfig validate" subcommand that checks a manifest
+// for problems without connecting to a tenant. If fqtn is non-empty, it also
+// checks that every resource has a UUID that can be used for that tenant.
+func Validate(ctx context.Context, manifestPath string, fqtn string) error {
+	mfest, err := readManifest(ctx, manifestPath)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+
+	errs := mfest.ValidateEntries()
+	errs = append(errs, tfconfig.ValidateFunctionCalls(&tfconfig.GenerationContext{
+		ManifestFilePath: manifestPath,
+		Manifest:         &mfest,
+		FQTN:             fqtn,
+		LiveResources:    &[]liveresource.Resource{},
+	})...)
+	if fqtn != "" && len(errs) == 0 {
+		if err := mfest.Validate(fqtn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, err := range errs {
+		uclog.Errorf(ctx, "%s: %v", manifestPath, err)
+	}
+	if len(errs) > 0 {
+		return ucerr.Friendlyf(nil, "Found %d problem(s) in manifest %s", len(errs), manifestPath)
+	}
+	uclog.Infof(ctx, "Manifest %s is valid (%d resources)", manifestPath, len(mfest.Resources))
+	return nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// writeBackResourceUUIDs records the tenant's resource UUIDs in the manifest
+// file (and any files it includes), so that later applies match resources by
+// UUID instead of by name or __DEFAULT UUID. Only the resource_uuids maps in
+// the files are changed.
+func writeBackResourceUUIDs(ctx context.Context, manifestPath string, mfest *manifest.Manifest, fqtn string) error {
+	tenantUUIDs := mfest.TenantResourceUUIDs(fqtn)
+	// Group the UUIDs by the file that each resource came from
+	var files []string
+	uuidsByFile := map[string]map[string]string{}
+	for _, r := range mfest.Resources {
+		file := r.SourceFile
+		if file == "" {
+			file = manifestPath
+		}
+		if _, ok := uuidsByFile[file]; !ok {
+			files = append(files, file)
+			uuidsByFile[file] = map[string]string{}
+		}
+		if id := tenantUUIDs[r.ManifestID]; id != "" {
+			uuidsByFile[file][r.ManifestID] = id
+		}
+	}
+
+	total := 0
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to read manifest file %s for write-back", file)
+		}
+		updated, changed, err := manifest.UpdateResourceUUIDs(text, filepath.Ext(file), fqtn, uuidsByFile[file])
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to update resource UUIDs in manifest file %s", file)
+		}
+		if changed == 0 {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return ucerr.Friendlyf(err, "Failed to stat manifest file %s for write-back", file)
+		}
+		if err := os.WriteFile(file, updated, info.Mode().Perm()); err != nil {
+			return ucerr.Friendlyf(err, "Failed to write manifest file %s", file)
+		}
+		uclog.Infof(ctx, "Wrote %s resource UUIDs for %d resources back into manifest file %s", fqtn, changed, file)
+		total += changed
+	}
+	if total == 0 {
+		uclog.Infof(ctx, "Manifest already has resource UUIDs for %s, not rewriting it", fqtn)
+	}
+	return nil
+}
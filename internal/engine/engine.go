@@ -0,0 +1,233 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/gofrs/uuid"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/cmd/ucconfig/internal/resourcetypes"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/idp"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// The native engine applies a manifest by calling the UC API directly, rather
+// than generating Terraform configuration and state and shelling out to
+// Terraform. It uses the same plan that `ucconfig plan` prints.
+
+// Step is a single create, update, or delete operation
+type Step struct {
+	Change plan.ResourceChange
+	// Data holds the full desired attributes for creates and updates, and the
+	// live attributes for deletes
+	Data resourcetypes.ResourceData
+	// references holds the UUIDs of other resources referenced by Data
+	references []string
+}
+
+// collectReferences walks an attribute value and returns the UUIDs found at
+// attribute paths that the resource type declares as references
+func collectReferences(val any, attrPath string, resourceType *resourcetypes.ResourceType) []string {
+	if val == nil {
+		return nil
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return collectReferences(v.Elem().Interface(), attrPath, resourceType)
+	case reflect.Array, reflect.Slice:
+		var out []string
+		for i := 0; i < v.Len(); i++ {
+			out = append(out, collectReferences(v.Index(i).Interface(), attrPath, resourceType)...)
+		}
+		return out
+	case reflect.Map:
+		var out []string
+		for _, key := range v.MapKeys() {
+			path := key.String()
+			if attrPath != "" {
+				path = attrPath + "." + key.String()
+			}
+			out = append(out, collectReferences(v.MapIndex(key).Interface(), path, resourceType)...)
+		}
+		return out
+	case reflect.String:
+		if resourceType.References[attrPath] != "" {
+			return []string{v.String()}
+		}
+	}
+	return nil
+}
+
+// sortByReferences orders steps so that every step comes after the steps for
+// the resources it references. If reverse is true, every step instead comes
+// before the steps for the resources it references (which is the order that
+// deletes need). Steps that don't depend on each other keep their relative
+// order, so the output is deterministic.
+func sortByReferences(steps []Step, reverse bool) ([]Step, error) {
+	indexByUUID := map[string]int{}
+	for i, s := range steps {
+		indexByUUID[s.Data.ID.String()] = i
+	}
+	// dependents[i] lists the steps that must run after step i
+	dependents := make([][]int, len(steps))
+	inDegree := make([]int, len(steps))
+	for i, s := range steps {
+		seen := map[int]bool{}
+		for _, ref := range s.references {
+			j, ok := indexByUUID[ref]
+			if !ok || j == i || seen[j] {
+				continue
+			}
+			seen[j] = true
+			if reverse {
+				dependents[i] = append(dependents[i], j)
+				inDegree[j]++
+			} else {
+				dependents[j] = append(dependents[j], i)
+				inDegree[i]++
+			}
+		}
+	}
+
+	out := make([]Step, 0, len(steps))
+	done := make([]bool, len(steps))
+	for len(out) < len(steps) {
+		progressed := false
+		for i := range steps {
+			if done[i] || inDegree[i] > 0 {
+				continue
+			}
+			done[i] = true
+			progressed = true
+			out = append(out, steps[i])
+			for _, j := range dependents[i] {
+				inDegree[j]--
+			}
+			// Restart from the beginning so that earlier steps unblocked by
+			// this one keep their place
+			break
+		}
+		if !progressed {
+			return nil, ucerr.Errorf("could not determine an order for applying changes: resources have circular references")
+		}
+	}
+	return out, nil
+}
+
+// Order returns the steps needed to carry out a plan, in the order they should
+// be run: creates first (so that updates can reference new resources), then
+// updates (so that references to resources being deleted are removed), then
+// deletes. Within each group, steps are ordered by the references between
+// resources. Plans that replace resources are rejected, since a replaced
+// resource would have to be deleted (along with everything that references
+// it) before it can be created again.
+func Order(p *plan.Plan, ctx *tfconfig.GenerationContext) ([]Step, error) {
+	manifestIndexes := map[string]int{}
+	for i, r := range ctx.Manifest.Resources {
+		manifestIndexes[r.ManifestID] = i
+	}
+	liveByUUID := map[string]*liveresource.Resource{}
+	for i, r := range *ctx.LiveResources {
+		liveByUUID[r.ResourceUUID] = &(*ctx.LiveResources)[i]
+	}
+
+	var creates, updates, deletes []Step
+	for _, change := range p.Changes {
+		resourceType := resourcetypes.GetByTerraformTypeSuffix(change.TerraformTypeSuffix)
+		if resourceType == nil {
+			return nil, ucerr.Errorf("unknown resource type %s", change.TerraformTypeSuffix)
+		}
+		if change.Action == plan.ActionReplace {
+			return nil, ucerr.Errorf("the native engine can't replace %s resource %s (id %s); apply this change with --engine=terraform", change.TerraformTypeSuffix, change.ManifestID, change.ResourceUUID)
+		}
+		id, err := uuid.FromString(change.ResourceUUID)
+		if err != nil {
+			return nil, ucerr.Errorf("invalid UUID for %s resource: %v", change.TerraformTypeSuffix, err)
+		}
+		step := Step{Change: change, Data: resourcetypes.ResourceData{ID: id}}
+
+		if change.Action == plan.ActionDelete {
+			live := liveByUUID[change.ResourceUUID]
+			if live == nil {
+				return nil, ucerr.Errorf("could not find live %s resource %s", change.TerraformTypeSuffix, change.ResourceUUID)
+			}
+			step.Data.Version = live.Version
+			step.Data.Attributes = live.Attributes
+			step.references = collectReferences(live.Attributes, "", resourceType)
+			deletes = append(deletes, step)
+			continue
+		}
+
+		i, ok := manifestIndexes[change.ManifestID]
+		if !ok {
+			return nil, ucerr.Errorf("could not find manifest entry %s", change.ManifestID)
+		}
+		resource := &ctx.Manifest.Resources[i]
+		resolved, err := tfconfig.ResolveValue(resource.Attributes, ctx.ForResource(resource))
+		if err != nil {
+			return nil, ucerr.Errorf("Manifest ID %s: %v", change.ManifestID, err)
+		}
+		attributes, _ := resolved.(map[string]any)
+		step.Data.Attributes = attributes
+		step.references = collectReferences(attributes, "", resourceType)
+		if change.Action == plan.ActionCreate {
+			creates = append(creates, step)
+		} else {
+			if live := liveByUUID[change.ResourceUUID]; live != nil {
+				step.Data.Version = live.Version
+			}
+			updates = append(updates, step)
+		}
+	}
+
+	var out []Step
+	for _, group := range []struct {
+		steps   []Step
+		reverse bool
+	}{{creates, false}, {updates, false}, {deletes, true}} {
+		sorted, err := sortByReferences(group.steps, group.reverse)
+		if err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+		out = append(out, sorted...)
+	}
+	return out, nil
+}
+
+// Run performs the steps in order using the UC API, stopping at the first
+// failure. It returns the number of steps that completed successfully.
+func Run(ctx context.Context, client *idp.Client, steps []Step) (int, error) {
+	for i, step := range steps {
+		resourceType := resourcetypes.GetByTerraformTypeSuffix(step.Change.TerraformTypeSuffix)
+		var fn func(context.Context, *idp.Client, resourcetypes.ResourceData) error
+		switch step.Change.Action {
+		case plan.ActionCreate:
+			fn = resourceType.CreateResource
+		case plan.ActionUpdate:
+			fn = resourceType.UpdateResource
+		case plan.ActionDelete:
+			fn = resourceType.DeleteResource
+		}
+		if fn == nil {
+			return i, ucerr.Errorf("the native engine does not support %s operations on %s resources", step.Change.Action, step.Change.TerraformTypeSuffix)
+		}
+
+		label := step.Change.ManifestID
+		if label == "" {
+			label = step.Change.ResourceUUID
+		}
+		uclog.Infof(ctx, "[%d/%d] %s %s %s...", i+1, len(steps), step.Change.Action, step.Change.TerraformTypeSuffix, label)
+		if err := fn(ctx, client, step.Data); err != nil {
+			return i, ucerr.Errorf("failed to %s %s resource %s (id %s): %v", step.Change.Action, step.Change.TerraformTypeSuffix, label, step.Change.ResourceUUID, err)
+		}
+	}
+	return len(steps), nil
+}
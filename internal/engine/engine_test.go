@@ -0,0 +1,101 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/plan"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/infra/assert"
+)
+
+func TestOrder(t *testing.T) {
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{
+			// Listed before the column it references, but must be created after
+			{
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "accessor",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "633fac47-c6c1-4459-93e0-0bb4043e60a0"},
+				Attributes: map[string]any{
+					"name":    "acc",
+					"columns": []any{map[string]any{"column": `@UC_MANIFEST_ID("col").id`}},
+				},
+			},
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "col",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "col"},
+			},
+		},
+	}
+	live := []liveresource.Resource{
+		// Old column and an accessor that references it, both to be deleted.
+		// The accessor must be deleted first.
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "c860a6d7-c632-4f81-8f5f-597290a9f437",
+			Attributes:          map[string]any{"name": "oldcol"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_accessor",
+			ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+			Version:             3,
+			Attributes: map[string]any{
+				"name":    "oldacc",
+				"columns": []any{map[string]any{"column": "c860a6d7-c632-4f81-8f5f-597290a9f437"}},
+			},
+		},
+	}
+	ctx := &tfconfig.GenerationContext{Manifest: &mfest, FQTN: "prod", LiveResources: &live}
+	p, err := plan.Compute(ctx)
+	assert.NoErr(t, err)
+
+	steps, err := Order(p, ctx)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(steps), 4)
+	assert.Equal(t, steps[0].Change.Action, plan.ActionCreate)
+	assert.Equal(t, steps[0].Change.ManifestID, "col")
+	assert.Equal(t, steps[1].Change.Action, plan.ActionCreate)
+	assert.Equal(t, steps[1].Change.ManifestID, "accessor")
+	// References should be resolved to UUIDs for the API call
+	assert.Equal(t, steps[1].Data.Attributes["columns"], []any{map[string]any{"column": "fe20fd48-a006-4ad8-9208-4aad540d8794"}})
+	assert.Equal(t, steps[2].Change.Action, plan.ActionDelete)
+	assert.Equal(t, steps[2].Change.ResourceUUID, "dc42da22-4c49-459d-9572-3b5db6d61959")
+	assert.Equal(t, steps[2].Data.Version, 3)
+	assert.Equal(t, steps[3].Change.Action, plan.ActionDelete)
+	assert.Equal(t, steps[3].Change.ResourceUUID, "c860a6d7-c632-4f81-8f5f-597290a9f437")
+}
+
+func TestOrderRejectsReplacements(t *testing.T) {
+	p := &plan.Plan{FQTN: "prod", Changes: []plan.ResourceChange{{
+		Action:              plan.ActionReplace,
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "col",
+		ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+	}}}
+	_, err := Order(p, &tfconfig.GenerationContext{Manifest: &manifest.Manifest{}, FQTN: "prod", LiveResources: &[]liveresource.Resource{}})
+	assert.NotNil(t, err)
+}
+
+func TestSortByReferencesCycle(t *testing.T) {
+	steps := []Step{
+		{Change: plan.ResourceChange{ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"}, references: []string{"c860a6d7-c632-4f81-8f5f-597290a9f437"}},
+		{Change: plan.ResourceChange{ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"}, references: []string{"fe20fd48-a006-4ad8-9208-4aad540d8794"}},
+	}
+	for i := range steps {
+		steps[i].Data.ID = mustUUID(t, steps[i].Change.ResourceUUID)
+	}
+	_, err := sortByReferences(steps, false)
+	assert.NotNil(t, err)
+}
+
+func mustUUID(t *testing.T, s string) uuid.UUID {
+	id, err := uuid.FromString(s)
+	assert.NoErr(t, err)
+	return id
+}
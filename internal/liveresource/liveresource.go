@@ -22,7 +22,11 @@ type Resource struct {
 	ManifestID          string
 	ResourceUUID        string
 	IsSystem            bool
-	Attributes          map[string]any
+	// Version is the current version of versioned resources (e.g. accessors).
+	// It is not part of Attributes, since it can't be set through the
+	// manifest, but updates through the UC API need to send it back.
+	Version    int
+	Attributes map[string]any
 }
 
 // TerraformResourceName returns the name that should be used for this resource
@@ -131,6 +135,7 @@ func MakeLiveResource(ctx context.Context, resourceType resourcetypes.ResourceTy
 	v := reflect.ValueOf(resource)
 	resourceID := v.FieldByName("ID").Interface().(uuid.UUID)
 	isSystem := false
+	version := 0
 	for i := 0; i < v.NumField(); i++ {
 		jsonKey := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
 		// We have a small handful of model that are used both for the database
@@ -157,6 +162,9 @@ func MakeLiveResource(ctx context.Context, resourceType resourcetypes.ResourceTy
 		// for versioned resources, and the Terraform provider won't allow it to
 		// be set
 		if jsonKey == "version" {
+			if v.Field(i).CanInt() {
+				version = int(v.Field(i).Int())
+			}
 			continue
 		}
 		if slices.Contains(resourceType.OmitAttributes, jsonKey) {
@@ -185,10 +193,46 @@ func MakeLiveResource(ctx context.Context, resourceType resourcetypes.ResourceTy
 		TerraformTypeSuffix: resourceType.TerraformTypeSuffix,
 		ResourceUUID:        resourceID.String(),
 		IsSystem:            isSystem,
+		Version:             version,
 		Attributes:          attributes,
 	}, nil
 }
 
+// omitFromValue removes the given keys from maps at any level of nesting in a
+// value decoded from a manifest, mirroring what transformValue does for structs.
+func omitFromValue(val any, omitAttributes []string) any {
+	switch v := val.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for key, item := range v {
+			if slices.Contains(omitAttributes, key) {
+				continue
+			}
+			out[key] = omitFromValue(item, omitAttributes)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = omitFromValue(item, omitAttributes)
+		}
+		return out
+	}
+	return val
+}
+
+// OmitManifestAttributes returns a copy of a manifest resource's attributes
+// without the attributes that MakeLiveResource leaves out of live resources
+// (the version and is_system fields, and the resource type's OmitAttributes),
+// so that the result can be compared against a live resource without reporting
+// differences in attributes that are never fetched.
+func OmitManifestAttributes(resourceType resourcetypes.ResourceType, attributes map[string]any) map[string]any {
+	out, _ := omitFromValue(attributes, resourceType.OmitAttributes).(map[string]any)
+	delete(out, "version")
+	delete(out, "is_system")
+	return out
+}
+
 func validateResourceType(resourceType resourcetypes.ResourceType, liveResources *[]any) error {
 	// Validate that the resource model type has an ID field. Currently ucconfig doesn't support
 	// resources without an ID (or with an ID that goes by a different name in the struct).
@@ -232,14 +276,22 @@ func GetLiveResourcesForType(ctx context.Context, client *idp.Client, resourceTy
 }
 
 // GetLiveResources fetches all live resources from the UC API and returns a list of LiveResource
-// structs.
+// structs. Resource types are fetched concurrently (see resourcetypes.WithConcurrency), but the
+// result is always in the order of resourcetypes.ResourceTypes.
 func GetLiveResources(ctx context.Context, client *idp.Client) ([]Resource, error) {
-	var out []Resource
-	for _, resourceType := range resourcetypes.ResourceTypes {
-		liveResources, err := GetLiveResourcesForType(ctx, client, resourceType)
+	byType := make([][]Resource, len(resourcetypes.ResourceTypes))
+	if err := resourcetypes.RunConcurrently(ctx, len(resourcetypes.ResourceTypes), func(ctx context.Context, i int) error {
+		liveResources, err := GetLiveResourcesForType(ctx, client, resourcetypes.ResourceTypes[i])
 		if err != nil {
-			return nil, ucerr.Wrap(err)
+			return ucerr.Wrap(err)
 		}
+		byType[i] = liveResources
+		return nil
+	}); err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	var out []Resource
+	for _, liveResources := range byType {
 		out = append(out, liveResources...)
 	}
 	return out, nil
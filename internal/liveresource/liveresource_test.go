@@ -77,4 +77,25 @@ func TestVersionAttributeOmitted(t *testing.T) {
 	assert.NoErr(t, err)
 	assert.Equal(t, res.Attributes["name"], "TestAccessor")
 	assert.Equal(t, res.Attributes["version"], nil)
+	assert.Equal(t, res.Version, 7)
+}
+
+func TestOmitManifestAttributes(t *testing.T) {
+	attributes := map[string]any{
+		"name":            "phone",
+		"camel_case_name": "Phone",
+		"version":         3,
+		"composite_attributes": map[string]any{
+			"fields": []any{map[string]any{"name": "number", "camel_case_name": "Number"}},
+		},
+	}
+	out := OmitManifestAttributes(*resourcetypes.GetByTerraformTypeSuffix("userstore_column_data_type"), attributes)
+	assert.Equal(t, out, map[string]any{
+		"name": "phone",
+		"composite_attributes": map[string]any{
+			"fields": []any{map[string]any{"name": "number"}},
+		},
+	})
+	// The input is left unchanged
+	assert.Equal(t, attributes["camel_case_name"], "Phone")
 }
@@ -35,7 +35,7 @@ func TestGenerateNewManifest(t *testing.T) {
 			},
 		},
 	}
-	mfest, err := generateFromLiveResources(ctx, &resources, "prod", nil)
+	mfest, err := GenerateFromLiveResources(ctx, &resources, "prod", nil, nil)
 	assert.NoErr(t, err)
 	mfestJSON, err := json.MarshalIndent(mfest, "", "\t")
 	assert.NoErr(t, err)
@@ -163,3 +163,29 @@ func TestRewriteWithFunctionCallsForFiles(t *testing.T) {
 	// Should have trailing newline (like most editors insert)
 	assert.Equal(t, string(contents), "hello world\n")
 }
+
+func TestGenerateFromLiveResourcesUniqueManifestIDs(t *testing.T) {
+	ctx := context.Background()
+	resources := []liveresource.Resource{
+		// Matched to a manifest entry that was created as "email" and later
+		// renamed
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "userstore_column_email",
+			ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+			Attributes:          map[string]any{"name": "primary_email"},
+		},
+		// A new column that took the old name
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "c860a6d7-c632-4f81-8f5f-597290a9f437",
+			Attributes:          map[string]any{"name": "email"},
+		},
+	}
+	mfest, err := GenerateFromLiveResources(ctx, &resources, "prod", nil, nil)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(mfest.Resources), 2)
+	assert.Equal(t, mfest.Resources[0].ManifestID, "userstore_column_email")
+	assert.Equal(t, mfest.Resources[1].ManifestID, "userstore_column_email_c860a6d7-c632-4f81-8f5f-597290a9f437")
+	assert.Equal(t, len(mfest.ValidateEntries()), 0)
+}
@@ -0,0 +1,116 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// decodeFile reads and decodes a single JSON or YAML manifest file, without
+// processing its includes
+func decodeFile(path string) (Manifest, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, ucerr.Errorf("error reading %s: %v", path, err)
+	}
+	mfest := Manifest{}
+	switch filepath.Ext(path) {
+	case ".json":
+		if err := json.Unmarshal(text, &mfest); err != nil {
+			return Manifest{}, ucerr.Errorf("error decoding JSON in %s: %v", path, err)
+		}
+	case ".yaml":
+		if err := yaml.Unmarshal(text, &mfest); err != nil {
+			return Manifest{}, ucerr.Errorf("error decoding YAML in %s: %v", path, err)
+		}
+	default:
+		return Manifest{}, ucerr.Errorf("manifest path %s must have .json or .yaml extension", path)
+	}
+	return mfest, nil
+}
+
+// Load reads a manifest file along with any files it includes. Include
+// patterns are globs resolved relative to the directory of the file containing
+// them (like @FILE paths), and included files may include further files. The
+// resources from included files are appended after the resources of the
+// including file, in the order the patterns are listed (and in lexical order
+// for files matching the same pattern). A file that has already been loaded is
+// skipped if it is matched again, so e.g. an `*.yaml` pattern may match the
+// including file itself. Each resource's SourceFile and SourceIndex are set so
+// that errors can point at the file the resource came from. Variables from all
+// of the files are merged too, and a variable may only be declared once. Only
+// the top-level file may set a scope. Includes is left empty on the returned
+// manifest, since they have already been merged.
+func Load(path string) (Manifest, error) {
+	root := Manifest{}
+	loaded := map[string]bool{}
+	if err := loadInto(&root, path, loaded, true); err != nil {
+		return Manifest{}, ucerr.Wrap(err)
+	}
+	return root, nil
+}
+
+func loadInto(out *Manifest, path string, loaded map[string]bool, isRoot bool) error {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return ucerr.Errorf("error getting absolute path for %s: %v", path, err)
+	}
+	loaded[absPath] = true
+
+	mfest, err := decodeFile(path)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	if isRoot {
+		out.Scope = mfest.Scope
+	} else if mfest.Scope != nil {
+		return ucerr.Errorf("%s sets scope, but scope may only be set in the top-level manifest", path)
+	}
+	for name, values := range mfest.Variables {
+		if existing, ok := out.VariableSources[name]; ok {
+			return ucerr.Errorf("variable %s is declared in both %s and %s", name, existing, path)
+		}
+		if out.Variables == nil {
+			out.Variables = map[string]map[string]any{}
+			out.VariableSources = map[string]string{}
+		}
+		out.Variables[name] = values
+		out.VariableSources[name] = path
+	}
+	for i := range mfest.Resources {
+		mfest.Resources[i].SourceFile = path
+		mfest.Resources[i].SourceIndex = i
+	}
+	out.Resources = append(out.Resources, mfest.Resources...)
+
+	for _, pattern := range mfest.Includes {
+		fullPattern := pattern
+		if !filepath.IsAbs(pattern) {
+			fullPattern = filepath.Join(filepath.Dir(path), pattern)
+		}
+		matches, err := filepath.Glob(fullPattern)
+		if err != nil {
+			return ucerr.Errorf("invalid include pattern \"%s\" in %s: %v", pattern, path, err)
+		}
+		if len(matches) == 0 {
+			return ucerr.Errorf("include pattern \"%s\" in %s did not match any files", pattern, path)
+		}
+		for _, match := range matches {
+			absMatch, err := filepath.Abs(match)
+			if err != nil {
+				return ucerr.Errorf("error getting absolute path for %s: %v", match, err)
+			}
+			if loaded[absMatch] {
+				continue
+			}
+			if err := loadInto(out, match, loaded, false); err != nil {
+				return ucerr.Wrap(err)
+			}
+		}
+	}
+	return nil
+}
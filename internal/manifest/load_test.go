@@ -0,0 +1,146 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"userclouds.com/infra/assert"
+)
+
+func writeTestFile(t *testing.T, path string, contents string) {
+	assert.NoErr(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoErr(t, os.WriteFile(path, []byte(contents), 0644))
+}
+
+func TestLoadWithIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "manifest.yaml"), `
+includes:
+    - columns/*.yaml
+    - policies.json
+resources:
+    - uc_terraform_type: userstore_accessor
+      manifest_id: accessor
+      resource_uuids:
+        __DEFAULT: 633fac47-c6c1-4459-93e0-0bb4043e60a0
+      attributes:
+        name: acc
+`)
+	writeTestFile(t, filepath.Join(dir, "columns", "b.yaml"), `
+resources:
+    - uc_terraform_type: userstore_column
+      manifest_id: col_b
+      resource_uuids:
+        __DEFAULT: c860a6d7-c632-4f81-8f5f-597290a9f437
+      attributes:
+        name: b
+`)
+	writeTestFile(t, filepath.Join(dir, "columns", "a.yaml"), `
+resources:
+    - uc_terraform_type: userstore_column
+      manifest_id: col_a
+      resource_uuids:
+        __DEFAULT: fe20fd48-a006-4ad8-9208-4aad540d8794
+      attributes:
+        name: a
+`)
+	writeTestFile(t, filepath.Join(dir, "policies.json"), `{
+	"includes": ["manifest.yaml"],
+	"resources": [
+		{
+			"uc_terraform_type": "userstore_purpose",
+			"manifest_id": "purpose",
+			"resource_uuids": {"__DEFAULT": "12b3f133-4ad1-4f11-9d7d-313eb7cb95fa"},
+			"attributes": {"name": "marketing"}
+		}
+	]
+}`)
+
+	mfest, err := Load(filepath.Join(dir, "manifest.yaml"))
+	assert.NoErr(t, err)
+	var ids []string
+	for _, r := range mfest.Resources {
+		ids = append(ids, r.ManifestID)
+	}
+	assert.Equal(t, ids, []string{"accessor", "col_a", "col_b", "purpose"})
+	assert.Equal(t, mfest.Resources[1].SourceFile, filepath.Join(dir, "columns", "a.yaml"))
+	assert.Equal(t, mfest.Resources[1].SourceIndex, 0)
+	assert.Equal(t, len(mfest.ValidateEntries()), 0)
+}
+
+func TestLoadDuplicateAcrossFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "manifest.yaml"), `
+includes: [more.yaml]
+resources:
+    - uc_terraform_type: userstore_column
+      manifest_id: email
+      resource_uuids:
+        __DEFAULT: fe20fd48-a006-4ad8-9208-4aad540d8794
+      attributes:
+        name: email
+`)
+	writeTestFile(t, filepath.Join(dir, "more.yaml"), `
+resources:
+    - uc_terraform_type: userstore_column
+      manifest_id: email
+      resource_uuids:
+        __DEFAULT: c860a6d7-c632-4f81-8f5f-597290a9f437
+      attributes:
+        name: email2
+`)
+	mfest, err := Load(filepath.Join(dir, "manifest.yaml"))
+	assert.NoErr(t, err)
+	errs := mfest.ValidateEntries()
+	assert.Equal(t, len(errs), 1)
+	assert.True(t, strings.Contains(errs[0].Error(), "resource at index 0 in "+filepath.Join(dir, "more.yaml")))
+	assert.True(t, strings.Contains(errs[0].Error(), "already used by the resource at index 0 in "+filepath.Join(dir, "manifest.yaml")))
+}
+
+func TestLoadIncludeMatchesNothing(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "manifest.yaml"), "includes: [missing/*.yaml]\nresources: []\n")
+	_, err := Load(filepath.Join(dir, "manifest.yaml"))
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "did not match any files"))
+}
+
+func TestLoadVariables(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "manifest.yaml"), `
+includes: [more.yaml]
+variables:
+    threshold:
+        __DEFAULT: 5
+        mycompany-prod: 50
+resources: []
+`)
+	writeTestFile(t, filepath.Join(dir, "more.yaml"), `
+variables:
+    where:
+        __DEFAULT: "{email} = ?"
+resources: []
+`)
+	mfest, err := Load(filepath.Join(dir, "manifest.yaml"))
+	assert.NoErr(t, err)
+	val, err := mfest.VariableValue("threshold", "mycompany-prod")
+	assert.NoErr(t, err)
+	assert.Equal(t, val, 50)
+	val, err = mfest.VariableValue("where", "mycompany-prod")
+	assert.NoErr(t, err)
+	assert.Equal(t, val, "{email} = ?")
+	assert.Equal(t, mfest.VariableSources["where"], filepath.Join(dir, "more.yaml"))
+
+	// Declaring the same variable in two files is an error
+	writeTestFile(t, filepath.Join(dir, "more.yaml"), `
+variables:
+    threshold:
+        __DEFAULT: 10
+resources: []
+`)
+	_, err = Load(filepath.Join(dir, "manifest.yaml"))
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "variable threshold is declared in both"))
+}
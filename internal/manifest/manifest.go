@@ -3,10 +3,16 @@ package manifest
 import (
 	"context"
 	"fmt"
+	"maps"
 	"os"
+	"path"
 	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/gofrs/uuid"
+
 	"userclouds.com/cmd/ucconfig/internal/liveresource"
 	"userclouds.com/cmd/ucconfig/internal/resourcetypes"
 	"userclouds.com/idp"
@@ -16,9 +22,39 @@ import (
 
 // Manifest is the top-level object storing a parsed ucconfig manifest file
 type Manifest struct {
+	// Globs (relative to the manifest file) of other manifest files whose
+	// resources should be merged into this manifest. See Load.
+	Includes []string `json:"includes,omitempty" yaml:"includes,omitempty"`
+	// A map of variable name to a map of fully-qualified-tenant-name to the
+	// variable's value in that tenant. Like ResourceUUIDs, the key "__DEFAULT"
+	// sets the value for tenants that aren't listed. Variables are used in
+	// attributes with `@VAR("name")`.
+	Variables map[string]map[string]any `json:"variables,omitempty" yaml:"variables,omitempty"`
+	// The manifest file that each variable was declared in. This is set by
+	// Load.
+	VariableSources map[string]string `json:"-" yaml:"-"`
+	// Optionally limits which live resources this manifest manages. See
+	// Scope.
+	Scope     *Scope     `json:"scope,omitempty" yaml:"scope,omitempty"`
 	Resources []Resource `json:"resources" yaml:"resources"`
 }
 
+// VariableValue returns the value of a variable in the given tenant, falling
+// back to the variable's __DEFAULT value.
+func (mfest *Manifest) VariableValue(name string, fqtn string) (any, error) {
+	values, ok := mfest.Variables[name]
+	if !ok {
+		return nil, ucerr.Errorf("variable %s is not defined in the manifest", name)
+	}
+	if val, ok := values[fqtn]; ok {
+		return val, nil
+	}
+	if val, ok := values["__DEFAULT"]; ok {
+		return val, nil
+	}
+	return nil, ucerr.Errorf("variable %s has no value for tenant \"%s\" and no __DEFAULT value", name, fqtn)
+}
+
 // Resource stores the config for a single instantiation of a Terraform resource
 type Resource struct {
 	// Terraform resource type suffix, e.g. "userstore_column"
@@ -33,6 +69,54 @@ type Resource struct {
 	ResourceUUIDs map[string]string `json:"resource_uuids" yaml:"resource_uuids"`
 	// A map of attributes to set on the Terraform resource.
 	Attributes map[string]any `json:"attributes" yaml:"attributes"`
+	// Optional lists of fully-qualified tenant names (or path.Match globs, e.g.
+	// "mycompany-dev*") limiting which tenants the resource exists in. At most
+	// one of these may be set. In tenants that the resource is excluded from,
+	// the manifest behaves as if the resource weren't in it.
+	OnlyTenants   []string `json:"only_tenants,omitempty" yaml:"only_tenants,omitempty"`
+	ExceptTenants []string `json:"except_tenants,omitempty" yaml:"except_tenants,omitempty"`
+	// Optional Terraform lifecycle settings for the resource
+	Lifecycle *Lifecycle `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty"`
+	// The manifest file this resource was loaded from, and its index within
+	// that file's resources. These are set by Load, and are blank for manifests
+	// that were decoded directly.
+	SourceFile  string `json:"-" yaml:"-"`
+	SourceIndex int    `json:"-" yaml:"-"`
+}
+
+// Lifecycle stores the Terraform lifecycle meta-arguments that can be set on a
+// manifest entry
+type Lifecycle struct {
+	// PreventDestroy makes Terraform refuse to apply any plan that would destroy
+	// the resource (e.g. replacing a column, which deletes its data)
+	PreventDestroy bool `json:"prevent_destroy,omitempty" yaml:"prevent_destroy,omitempty"`
+}
+
+func matchesAnyTenant(patterns []string, fqtn string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, fqtn); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesToTenant returns false if the resource's only_tenants or
+// except_tenants exclude it from the given tenant.
+func (r *Resource) AppliesToTenant(fqtn string) bool {
+	if len(r.OnlyTenants) > 0 && !matchesAnyTenant(r.OnlyTenants, fqtn) {
+		return false
+	}
+	return !matchesAnyTenant(r.ExceptTenants, fqtn)
+}
+
+// Location describes where the resource at index i of a manifest is defined,
+// for use in error messages
+func (r *Resource) Location(i int) string {
+	if r.SourceFile == "" {
+		return fmt.Sprintf("resource at index %v", i)
+	}
+	return fmt.Sprintf("resource at index %v in %s", r.SourceIndex, r.SourceFile)
 }
 
 func fromLiveResource(live *liveresource.Resource, fqtn string) Resource {
@@ -53,7 +137,9 @@ func fromLiveResource(live *liveresource.Resource, fqtn string) Resource {
 			"__DEFAULT": live.ResourceUUID,
 			fqtn:        live.ResourceUUID,
 		},
-		Attributes: live.Attributes,
+		// Copy the attributes, since they get rewritten with function calls and
+		// the live resource may still be used afterwards
+		Attributes: maps.Clone(live.Attributes),
 	}
 }
 
@@ -112,6 +198,11 @@ func rewriteManifestAttribute(data any, currAttrPath string, forResource *Resour
 				return `@UC_SYSTEM_OBJECT("` + r.TerraformTypeSuffix + `", "` + r.Attributes["name"].(string) + `")`, nil
 			}
 		}
+		// When generating a manifest for only part of a tenant, the reference
+		// may be to a resource outside of the scope, so keep the UUID as-is
+		if ctx.Manifest.Scope != nil {
+			return ref, nil
+		}
 		return nil, ucerr.Errorf("this should be a reference to a %s resource, but the live resource state we fetched doesn't contain such a resource with UUID %s", forResource.getResourceType().References[currAttrPath], ref)
 	}
 
@@ -166,12 +257,39 @@ func rewriteManifestAttribute(data any, currAttrPath string, forResource *Resour
 	return data, nil
 }
 
+// MatchWarningKind identifies the kind of a MatchWarning
+type MatchWarningKind string
+
+// Kinds of MatchWarning
+const (
+	// MatchWarningMatchedByName is used when a live resource was matched to a
+	// manifest entry by name rather than by UUID
+	MatchWarningMatchedByName MatchWarningKind = "matched_by_name"
+	// MatchWarningUnmatchedLiveResource is used when a live resource could not
+	// be matched to any manifest entry, and will be deleted if the manifest is
+	// applied
+	MatchWarningUnmatchedLiveResource MatchWarningKind = "unmatched_live_resource"
+)
+
+// MatchWarning describes something noteworthy that happened while matching
+// live resources to manifest entries. Warnings are also logged as they happen;
+// they are returned so that callers can include them in structured output.
+type MatchWarning struct {
+	Kind                MatchWarningKind `json:"kind" yaml:"kind"`
+	TerraformTypeSuffix string           `json:"uc_terraform_type" yaml:"uc_terraform_type"`
+	ResourceUUID        string           `json:"resource_uuid" yaml:"resource_uuid"`
+	ManifestID          string           `json:"manifest_id,omitempty" yaml:"manifest_id,omitempty"`
+	Message             string           `json:"message" yaml:"message"`
+}
+
 // MatchLiveResources compares live resources to resources declared in the manifest, setting the
 // correct ManifestID on matched live resources. For resources that could not be matched to the
 // manifest, the ManifestID is left blank. If a manifest entry ends up matching a resource by name
 // (but not by UUID), the manifest entry ResourceUUIDs will also be updated to include the resource
-// ID.
-func (mfest *Manifest) MatchLiveResources(ctx context.Context, liveResources *[]liveresource.Resource, fqtn string) error {
+// ID. Any warnings that come up during matching are returned, sorted by resource type and then
+// by manifest ID or resource UUID.
+func (mfest *Manifest) MatchLiveResources(ctx context.Context, liveResources *[]liveresource.Resource, fqtn string) ([]MatchWarning, error) {
+	warnings := []MatchWarning{}
 	unmatchedLiveResourceIndexes := map[string]int{}
 	for i, resource := range *liveResources {
 		// System objects should not be matched to the manifest
@@ -183,6 +301,11 @@ func (mfest *Manifest) MatchLiveResources(ctx context.Context, liveResources *[]
 
 	unmatchedManifests := map[string]*Resource{}
 	for i, manifest := range mfest.Resources {
+		// Resources excluded from this tenant should neither match live
+		// resources nor be created
+		if !manifest.AppliesToTenant(fqtn) {
+			continue
+		}
 		unmatchedManifests[manifest.ManifestID] = &mfest.Resources[i]
 	}
 
@@ -226,7 +349,15 @@ func (mfest *Manifest) MatchLiveResources(ctx context.Context, liveResources *[]
 			resourceID := (*liveResources)[resourceIndex].ResourceUUID
 			resourceName := (*liveResources)[resourceIndex].Attributes["name"].(string)
 			if manifestName == resourceName && manifest.TerraformTypeSuffix == (*liveResources)[resourceIndex].TerraformTypeSuffix {
-				uclog.Warningf(ctx, "Live resource %s (id %s) does not match a resource ID in the manifest, but the name matches the resource manifest with manifest ID %s. Assuming that these are intended to be the same resource...", resourceName, resourceID, manifestID)
+				message := fmt.Sprintf("Live resource %s (id %s) does not match a resource ID in the manifest, but the name matches the resource manifest with manifest ID %s. Assuming that these are intended to be the same resource...", resourceName, resourceID, manifestID)
+				uclog.Warningf(ctx, "%s", message)
+				warnings = append(warnings, MatchWarning{
+					Kind:                MatchWarningMatchedByName,
+					TerraformTypeSuffix: manifest.TerraformTypeSuffix,
+					ResourceUUID:        resourceID,
+					ManifestID:          manifestID,
+					Message:             message,
+				})
 				(*liveResources)[resourceIndex].ManifestID = manifestID
 				manifest.ResourceUUIDs[fqtn] = resourceID
 				delete(unmatchedManifests, manifestID)
@@ -244,10 +375,29 @@ func (mfest *Manifest) MatchLiveResources(ctx context.Context, liveResources *[]
 		} else {
 			description = resourceID
 		}
-		uclog.Warningf(ctx, "Live %s resource %s could not be matched to any resources in the manifest. This resources will be deleted if the configuration is applied.", (*liveResources)[resourceIndex].TerraformTypeSuffix, description)
+		message := fmt.Sprintf("Live %s resource %s could not be matched to any resources in the manifest. This resources will be deleted if the configuration is applied.", (*liveResources)[resourceIndex].TerraformTypeSuffix, description)
+		uclog.Warningf(ctx, "%s", message)
+		warnings = append(warnings, MatchWarning{
+			Kind:                MatchWarningUnmatchedLiveResource,
+			TerraformTypeSuffix: (*liveResources)[resourceIndex].TerraformTypeSuffix,
+			ResourceUUID:        resourceID,
+			Message:             message,
+		})
 	}
 
-	return nil
+	// The passes above iterate over maps, so sort the warnings to keep the
+	// output stable from run to run
+	sort.SliceStable(warnings, func(i, j int) bool {
+		a, b := warnings[i], warnings[j]
+		if a.TerraformTypeSuffix != b.TerraformTypeSuffix {
+			return a.TerraformTypeSuffix < b.TerraformTypeSuffix
+		}
+		if a.ManifestID != b.ManifestID {
+			return a.ManifestID < b.ManifestID
+		}
+		return a.ResourceUUID < b.ResourceUUID
+	})
+	return warnings, nil
 }
 
 // RewriteWithFunctionCalls updates the attribute values for this resource:
@@ -265,23 +415,115 @@ func (r *Resource) RewriteWithFunctionCalls(ctx *functionGenerationContext) erro
 	return nil
 }
 
-// Validate returns an error if the manifest is malformed.
-func (mfest *Manifest) Validate(fqtn string) error {
+// Manifest IDs are used in Terraform resource names (prefixed with
+// "manifestid-"), so they may only contain characters that are valid in a
+// Terraform identifier.
+var manifestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidateEntries checks each manifest entry for problems that can be detected
+// without knowing which tenant the manifest will be applied to. Unlike
+// Validate, it returns every problem found rather than stopping at the first.
+func (mfest *Manifest) ValidateEntries() []error {
+	var errs []error
+	manifestIDIndexes := map[string]int{}
 	for i, resource := range mfest.Resources {
+		location := resource.Location(i)
 		if !resourcetypes.ValidateTerraformTypeSuffix(resource.TerraformTypeSuffix) {
-			return ucerr.Errorf("error validating resource at index %v: uc_terraform_type \"%s\" is not a valid userclouds resource type suffix", i, resource.TerraformTypeSuffix)
+			errs = append(errs, ucerr.Errorf("error validating %s: uc_terraform_type \"%s\" is not a valid userclouds resource type suffix", location, resource.TerraformTypeSuffix))
 		}
 		if resource.ManifestID == "" {
-			return ucerr.Errorf("error validating resource at index %v: manifest_id is required", i)
+			errs = append(errs, ucerr.Errorf("error validating %s: manifest_id is required", location))
+		} else if !manifestIDRegexp.MatchString(resource.ManifestID) {
+			errs = append(errs, ucerr.Errorf("error validating %s: manifest_id \"%s\" is not a valid Terraform identifier (may only contain letters, digits, underscores, and hyphens)", location, resource.ManifestID))
+		} else if j, ok := manifestIDIndexes[resource.ManifestID]; ok {
+			errs = append(errs, ucerr.Errorf("error validating %s: manifest_id \"%s\" is already used by the %s", location, resource.ManifestID, mfest.Resources[j].Location(j)))
+		} else {
+			manifestIDIndexes[resource.ManifestID] = i
+		}
+		// Names set with a function invocation can't be checked without
+		// resolving them
+		if name := resourceName(resource.Attributes); !strings.HasPrefix(name, "@") && !mfest.Scope.contains(resource.TerraformTypeSuffix, "", name) {
+			if name == "" && mfest.Scope.hasNameFilter() && len(mfest.Scope.Types) == 0 {
+				errs = append(errs, ucerr.Errorf("error validating %s: %s resources have no name, so the scope's name_prefixes and name_regex leave them out of scope. List %s in the scope's types to manage them", location, resource.TerraformTypeSuffix, resource.TerraformTypeSuffix))
+			} else {
+				errs = append(errs, ucerr.Errorf("error validating %s: resource is outside of the manifest's scope, so it would not be managed after it is created", location))
+			}
+		}
+		if len(resource.OnlyTenants) > 0 && len(resource.ExceptTenants) > 0 {
+			errs = append(errs, ucerr.Errorf("error validating %s: only one of only_tenants and except_tenants may be set", location))
+		}
+		for _, pattern := range append(append([]string{}, resource.OnlyTenants...), resource.ExceptTenants...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs = append(errs, ucerr.Errorf("error validating %s: tenant pattern \"%s\" is invalid: %v", location, pattern, err))
+			}
+		}
+		var tenants []string
+		for tenant := range resource.ResourceUUIDs {
+			tenants = append(tenants, tenant)
+		}
+		sort.Strings(tenants)
+		for _, tenant := range tenants {
+			if _, err := uuid.FromString(resource.ResourceUUIDs[tenant]); err != nil {
+				errs = append(errs, ucerr.Errorf("error validating %s: resource_uuids entry for \"%s\" is not a valid UUID: \"%s\"", location, tenant, resource.ResourceUUIDs[tenant]))
+			}
+		}
+	}
+	errs = append(errs, mfest.Scope.validate()...)
+	for _, name := range mfest.variableNames() {
+		if !manifestIDRegexp.MatchString(name) {
+			errs = append(errs, ucerr.Errorf("error validating variable \"%s\": variable names may only contain letters, digits, underscores, and hyphens", name))
+		}
+		if len(mfest.Variables[name]) == 0 {
+			errs = append(errs, ucerr.Errorf("error validating variable \"%s\": variable must have a value for at least one tenant, or a __DEFAULT value", name))
+		}
+	}
+	return errs
+}
+
+func (mfest *Manifest) variableNames() []string {
+	var names []string
+	for name := range mfest.Variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate returns an error if the manifest is malformed.
+func (mfest *Manifest) Validate(fqtn string) error {
+	if errs := mfest.ValidateEntries(); len(errs) > 0 {
+		return ucerr.Wrap(errs[0])
+	}
+	for i, resource := range mfest.Resources {
+		if !resource.AppliesToTenant(fqtn) {
+			continue
 		}
 		if resource.ResourceUUIDs[fqtn] == "" && resource.ResourceUUIDs["__DEFAULT"] == "" {
-			return ucerr.Errorf("error validating resource at index %v: resource_uuids either must include a UUID for tenant \"%s\", or it must include a __DEFAULT entry.", i, fqtn)
+			return ucerr.Errorf("error validating %s: resource_uuids either must include a UUID for tenant \"%s\", or it must include a __DEFAULT entry.", resource.Location(i), fqtn)
+		}
+	}
+	for _, name := range mfest.variableNames() {
+		if _, err := mfest.VariableValue(name, fqtn); err != nil {
+			return ucerr.Errorf("error validating variable \"%s\": %v", name, err)
 		}
 	}
 	return nil
 }
 
-func generateFromLiveResources(ctx context.Context, liveResources *[]liveresource.Resource, fqtn string, externValuesDir *ExternValuesDirConfig) (Manifest, error) {
+// GenerateFromLiveResources returns a new Manifest struct describing the given
+// live resources (other than system resources). Live resources that have been
+// matched to a manifest keep their manifest IDs, and other resources get
+// unique manifest IDs derived from their names. If scope is set, the live
+// resources should already have been filtered to that scope; the generated
+// manifest gets the same scope, and references to resources that aren't in
+// liveResources are kept as UUIDs rather than being an error.
+func GenerateFromLiveResources(ctx context.Context, liveResources *[]liveresource.Resource, fqtn string, scope *Scope, externValuesDir *ExternValuesDirConfig) (Manifest, error) {
+	usedManifestIDs := map[string]bool{}
+	for _, r := range *liveResources {
+		if !r.IsSystem && r.ManifestID != "" {
+			usedManifestIDs[r.ManifestID] = true
+		}
+	}
 	var resourceManifests []Resource
 	for _, r := range *liveResources {
 		if r.IsSystem {
@@ -289,9 +531,18 @@ func generateFromLiveResources(ctx context.Context, liveResources *[]liveresourc
 			// clutter.
 			continue
 		}
-		resourceManifests = append(resourceManifests, fromLiveResource(&r, fqtn))
+		resource := fromLiveResource(&r, fqtn)
+		// Manifest IDs derived from names can collide, e.g. with the manifest
+		// ID of a matched resource that has since been renamed, so make them
+		// unique the same way MergeLiveResources does
+		if r.ManifestID == "" && usedManifestIDs[resource.ManifestID] {
+			resource.ManifestID = fmt.Sprintf("%s_%s", resource.ManifestID, r.ResourceUUID)
+		}
+		usedManifestIDs[resource.ManifestID] = true
+		resourceManifests = append(resourceManifests, resource)
 	}
 	mfest := Manifest{
+		Scope:     scope,
 		Resources: resourceManifests,
 	}
 	for i := range mfest.Resources {
@@ -318,5 +569,5 @@ func GenerateNewManifest(ctx context.Context, client *idp.Client, fqtn string, e
 	if err != nil {
 		return Manifest{}, ucerr.Wrap(err)
 	}
-	return generateFromLiveResources(ctx, &liveResources, fqtn, externValuesDir)
+	return GenerateFromLiveResources(ctx, &liveResources, fqtn, nil, externValuesDir)
 }
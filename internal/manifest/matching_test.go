@@ -53,9 +53,10 @@ func TestMatchColumnsBasicCase(t *testing.T) {
 		},
 	}
 
-	err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
+	warnings, err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
 	assert.NoErr(t, err)
 	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 0)
+	assert.Equal(t, len(warnings), 0)
 	assert.Equal(t, liveResources[0].ManifestID, "entry1")
 	assert.Equal(t, liveResources[1].ManifestID, "entry2")
 	// matchColumnsToManifest should have updated the manifest with resource IDs for this specific
@@ -82,9 +83,10 @@ func TestMatchColumnsMissingLiveResources(t *testing.T) {
 		},
 	}
 
-	err := mfest.MatchLiveResources(context.Background(), &[]liveresource.Resource{}, "prod")
+	warnings, err := mfest.MatchLiveResources(context.Background(), &[]liveresource.Resource{}, "prod")
 	assert.NoErr(t, err)
 	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 0)
+	assert.Equal(t, len(warnings), 0)
 }
 
 func TestMatchColumnsMissingManifestEntries(t *testing.T) {
@@ -97,9 +99,12 @@ func TestMatchColumnsMissingManifestEntries(t *testing.T) {
 		Resources: []Resource{},
 	}
 
-	err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
+	warnings, err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
 	assert.NoErr(t, err)
 	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 1)
+	assert.Equal(t, len(warnings), 1)
+	assert.Equal(t, warnings[0].Kind, MatchWarningUnmatchedLiveResource)
+	assert.Equal(t, warnings[0].ResourceUUID, "fe20fd48-a006-4ad8-9208-4aad540d8794")
 	assert.Equal(t, liveResources[0].ManifestID, "")
 }
 
@@ -136,10 +141,16 @@ func TestMatchColumnsMatchingByName(t *testing.T) {
 		},
 	}
 
-	err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
+	warnings, err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
 	assert.NoErr(t, err)
 	// We should get warnings logged that the IDs didn't match
 	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 2)
+	assert.Equal(t, len(warnings), 2)
+	assert.Equal(t, warnings[0].Kind, MatchWarningMatchedByName)
+	assert.Equal(t, warnings[1].Kind, MatchWarningMatchedByName)
+	// Warnings are sorted, regardless of the order that matching found them
+	assert.Equal(t, warnings[0].ManifestID, "entry1")
+	assert.Equal(t, warnings[1].ManifestID, "entry2")
 	// But we should still end up with resolved manifest IDs
 	assert.Equal(t, liveResources[0].ManifestID, "entry1")
 	assert.Equal(t, liveResources[1].ManifestID, "entry2")
@@ -182,9 +193,77 @@ func TestMatchColumnsMatchingByIdPrioritized(t *testing.T) {
 		},
 	}
 
-	err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
+	warnings, err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
 	assert.NoErr(t, err)
 	tt.AssertMessagesByLogLevel(uclog.LogLevelWarning, 0)
+	assert.Equal(t, len(warnings), 0)
 	assert.Equal(t, liveResources[0].ManifestID, "entry1")
 	assert.Equal(t, liveResources[1].ManifestID, "entry2")
 }
+
+func TestMatchSkipsResourcesExcludedFromTenant(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+
+	liveResources := []liveresource.Resource{
+		makeLiveResource("fe20fd48-a006-4ad8-9208-4aad540d8794", "col1"),
+	}
+	mfest := Manifest{
+		Resources: []Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "debug_col",
+				ResourceUUIDs: map[string]string{
+					"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+				},
+				Attributes: map[string]any{
+					"name": "col1",
+				},
+				OnlyTenants: []string{"mycompany-dev*"},
+			},
+		},
+	}
+
+	warnings, err := mfest.MatchLiveResources(context.Background(), &liveResources, "mycompany-prod")
+	assert.NoErr(t, err)
+	// The live resource isn't matched to the excluded entry, and the excluded
+	// entry doesn't get a UUID for this tenant
+	assert.Equal(t, liveResources[0].ManifestID, "")
+	assert.Equal(t, len(warnings), 1)
+	assert.Equal(t, warnings[0].Kind, MatchWarningUnmatchedLiveResource)
+	assert.Equal(t, mfest.Resources[0].ResourceUUIDs["mycompany-prod"], "")
+
+	warnings, err = mfest.MatchLiveResources(context.Background(), &liveResources, "mycompany-dev2")
+	assert.NoErr(t, err)
+	assert.Equal(t, len(warnings), 0)
+	assert.Equal(t, liveResources[0].ManifestID, "debug_col")
+}
+
+func TestMatchWarningsSorted(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+
+	liveResources := []liveresource.Resource{
+		makeLiveResource("fe20fd48-a006-4ad8-9208-4aad540d8794", "col3"),
+		makeLiveResource("633fac47-c6c1-4459-93e0-0bb4043e60a0", "col1"),
+		{
+			TerraformTypeSuffix: "access_policy",
+			ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+			Attributes:          map[string]any{"name": "policy"},
+		},
+		makeLiveResource("c860a6d7-c632-4f81-8f5f-597290a9f437", "col2"),
+	}
+	mfest := Manifest{Resources: []Resource{}}
+
+	warnings, err := mfest.MatchLiveResources(context.Background(), &liveResources, "prod")
+	assert.NoErr(t, err)
+	var uuids []string
+	for _, w := range warnings {
+		assert.Equal(t, w.Kind, MatchWarningUnmatchedLiveResource)
+		uuids = append(uuids, w.ResourceUUID)
+	}
+	assert.Equal(t, uuids, []string{
+		"dc42da22-4c49-459d-9572-3b5db6d61959",
+		"633fac47-c6c1-4459-93e0-0bb4043e60a0",
+		"c860a6d7-c632-4f81-8f5f-597290a9f437",
+		"fe20fd48-a006-4ad8-9208-4aad540d8794",
+	})
+}
@@ -0,0 +1,220 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// MatchWarningMissingLiveResource is used when merging live resources into a
+// manifest, for manifest entries that apply to the tenant but weren't matched
+// to any live resource
+const MatchWarningMissingLiveResource MatchWarningKind = "missing_live_resource"
+
+// MatchWarningKeptFunctionInvocation is used when merging live resources into
+// a manifest, for attributes that differ from the live resource but were left
+// as they are because they are set with a function invocation like @VAR
+const MatchWarningKeptFunctionInvocation MatchWarningKind = "kept_function_invocation"
+
+var functionInvocationRegexp = regexp.MustCompile(`^@([A-Z_]+)\(`)
+
+// hasAuthoredFunctionInvocation returns true if value contains a function
+// invocation other than the UC_MANIFEST_ID and UC_SYSTEM_OBJECT references
+// that RewriteWithFunctionCalls generates itself. Those other invocations
+// (e.g. @VAR, or @FILE pointing at a file the user maintains) can't be
+// regenerated from the live value, so merging leaves them alone.
+func hasAuthoredFunctionInvocation(value any) bool {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String:
+		match := functionInvocationRegexp.FindStringSubmatch(v.String())
+		return match != nil && match[1] != "UC_MANIFEST_ID" && match[1] != "UC_SYSTEM_OBJECT"
+	case reflect.Array, reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if hasAuthoredFunctionInvocation(v.Index(i).Interface()) {
+				return true
+			}
+		}
+	case reflect.Map:
+		for _, key := range v.MapKeys() {
+			if hasAuthoredFunctionInvocation(v.MapIndex(key).Interface()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ResolveFunc returns an attribute value of a manifest entry with its function
+// invocations (e.g. @VAR and @FILE) resolved to concrete values for the tenant
+// being merged
+type ResolveFunc func(r *Resource, val any) (any, error)
+
+// MergeResult describes how MergeLiveResources changed a manifest
+type MergeResult struct {
+	// Manifest IDs of the entries whose attributes were updated from the live
+	// tenant
+	Updated []string
+	// Manifest IDs of the entries that were added for live resources that
+	// weren't in the manifest
+	Added []string
+	// Entries that apply to the tenant but don't exist in it any more (which
+	// are left in the manifest, since they may still exist in other tenants),
+	// and attributes that were left as-is because they are set with a function
+	// invocation
+	Warnings []MatchWarning
+}
+
+// MergeLiveResources updates mfest in place to describe the given live
+// resources, which must already have been matched against it with
+// MatchLiveResources. Entries matched to a live resource keep their manifest
+// ID, resource_uuids, and other settings. If their manifest ID is in changed,
+// their attributes are updated to the live attributes, except for attributes
+// set with a function invocation like @VAR, which are left as-is (with a
+// warning if their value, resolved with resolve, differs from the live value).
+// Entries that aren't in changed are left as-is entirely. Live resources that
+// didn't match any entry are appended as new entries.
+func MergeLiveResources(ctx context.Context, mfest *Manifest, liveResources *[]liveresource.Resource, fqtn string, changed map[string]bool, externValuesDir *ExternValuesDirConfig, resolve ResolveFunc) (MergeResult, error) {
+	result := MergeResult{Updated: []string{}, Added: []string{}, Warnings: []MatchWarning{}}
+
+	usedManifestIDs := map[string]bool{}
+	for _, r := range mfest.Resources {
+		usedManifestIDs[r.ManifestID] = true
+	}
+	liveByManifestID := map[string]*liveresource.Resource{}
+	var added []Resource
+	for i := range *liveResources {
+		live := &(*liveResources)[i]
+		if live.IsSystem {
+			continue
+		}
+		if live.ManifestID != "" {
+			liveByManifestID[live.ManifestID] = live
+			continue
+		}
+		r := fromLiveResource(live, fqtn)
+		// Don't reuse the manifest ID of an existing entry, e.g. one that is
+		// excluded from this tenant
+		if usedManifestIDs[r.ManifestID] {
+			r.ManifestID = fmt.Sprintf("%s_%s", r.ManifestID, live.ResourceUUID)
+		}
+		usedManifestIDs[r.ManifestID] = true
+		added = append(added, r)
+	}
+
+	// References in the rewritten attributes are resolved against the merged
+	// manifest, which has the tenant's UUID for every matched entry
+	numExisting := len(mfest.Resources)
+	mfest.Resources = append(mfest.Resources, added...)
+	genCtx := &functionGenerationContext{
+		Manifest:        mfest,
+		LiveResources:   liveResources,
+		FQTN:            fqtn,
+		ExternValuesDir: externValuesDir,
+	}
+	for i := range mfest.Resources {
+		r := &mfest.Resources[i]
+		if i >= numExisting {
+			if err := r.RewriteWithFunctionCalls(genCtx); err != nil {
+				return MergeResult{}, ucerr.Wrap(err)
+			}
+			result.Added = append(result.Added, r.ManifestID)
+			continue
+		}
+		if !r.AppliesToTenant(fqtn) {
+			continue
+		}
+		live, ok := liveByManifestID[r.ManifestID]
+		if !ok {
+			resourceUUID := r.ResourceUUIDs[fqtn]
+			if resourceUUID == "" {
+				resourceUUID = r.ResourceUUIDs["__DEFAULT"]
+			}
+			message := fmt.Sprintf("Manifest entry %s does not match any live %s resource. Leaving it in the manifest, but it will be created if the manifest is applied.", r.ManifestID, r.TerraformTypeSuffix)
+			uclog.Warningf(ctx, "%s", message)
+			result.Warnings = append(result.Warnings, MatchWarning{
+				Kind:                MatchWarningMissingLiveResource,
+				TerraformTypeSuffix: r.TerraformTypeSuffix,
+				ResourceUUID:        resourceUUID,
+				ManifestID:          r.ManifestID,
+				Message:             message,
+			})
+			continue
+		}
+		if !changed[r.ManifestID] {
+			continue
+		}
+		// Attributes that keep their function invocation aren't rewritten, so
+		// that e.g. a file referenced with @FILE isn't overwritten with the
+		// live value
+		updated := *r
+		updated.Attributes = map[string]any{}
+		for key, val := range fromLiveResource(live, fqtn).Attributes {
+			if !hasAuthoredFunctionInvocation(r.Attributes[key]) {
+				updated.Attributes[key] = val
+			}
+		}
+		if err := updated.RewriteWithFunctionCalls(genCtx); err != nil {
+			return MergeResult{}, ucerr.Wrap(err)
+		}
+		merged, warnings, err := mergeAttributes(ctx, r, updated.Attributes, live, resolve)
+		if err != nil {
+			return MergeResult{}, ucerr.Wrap(err)
+		}
+		result.Warnings = append(result.Warnings, warnings...)
+		if sameValue(merged, r.Attributes) {
+			continue
+		}
+		r.Attributes = merged
+		result.Updated = append(result.Updated, r.ManifestID)
+	}
+	return result, nil
+}
+
+// mergeAttributes returns the attributes that a manifest entry should have
+// after merging in the rewritten live attributes. Attributes set with an
+// authored function invocation keep their manifest values, and a warning is
+// returned for each one whose resolved value differs from the live value.
+func mergeAttributes(ctx context.Context, r *Resource, liveAttributes map[string]any, live *liveresource.Resource, resolve ResolveFunc) (map[string]any, []MatchWarning, error) {
+	merged := map[string]any{}
+	var kept []string
+	for key, val := range r.Attributes {
+		if !hasAuthoredFunctionInvocation(val) {
+			continue
+		}
+		merged[key] = val
+		resolved, err := resolve(r, val)
+		if err != nil {
+			return nil, nil, ucerr.Errorf("error resolving attribute %s of manifest entry %s: %v", key, r.ManifestID, err)
+		}
+		if liveVal, ok := live.Attributes[key]; !ok || !sameValue(resolved, liveVal) {
+			kept = append(kept, key)
+		}
+	}
+	for key, val := range liveAttributes {
+		if _, ok := merged[key]; !ok {
+			merged[key] = val
+		}
+	}
+
+	sort.Strings(kept)
+	var warnings []MatchWarning
+	for _, key := range kept {
+		message := fmt.Sprintf("Attribute %s of manifest entry %s differs from the live %s resource, but it is set with a function invocation, so it was left as-is. Update it by hand if needed.", key, r.ManifestID, r.TerraformTypeSuffix)
+		uclog.Warningf(ctx, "%s", message)
+		warnings = append(warnings, MatchWarning{
+			Kind:                MatchWarningKeptFunctionInvocation,
+			TerraformTypeSuffix: r.TerraformTypeSuffix,
+			ResourceUUID:        live.ResourceUUID,
+			ManifestID:          r.ManifestID,
+			Message:             message,
+		})
+	}
+	return merged, warnings, nil
+}
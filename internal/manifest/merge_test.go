@@ -0,0 +1,200 @@
+package manifest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/infra/assert"
+)
+
+func TestMergeLiveResources(t *testing.T) {
+	ctx := context.Background()
+	mfest := Manifest{
+		Resources: []Resource{
+			// Unchanged in staging, so its @VAR invocation should be kept
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email_col",
+				ResourceUUIDs: map[string]string{
+					"__DEFAULT":       "fe20fd48-a006-4ad8-9208-4aad540d8794",
+					"mycompany-prod":  "c860a6d7-c632-4f81-8f5f-597290a9f437",
+					"mycompany-stage": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+				},
+				Attributes: map[string]any{"name": `@VAR("email_col_name")`},
+			},
+			// Changed in staging
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "phone_col",
+				ResourceUUIDs: map[string]string{
+					"mycompany-prod":  "78733010-2a5b-469e-924e-50258db84db9",
+					"mycompany-stage": "dc42da22-4c49-459d-9572-3b5db6d61959",
+				},
+				Attributes: map[string]any{"name": "phone", "index_type": "none"},
+				Lifecycle:  &Lifecycle{PreventDestroy: true},
+			},
+			// Deleted from staging
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "old_col",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "aa4c26a8-7e3a-4a52-9f3c-4c3a3d0d5b4c"},
+				Attributes:          map[string]any{"name": "old"},
+			},
+			// Only in prod, so it shouldn't be flagged as missing
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "userstore_column_new",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "b1d39d4b-8f8e-4a43-8b0f-3c9d4b6d2f4a"},
+				Attributes:          map[string]any{"name": "new"},
+				OnlyTenants:         []string{"mycompany-prod"},
+			},
+		},
+	}
+	live := []liveresource.Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+			Attributes:          map[string]any{"name": "email"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+			Attributes:          map[string]any{"name": "phone", "index_type": "indexed"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+			Attributes:          map[string]any{"name": "new"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_accessor",
+			ResourceUUID:        "0c2ce5a0-5a2b-4a3a-9b7b-1b9b4d0e6f2e",
+			Attributes: map[string]any{
+				"name":    "acc",
+				"columns": []any{map[string]any{"column": "dc42da22-4c49-459d-9572-3b5db6d61959"}},
+			},
+		},
+	}
+	_, err := mfest.MatchLiveResources(ctx, &live, "mycompany-stage")
+	assert.NoErr(t, err)
+
+	result, err := MergeLiveResources(ctx, &mfest, &live, "mycompany-stage", map[string]bool{"phone_col": true}, nil, resolveVariables(&mfest))
+	assert.NoErr(t, err)
+	assert.Equal(t, result.Updated, []string{"phone_col"})
+	// The default manifest ID for the new column is already taken
+	assert.Equal(t, result.Added, []string{"userstore_column_new_633fac47-c6c1-4459-93e0-0bb4043e60a0", "userstore_accessor_acc"})
+	assert.Equal(t, len(result.Warnings), 1)
+	assert.Equal(t, result.Warnings[0].Kind, MatchWarningMissingLiveResource)
+	assert.Equal(t, result.Warnings[0].ManifestID, "old_col")
+
+	assert.Equal(t, len(mfest.Resources), 6)
+	assert.Equal(t, mfest.Resources[0].Attributes["name"], `@VAR("email_col_name")`)
+	assert.Equal(t, mfest.Resources[1].Attributes["index_type"], "indexed")
+	assert.Equal(t, mfest.Resources[1].ResourceUUIDs["mycompany-prod"], "78733010-2a5b-469e-924e-50258db84db9")
+	assert.Equal(t, mfest.Resources[1].Lifecycle.PreventDestroy, true)
+	assert.Equal(t, mfest.Resources[2].ManifestID, "old_col")
+	assert.Equal(t, mfest.Resources[5].Attributes["columns"], []any{map[string]any{"column": `@UC_MANIFEST_ID("phone_col").id`}})
+}
+
+// resolveVariables stands in for the tfconfig resolver, which can't be
+// imported here, resolving @VAR invocations with the manifest's __DEFAULT
+// values
+func resolveVariables(mfest *Manifest) ResolveFunc {
+	return func(r *Resource, val any) (any, error) {
+		s, ok := val.(string)
+		if !ok {
+			return val, nil
+		}
+		if match := regexp.MustCompile(`^@VAR\("(.*)"\)$`).FindStringSubmatch(s); match != nil {
+			return mfest.Variables[match[1]]["__DEFAULT"], nil
+		}
+		return val, nil
+	}
+}
+
+func TestMergeLiveResourcesKeepsFunctionInvocations(t *testing.T) {
+	ctx := context.Background()
+	mfest := Manifest{
+		Variables: map[string]map[string]any{
+			"phone_index":  {"__DEFAULT": "none"},
+			"phone_search": {"__DEFAULT": true},
+		},
+		Resources: []Resource{{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "phone_col",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "dc42da22-4c49-459d-9572-3b5db6d61959"},
+			Attributes: map[string]any{
+				"name":       "phone",
+				"type":       "string",
+				"index_type": `@VAR("phone_index")`,
+				// Resolves to the live value, so there's no warning for it
+				"search_indexed": `@VAR("phone_search")`,
+			},
+		}},
+	}
+	live := []liveresource.Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+		Attributes:          map[string]any{"name": "phone", "type": "integer", "index_type": "indexed", "search_indexed": true},
+	}}
+	_, err := mfest.MatchLiveResources(ctx, &live, "mycompany-stage")
+	assert.NoErr(t, err)
+
+	result, err := MergeLiveResources(ctx, &mfest, &live, "mycompany-stage", map[string]bool{"phone_col": true}, nil, resolveVariables(&mfest))
+	assert.NoErr(t, err)
+	assert.Equal(t, result.Updated, []string{"phone_col"})
+	assert.Equal(t, mfest.Resources[0].Attributes["type"], "integer")
+	assert.Equal(t, mfest.Resources[0].Attributes["index_type"], `@VAR("phone_index")`)
+	assert.Equal(t, mfest.Resources[0].Attributes["search_indexed"], `@VAR("phone_search")`)
+	assert.Equal(t, len(result.Warnings), 1)
+	assert.Equal(t, result.Warnings[0].Kind, MatchWarningKeptFunctionInvocation)
+	assert.Equal(t, result.Warnings[0].ManifestID, "phone_col")
+}
+
+func TestMergeLiveResourcesKeepsValueFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	valuePath := filepath.Join(dir, "transformer_mask_function.js")
+	assert.NoErr(t, os.WriteFile(valuePath, []byte("function transform() { return 'user'; }\n"), 0644))
+	mfest := Manifest{
+		Resources: []Resource{{
+			TerraformTypeSuffix: "transformer",
+			ManifestID:          "mask",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "dc42da22-4c49-459d-9572-3b5db6d61959"},
+			Attributes: map[string]any{
+				"name":        "mask",
+				"description": "old",
+				"function":    `@FILE("values/transformer_mask_function.js")`,
+			},
+		}},
+	}
+	live := []liveresource.Resource{{
+		TerraformTypeSuffix: "transformer",
+		ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+		Attributes:          map[string]any{"name": "mask", "description": "new", "function": "function transform() { return 'live'; }"},
+	}}
+	_, err := mfest.MatchLiveResources(ctx, &live, "mycompany-stage")
+	assert.NoErr(t, err)
+
+	resolveFiles := func(r *Resource, val any) (any, error) {
+		match := regexp.MustCompile(`^@FILE\("values/(.*)"\)$`).FindStringSubmatch(val.(string))
+		contents, err := os.ReadFile(filepath.Join(dir, match[1]))
+		return strings.TrimSuffix(string(contents), "\n"), err
+	}
+	result, err := MergeLiveResources(ctx, &mfest, &live, "mycompany-stage", map[string]bool{"mask": true}, &ExternValuesDirConfig{AbsolutePath: dir, RelativePathFromManifest: "values"}, resolveFiles)
+	assert.NoErr(t, err)
+	assert.Equal(t, mfest.Resources[0].Attributes["description"], "new")
+	assert.Equal(t, mfest.Resources[0].Attributes["function"], `@FILE("values/transformer_mask_function.js")`)
+	assert.Equal(t, len(result.Warnings), 1)
+	assert.Equal(t, result.Warnings[0].Kind, MatchWarningKeptFunctionInvocation)
+
+	// The file the manifest points at is left alone
+	contents, err := os.ReadFile(valuePath)
+	assert.NoErr(t, err)
+	assert.Equal(t, string(contents), "function transform() { return 'user'; }\n")
+}
@@ -94,3 +94,98 @@ func TestRejectsManifestMissingResourceUUID(t *testing.T) {
 	_, err := parseAndValidateJSON(jsonManifest, "mycompany-prod")
 	assert.True(t, err != nil && strings.Contains(err.Error(), "resource_uuids either must include a UUID for tenant \"mycompany-prod\", or it must include a __DEFAULT entry."))
 }
+
+func TestRejectsManifestInvalidManifestID(t *testing.T) {
+	jsonManifest := `{
+		"resources": [
+			{
+				"uc_terraform_type": "userstore_column",
+				"manifest_id": "email col",
+				"resource_uuids": {
+					"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"
+				},
+				"attributes": {}
+			}
+		]
+	}`
+	_, err := parseAndValidateJSON(jsonManifest, "mycompany-prod")
+	assert.True(t, err != nil && strings.Contains(err.Error(), "manifest_id \"email col\" is not a valid Terraform identifier"))
+}
+
+func TestValidateEntriesReportsAllProblems(t *testing.T) {
+	jsonManifest := `{
+		"resources": [
+			{
+				"uc_terraform_type": "userstore_column",
+				"manifest_id": "email_col",
+				"resource_uuids": {
+					"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"
+				},
+				"attributes": {}
+			},
+			{
+				"uc_terraform_type": "userstore_column",
+				"manifest_id": "email_col",
+				"resource_uuids": {
+					"__DEFAULT": "not-a-uuid"
+				},
+				"attributes": {}
+			}
+		]
+	}`
+	parsed := Manifest{}
+	assert.NoErr(t, json.Unmarshal([]byte(jsonManifest), &parsed))
+	errs := parsed.ValidateEntries()
+	assert.Equal(t, len(errs), 2)
+	assert.True(t, strings.Contains(errs[0].Error(), "manifest_id \"email_col\" is already used by the resource at index 0"))
+	assert.True(t, strings.Contains(errs[1].Error(), "resource_uuids entry for \"__DEFAULT\" is not a valid UUID"))
+}
+
+func TestValidateVariables(t *testing.T) {
+	mfest := Manifest{
+		Variables: map[string]map[string]any{
+			"threshold": {"mycompany-prod": 50},
+			"bad name":  {"__DEFAULT": 1},
+			"empty":     {},
+		},
+	}
+	errs := mfest.ValidateEntries()
+	assert.Equal(t, len(errs), 2)
+	assert.True(t, strings.Contains(errs[0].Error(), "variable \"bad name\""))
+	assert.True(t, strings.Contains(errs[1].Error(), "variable \"empty\""))
+
+	delete(mfest.Variables, "bad name")
+	delete(mfest.Variables, "empty")
+	assert.NoErr(t, mfest.Validate("mycompany-prod"))
+	err := mfest.Validate("mycompany-staging")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "variable threshold has no value for tenant \"mycompany-staging\""))
+}
+
+func TestTenantFilters(t *testing.T) {
+	only := Resource{OnlyTenants: []string{"mycompany-dev", "mycompany-test*"}}
+	assert.True(t, only.AppliesToTenant("mycompany-dev"))
+	assert.True(t, only.AppliesToTenant("mycompany-test3"))
+	assert.False(t, only.AppliesToTenant("mycompany-prod"))
+
+	except := Resource{ExceptTenants: []string{"mycompany-prod"}}
+	assert.True(t, except.AppliesToTenant("mycompany-dev"))
+	assert.False(t, except.AppliesToTenant("mycompany-prod"))
+
+	mfest := Manifest{Resources: []Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "debug_col",
+			ResourceUUIDs:       map[string]string{"mycompany-dev": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+			OnlyTenants:         []string{"mycompany-dev"},
+		},
+	}}
+	// No UUID is needed for tenants the resource is excluded from
+	assert.NoErr(t, mfest.Validate("mycompany-prod"))
+
+	mfest.Resources[0].ExceptTenants = []string{"[bad"}
+	errs := mfest.ValidateEntries()
+	assert.Equal(t, len(errs), 2)
+	assert.True(t, strings.Contains(errs[0].Error(), "only one of only_tenants and except_tenants"))
+	assert.True(t, strings.Contains(errs[1].Error(), "tenant pattern \"[bad\" is invalid"))
+}
@@ -0,0 +1,126 @@
+package manifest
+
+import (
+	"regexp"
+	"strings"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/resourcetypes"
+	"userclouds.com/infra/ucerr"
+)
+
+// Scope limits which live resources a manifest manages. Live resources outside
+// the scope are left alone: they are not matched against the manifest, not
+// included in the generated Terraform state, and never deleted. This lets
+// several manifests manage disjoint parts of the same tenant.
+type Scope struct {
+	// If set, only resources of these types are in scope
+	Types []string `json:"types,omitempty" yaml:"types,omitempty"`
+	// If either of these is set, only resources whose name starts with one of
+	// the prefixes or matches the regex are in scope. They don't apply to
+	// resources without a name (e.g. retention durations), which are in scope
+	// only if their type is listed in Types.
+	NamePrefixes []string `json:"name_prefixes,omitempty" yaml:"name_prefixes,omitempty"`
+	NameRegex    string   `json:"name_regex,omitempty" yaml:"name_regex,omitempty"`
+	// Resources whose UUID or name is listed here are out of scope
+	Ignore []string `json:"ignore,omitempty" yaml:"ignore,omitempty"`
+}
+
+func (s *Scope) hasNameFilter() bool {
+	return len(s.NamePrefixes) > 0 || s.NameRegex != ""
+}
+
+// contains returns true if a resource with the given type, UUID, and name
+// (blank if the resource has no name) is in scope
+func (s *Scope) contains(terraformTypeSuffix string, resourceUUID string, name string) bool {
+	if s == nil {
+		return true
+	}
+	if len(s.Types) > 0 {
+		found := false
+		for _, t := range s.Types {
+			if t == terraformTypeSuffix {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if s.hasNameFilter() {
+		if name == "" {
+			// Nameless resources can't match a name filter, so they are only
+			// managed if their type was asked for explicitly
+			return len(s.Types) > 0
+		}
+		matched := false
+		for _, prefix := range s.NamePrefixes {
+			if strings.HasPrefix(name, prefix) {
+				matched = true
+				break
+			}
+		}
+		if !matched && s.NameRegex != "" {
+			// The regex is checked by validate, so an invalid regex here just
+			// matches nothing
+			if re, err := regexp.Compile(s.NameRegex); err == nil && re.MatchString(name) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for _, ignored := range s.Ignore {
+		if ignored == resourceUUID || (name != "" && ignored == name) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Scope) validate() []error {
+	if s == nil {
+		return nil
+	}
+	var errs []error
+	for _, t := range s.Types {
+		if !resourcetypes.ValidateTerraformTypeSuffix(t) {
+			errs = append(errs, ucerr.Errorf("error validating scope: \"%s\" is not a valid userclouds resource type suffix", t))
+		}
+	}
+	if s.NameRegex != "" {
+		if _, err := regexp.Compile(s.NameRegex); err != nil {
+			errs = append(errs, ucerr.Errorf("error validating scope: name_regex is invalid: %v", err))
+		}
+	}
+	return errs
+}
+
+func resourceName(attributes map[string]any) string {
+	name, _ := attributes["name"].(string)
+	return name
+}
+
+// InScope returns true if the manifest manages the given live resource. System
+// resources are always in scope, since they can be referenced with
+// @UC_SYSTEM_OBJECT but are never modified.
+func (mfest *Manifest) InScope(live *liveresource.Resource) bool {
+	return live.IsSystem || mfest.Scope.contains(live.TerraformTypeSuffix, live.ResourceUUID, resourceName(live.Attributes))
+}
+
+// FilterToScope returns the live resources that are in the manifest's scope,
+// along with the number of resources that were left out.
+func (mfest *Manifest) FilterToScope(liveResources []liveresource.Resource) ([]liveresource.Resource, int) {
+	if mfest.Scope == nil {
+		return liveResources, 0
+	}
+	out := []liveresource.Resource{}
+	for i := range liveResources {
+		if mfest.InScope(&liveResources[i]) {
+			out = append(out, liveResources[i])
+		}
+	}
+	return out, len(liveResources) - len(out)
+}
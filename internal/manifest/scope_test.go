@@ -0,0 +1,90 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/infra/assert"
+)
+
+func TestFilterToScope(t *testing.T) {
+	live := []liveresource.Resource{
+		{TerraformTypeSuffix: "userstore_accessor", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794", Attributes: map[string]any{"name": "dp_users"}},
+		{TerraformTypeSuffix: "userstore_accessor", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437", Attributes: map[string]any{"name": "other_users"}},
+		{TerraformTypeSuffix: "userstore_accessor", ResourceUUID: "633fac47-c6c1-4459-93e0-0bb4043e60a0", Attributes: map[string]any{"name": "dp_legacy"}},
+		{TerraformTypeSuffix: "access_policy", ResourceUUID: "dc42da22-4c49-459d-9572-3b5db6d61959", Attributes: map[string]any{"name": "dp_policy"}},
+		{TerraformTypeSuffix: "access_policy", ResourceUUID: "78733010-2a5b-469e-924e-50258db84db9", Attributes: map[string]any{"name": "AllowAll"}, IsSystem: true},
+	}
+
+	// No scope: everything is managed
+	mfest := Manifest{}
+	filtered, numOutOfScope := mfest.FilterToScope(live)
+	assert.Equal(t, len(filtered), 5)
+	assert.Equal(t, numOutOfScope, 0)
+
+	mfest.Scope = &Scope{
+		Types:        []string{"userstore_accessor"},
+		NamePrefixes: []string{"dp_"},
+		Ignore:       []string{"dp_legacy"},
+	}
+	filtered, numOutOfScope = mfest.FilterToScope(live)
+	assert.Equal(t, numOutOfScope, 3)
+	assert.Equal(t, len(filtered), 2)
+	assert.Equal(t, filtered[0].ResourceUUID, "fe20fd48-a006-4ad8-9208-4aad540d8794")
+	// System resources are kept so that they can be referenced
+	assert.Equal(t, filtered[1].ResourceUUID, "78733010-2a5b-469e-924e-50258db84db9")
+
+	mfest.Scope = &Scope{NameRegex: "^other_", Ignore: []string{"dc42da22-4c49-459d-9572-3b5db6d61959"}}
+	filtered, _ = mfest.FilterToScope(live)
+	assert.Equal(t, len(filtered), 2)
+	assert.Equal(t, filtered[0].ResourceUUID, "c860a6d7-c632-4f81-8f5f-597290a9f437")
+}
+
+func TestValidateScope(t *testing.T) {
+	mfest := Manifest{
+		Scope: &Scope{
+			Types:     []string{"userstore_accessor", "not_a_type"},
+			NameRegex: "(",
+		},
+		Resources: []Resource{
+			{
+				TerraformTypeSuffix: "access_policy",
+				ManifestID:          "policy",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "dc42da22-4c49-459d-9572-3b5db6d61959"},
+				Attributes:          map[string]any{"name": "policy"},
+			},
+		},
+	}
+	errs := mfest.ValidateEntries()
+	assert.Equal(t, len(errs), 3)
+	assert.True(t, strings.Contains(errs[0].Error(), "outside of the manifest's scope"))
+	assert.True(t, strings.Contains(errs[1].Error(), "\"not_a_type\" is not a valid"))
+	assert.True(t, strings.Contains(errs[2].Error(), "name_regex is invalid"))
+}
+
+func TestScopeNamelessResources(t *testing.T) {
+	retention := liveresource.Resource{
+		TerraformTypeSuffix: "userstore_column_soft_deleted_retention_duration",
+		ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+		Attributes:          map[string]any{"column_id": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+	}
+	entry := Resource{
+		TerraformTypeSuffix: "userstore_column_soft_deleted_retention_duration",
+		ManifestID:          "retention",
+		ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		Attributes:          map[string]any{"column_id": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+	}
+
+	// A name filter alone leaves nameless resources out of scope
+	mfest := Manifest{Scope: &Scope{NamePrefixes: []string{"dp_"}}, Resources: []Resource{entry}}
+	assert.False(t, mfest.InScope(&retention))
+	errs := mfest.ValidateEntries()
+	assert.Equal(t, len(errs), 1)
+	assert.True(t, strings.Contains(errs[0].Error(), "scope's types"))
+
+	// Listing the type brings them back in scope
+	mfest.Scope.Types = []string{"userstore_accessor", "userstore_column_soft_deleted_retention_duration"}
+	assert.True(t, mfest.InScope(&retention))
+	assert.Equal(t, len(mfest.ValidateEntries()), 0)
+}
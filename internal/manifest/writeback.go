@@ -0,0 +1,912 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// The functions in this file update the entries in a manifest file (their
+// resource_uuids maps, and for merges their attributes) without otherwise
+// changing the file. Decoding into a Manifest and encoding it
+// again would drop comments in YAML manifests and reorder keys in JSON
+// manifests, which makes the result painful to review and commit. Instead, for
+// YAML we splice the changed lines into the original text, and for JSON we
+// edit an order-preserving decoding and re-encode that.
+
+// TenantResourceUUIDs returns the UUID that each manifest entry's resource has
+// in the given tenant, keyed by manifest ID. For entries without a
+// tenant-specific UUID, this is the __DEFAULT UUID, which is the UUID that the
+// resource is created with. After a successful apply (and after
+// MatchLiveResources has filled in UUIDs for resources matched by name), these
+// are the UUIDs to record in the manifest file; UpdateResourceUUIDs skips the
+// ones that are the same as the entry's __DEFAULT UUID. Resources excluded
+// from the tenant are omitted.
+func (mfest *Manifest) TenantResourceUUIDs(fqtn string) map[string]string {
+	out := map[string]string{}
+	for _, r := range mfest.Resources {
+		if !r.AppliesToTenant(fqtn) {
+			continue
+		}
+		if id := r.ResourceUUIDs[fqtn]; id != "" {
+			out[r.ManifestID] = id
+		} else if id := r.ResourceUUIDs["__DEFAULT"]; id != "" {
+			out[r.ManifestID] = id
+		}
+	}
+	return out
+}
+
+// UpdateResourceUUIDs takes the text of a manifest file and sets
+// resource_uuids[fqtn] on each entry whose manifest ID is a key in uuids. The
+// format is the manifest file extension (".json" or ".yaml"). Everything else
+// in the file is left as it was, as far as the format allows. It returns the
+// updated text along with the number of entries that were changed; if nothing
+// needed to change, the original text is returned.
+func UpdateResourceUUIDs(text []byte, format string, fqtn string, uuids map[string]string) ([]byte, int, error) {
+	switch format {
+	case ".json":
+		return updateResourceUUIDsJSON(text, fqtn, uuids)
+	case ".yaml":
+		return updateResourceUUIDsYAML(text, fqtn, uuids)
+	}
+	return nil, 0, ucerr.Errorf("unsupported manifest format %s, must be .json or .yaml", format)
+}
+
+// detectIndent returns the leading whitespace of the first indented line in a
+// JSON manifest, or defaultIndent if no line is indented
+func detectIndent(text []byte, defaultIndent string) string {
+	for _, line := range strings.Split(string(text), "\n") {
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" || trimmed == line {
+			continue
+		}
+		return line[:len(line)-len(trimmed)]
+	}
+	return defaultIndent
+}
+
+// withTrailingNewline makes out end with a newline if and only if original did
+func withTrailingNewline(out []byte, original []byte) []byte {
+	out = bytes.TrimRight(out, "\n")
+	if bytes.HasSuffix(original, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	return out
+}
+
+// yamlMappingIndex returns the index in node.Content of the given key, or -1
+// if node isn't a mapping or doesn't have the key
+func yamlMappingIndex(node *yaml.Node, key string) int {
+	if node.Kind != yaml.MappingNode {
+		return -1
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func yamlMappingValue(node *yaml.Node, key string) *yaml.Node {
+	if i := yamlMappingIndex(node, key); i >= 0 {
+		return node.Content[i+1]
+	}
+	return nil
+}
+
+// isYAMLBlockMapping returns true if node is a non-empty mapping written in
+// block style, i.e. one key per line
+func isYAMLBlockMapping(node *yaml.Node) bool {
+	return node.Kind == yaml.MappingNode && node.Style&yaml.FlowStyle == 0 && len(node.Content) > 0
+}
+
+// yamlEdit replaces lines [start, end) of a YAML file (counted from 0) with
+// lines. Insertions have start == end.
+type yamlEdit struct {
+	start int
+	end   int
+	lines []string
+}
+
+// yamlEditor edits a YAML manifest by splicing changed lines into the original
+// text, using the line and column positions of the decoded yaml.Node tree.
+// Re-encoding the whole tree instead would drop blank lines and could change
+// quoting and styles anywhere in the file.
+type yamlEditor struct {
+	lines []string
+	// numLines leaves out the empty string after a trailing newline
+	numLines int
+	// indent is the width of one level of indentation in the file
+	indent    int
+	root      *yaml.Node
+	resources *yaml.Node
+	edits     []yamlEdit
+}
+
+func newYAMLEditor(text []byte) (*yamlEditor, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(text, &doc); err != nil {
+		return nil, ucerr.Errorf("error decoding YAML: %v", err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, ucerr.Errorf("manifest YAML is empty")
+	}
+	root := doc.Content[0]
+	resources := yamlMappingValue(root, "resources")
+	if resources == nil || resources.Kind != yaml.SequenceNode {
+		return nil, ucerr.Errorf("manifest YAML does not have a resources list")
+	}
+	lines := strings.Split(string(text), "\n")
+	numLines := len(lines)
+	if bytes.HasSuffix(text, []byte("\n")) {
+		numLines--
+	}
+	return &yamlEditor{
+		lines:     lines,
+		numLines:  numLines,
+		indent:    yamlIndent(resources),
+		root:      root,
+		resources: resources,
+	}, nil
+}
+
+// yamlIndent returns the width of one level of indentation in a YAML manifest,
+// measured from the nested mappings (e.g. attributes) of its resource entries.
+// Sequences can be indented less than mappings (including not at all), so
+// they aren't used.
+func yamlIndent(resources *yaml.Node) int {
+	for _, entry := range resources.Content {
+		if entry.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(entry.Content); i += 2 {
+			key, val := entry.Content[i], entry.Content[i+1]
+			if isYAMLBlockMapping(val) && val.Column > key.Column {
+				return val.Column - key.Column
+			}
+		}
+	}
+	// yaml.Marshal (which gen-manifest uses) indents with 4 spaces
+	return 4
+}
+
+// blockEnd returns the line (exclusive) where a node that starts on line start
+// ends, given that the next node starts on line next. Blank lines and comments
+// before the next node are left out, unless they're indented further than
+// indent columns (e.g. inside a block scalar).
+func (e *yamlEditor) blockEnd(start int, next int, indent int) int {
+	end := next
+	for end > start+1 {
+		line := e.lines[end-1]
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed != "" && (!strings.HasPrefix(trimmed, "#") || len(line)-len(trimmed) > indent) {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// pairEnd returns the line (exclusive) where the key/value pair at index i of
+// block mapping m ends, given the line where m ends
+func (e *yamlEditor) pairEnd(m *yaml.Node, i int, end int) int {
+	next := end
+	if i+2 < len(m.Content) {
+		next = m.Content[i+2].Line - 1
+	}
+	return e.blockEnd(m.Content[i].Line-1, next, m.Content[i].Column-1)
+}
+
+// resourcesEnd returns the line (exclusive) where the resources list ends
+func (e *yamlEditor) resourcesEnd() int {
+	return e.pairEnd(e.root, yamlMappingIndex(e.root, "resources"), e.numLines)
+}
+
+// entryEnd returns the line (exclusive) where the resource entry at index i of
+// the resources list ends
+func (e *yamlEditor) entryEnd(i int) int {
+	entry := e.resources.Content[i]
+	next := e.resourcesEnd()
+	if i+1 < len(e.resources.Content) {
+		next = e.resources.Content[i+1].Line - 1
+	}
+	return e.blockEnd(entry.Line-1, next, entry.Column-1)
+}
+
+// render encodes node with the file's indentation. The first line is prefixed
+// with prefix, and the others are indented to line up with it.
+func (e *yamlEditor) render(prefix string, node *yaml.Node) ([]string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(e.indent)
+	if err := enc.Encode(node); err != nil {
+		return nil, ucerr.Errorf("error encoding YAML: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, ucerr.Errorf("error encoding YAML: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	indent := strings.Repeat(" ", len(prefix))
+	for i, line := range lines {
+		if i == 0 {
+			lines[i] = prefix + line
+		} else if line != "" {
+			lines[i] = indent + line
+		}
+	}
+	return lines, nil
+}
+
+// renderPair encodes key: val with the first line prefixed with prefix
+func (e *yamlEditor) renderPair(prefix string, key *yaml.Node, val *yaml.Node) ([]string, error) {
+	return e.render(prefix, &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{key, val}})
+}
+
+// linePrefix returns the text before node on its line, e.g. the indentation,
+// or the indentation and "- " for the first key of a list item
+func (e *yamlEditor) linePrefix(node *yaml.Node) string {
+	return e.lines[node.Line-1][:node.Column-1]
+}
+
+func (e *yamlEditor) splice(start int, end int, lines []string) {
+	e.edits = append(e.edits, yamlEdit{start: start, end: end, lines: lines})
+}
+
+// replacePair replaces the value of the key/value pair at index i of block
+// mapping m (which ends on line end) with val
+func (e *yamlEditor) replacePair(m *yaml.Node, i int, end int, val *yaml.Node) error {
+	key := m.Content[i]
+	lines, err := e.renderPair(e.linePrefix(key), key, val)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	e.splice(key.Line-1, e.pairEnd(m, i, end), lines)
+	return nil
+}
+
+// deletePair removes the key/value pair at index i of block mapping m (which
+// ends on line end), along with the comment lines directly above it
+func (e *yamlEditor) deletePair(m *yaml.Node, i int, end int) {
+	key := m.Content[i]
+	start := key.Line - 1
+	for start > 0 && strings.HasPrefix(strings.TrimLeft(e.lines[start-1], " "), "#") {
+		start--
+	}
+	e.splice(start, e.pairEnd(m, i, end), nil)
+}
+
+// appendPairs adds key/value pairs after the last pair of block mapping m
+// (which ends on line end)
+func (e *yamlEditor) appendPairs(m *yaml.Node, end int, pairs []*yaml.Node) error {
+	last := m.Content[len(m.Content)-2]
+	lines, err := e.render(strings.Repeat(" ", last.Column-1), &yaml.Node{Kind: yaml.MappingNode, Content: pairs})
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	at := e.pairEnd(m, len(m.Content)-2, end)
+	e.splice(at, at, lines)
+	return nil
+}
+
+// setEntryValue replaces the value of key in the resource entry at index i of
+// the resources list, or adds key to the end of the entry if it isn't there
+func (e *yamlEditor) setEntryValue(i int, key string, val *yaml.Node) error {
+	entry := e.resources.Content[i]
+	if k := yamlMappingIndex(entry, key); k >= 0 {
+		return ucerr.Wrap(e.replacePair(entry, k, e.entryEnd(i), val))
+	}
+	return ucerr.Wrap(e.appendPairs(entry, e.entryEnd(i), []*yaml.Node{yamlKey(key, nil), val}))
+}
+
+// bytes returns the text with all the edits spliced in
+func (e *yamlEditor) bytes() []byte {
+	// Edits at the same line are applied in reverse, so that they end up in
+	// the order they were made
+	sort.SliceStable(e.edits, func(i, j int) bool { return e.edits[i].start < e.edits[j].start })
+	lines := e.lines
+	for i := len(e.edits) - 1; i >= 0; i-- {
+		edit := e.edits[i]
+		spliced := append([]string{}, lines[:edit.start]...)
+		spliced = append(spliced, edit.lines...)
+		lines = append(spliced, lines[edit.end:]...)
+	}
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// yamlKey returns a key node, styled like like if it's set
+func yamlKey(key string, like *yaml.Node) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+	if like != nil {
+		node.Style = like.Style
+	}
+	return node
+}
+
+// yamlValue encodes val as a node. If both val and existing are strings and
+// existing is quoted (or a block scalar), val is written the same way; its
+// comment is kept too.
+func yamlValue(val any, existing *yaml.Node) (*yaml.Node, error) {
+	node := &yaml.Node{}
+	if err := node.Encode(val); err != nil {
+		return nil, ucerr.Errorf("error encoding YAML: %v", err)
+	}
+	if existing == nil {
+		return node, nil
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && existing.Kind == yaml.ScalarNode && existing.Tag == "!!str" && existing.Style != 0 {
+		node.Style = existing.Style
+	}
+	node.LineComment = existing.LineComment
+	return node, nil
+}
+
+// setYAMLResourceUUID sets resource_uuids[fqtn] on the resource entry at index
+// i of the resources list, returning whether it changed. An entry without a
+// resource_uuids[fqtn] isn't given one if id is its __DEFAULT UUID, since
+// that's the UUID it has in every tenant without its own entry.
+func (e *yamlEditor) setYAMLResourceUUID(i int, fqtn string, id string) (bool, error) {
+	entry := e.resources.Content[i]
+	k := yamlMappingIndex(entry, "resource_uuids")
+	if k < 0 {
+		if id == "" {
+			return false, nil
+		}
+		uuids := &yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{yamlKey(fqtn, nil), yamlKey(id, nil)}}
+		return true, ucerr.Wrap(e.setEntryValue(i, "resource_uuids", uuids))
+	}
+
+	uuids := entry.Content[k+1]
+	if existing := yamlMappingValue(uuids, fqtn); existing != nil {
+		if existing.Value == id {
+			return false, nil
+		}
+	} else if defaultUUID := yamlMappingValue(uuids, "__DEFAULT"); defaultUUID != nil && defaultUUID.Value == id {
+		return false, nil
+	}
+
+	if !isYAMLBlockMapping(uuids) {
+		// e.g. `resource_uuids: {}`, or written as null: replace it with a
+		// block mapping
+		replacement := &yaml.Node{Kind: yaml.MappingNode}
+		if uuids.Kind == yaml.MappingNode {
+			replacement.Content = append(replacement.Content, uuids.Content...)
+		}
+		replacement.Content = append(replacement.Content, yamlKey(fqtn, nil), yamlKey(id, nil))
+		return true, ucerr.Wrap(e.replacePair(entry, k, e.entryEnd(i), replacement))
+	}
+
+	uuidsEnd := e.pairEnd(entry, k, e.entryEnd(i))
+	if j := yamlMappingIndex(uuids, fqtn); j >= 0 {
+		val, err := yamlValue(id, uuids.Content[j+1])
+		if err != nil {
+			return false, ucerr.Wrap(err)
+		}
+		return true, ucerr.Wrap(e.replacePair(uuids, j, uuidsEnd, val))
+	}
+	last := len(uuids.Content) - 2
+	val := yamlKey(id, uuids.Content[last+1])
+	return true, ucerr.Wrap(e.appendPairs(uuids, uuidsEnd, []*yaml.Node{yamlKey(fqtn, uuids.Content[last]), val}))
+}
+
+func updateResourceUUIDsYAML(text []byte, fqtn string, uuids map[string]string) ([]byte, int, error) {
+	e, err := newYAMLEditor(text)
+	if err != nil {
+		return nil, 0, ucerr.Wrap(err)
+	}
+
+	changed := 0
+	for i, resource := range e.resources.Content {
+		manifestID := yamlMappingValue(resource, "manifest_id")
+		if manifestID == nil {
+			continue
+		}
+		id, ok := uuids[manifestID.Value]
+		if !ok {
+			continue
+		}
+		entryChanged, err := e.setYAMLResourceUUID(i, fqtn, id)
+		if err != nil {
+			return nil, 0, ucerr.Wrap(err)
+		}
+		if entryChanged {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return text, 0, nil
+	}
+	return e.bytes(), changed, nil
+}
+
+// jsonObject is a decoded JSON object that remembers the order of its keys, so
+// that it can be encoded again without reordering them
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *jsonObject) set(key string, val any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = val
+}
+
+// marshalJSON encodes v like json.Marshal, except that <, > and & are left as
+// they are instead of being escaped, so that strings in the manifest come back
+// out the way they were written
+func marshalJSON(v any, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (o *jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		keyJSON, err := marshalJSON(key, "")
+		if err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+		valJSON, err := marshalJSON(o.values[key], "")
+		if err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+		buf.Write(keyJSON)
+		buf.WriteByte(':')
+		buf.Write(valJSON)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrderedJSON decodes the next JSON value from dec, using jsonObject for
+// objects and json.Number for numbers
+func decodeOrderedJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return tok, nil
+	}
+	switch delim {
+	case '{':
+		obj := &jsonObject{values: map[string]any{}}
+		for dec.More() {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return nil, ucerr.Wrap(err)
+			}
+			key, ok := keyTok.(string)
+			if !ok {
+				return nil, ucerr.Errorf("expected object key, got %v", keyTok)
+			}
+			val, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, ucerr.Wrap(err)
+			}
+			obj.set(key, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+		return obj, nil
+	case '[':
+		arr := []any{}
+		for dec.More() {
+			val, err := decodeOrderedJSON(dec)
+			if err != nil {
+				return nil, ucerr.Wrap(err)
+			}
+			arr = append(arr, val)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+		return arr, nil
+	}
+	return nil, ucerr.Errorf("unexpected JSON delimiter %v", delim)
+}
+
+func (o *jsonObject) delete(key string) {
+	if _, ok := o.values[key]; !ok {
+		return
+	}
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// decodeJSONResources decodes a JSON manifest, returning the root object and
+// its resources list
+func decodeJSONResources(text []byte) (*jsonObject, []any, error) {
+	dec := json.NewDecoder(bytes.NewReader(text))
+	dec.UseNumber()
+	decoded, err := decodeOrderedJSON(dec)
+	if err != nil {
+		return nil, nil, ucerr.Errorf("error decoding JSON: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, ucerr.Errorf("error decoding JSON: unexpected data after manifest object")
+	}
+	root, ok := decoded.(*jsonObject)
+	if !ok {
+		return nil, nil, ucerr.Errorf("manifest JSON must be an object")
+	}
+	resources, ok := root.values["resources"].([]any)
+	if !ok {
+		return nil, nil, ucerr.Errorf("manifest JSON does not have a resources list")
+	}
+	return root, resources, nil
+}
+
+// encodeJSON encodes a manifest decoded from text with the same indentation
+// and trailing newline as text
+func encodeJSON(root *jsonObject, text []byte) ([]byte, error) {
+	out, err := marshalJSON(root, detectIndent(text, "  "))
+	if err != nil {
+		return nil, ucerr.Errorf("error encoding JSON: %v", err)
+	}
+	return withTrailingNewline(out, text), nil
+}
+
+// setJSONResourceUUID sets resource_uuids[fqtn] on a resource entry, returning
+// whether it changed. Like in YAML manifests, an entry without a
+// resource_uuids[fqtn] isn't given one if id is its __DEFAULT UUID.
+func setJSONResourceUUID(resource *jsonObject, fqtn string, id string) bool {
+	resourceUUIDs, ok := resource.values["resource_uuids"].(*jsonObject)
+	if !ok {
+		resourceUUIDs = &jsonObject{values: map[string]any{}}
+		resource.set("resource_uuids", resourceUUIDs)
+	}
+	if existing, ok := resourceUUIDs.values[fqtn].(string); ok {
+		if existing == id {
+			return false
+		}
+	} else if defaultUUID, ok := resourceUUIDs.values["__DEFAULT"].(string); ok && defaultUUID == id {
+		return false
+	}
+	resourceUUIDs.set(fqtn, id)
+	return true
+}
+
+func updateResourceUUIDsJSON(text []byte, fqtn string, uuids map[string]string) ([]byte, int, error) {
+	root, resources, err := decodeJSONResources(text)
+	if err != nil {
+		return nil, 0, ucerr.Wrap(err)
+	}
+
+	changed := 0
+	for _, r := range resources {
+		resource, ok := r.(*jsonObject)
+		if !ok {
+			continue
+		}
+		manifestID, ok := resource.values["manifest_id"].(string)
+		if !ok {
+			continue
+		}
+		id, ok := uuids[manifestID]
+		if !ok {
+			continue
+		}
+		if setJSONResourceUUID(resource, fqtn, id) {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return text, 0, nil
+	}
+
+	out, err := encodeJSON(root, text)
+	if err != nil {
+		return nil, 0, ucerr.Wrap(err)
+	}
+	return out, changed, nil
+}
+
+// SyncResources takes the text of a manifest file and updates it to match
+// resources, which are the file's entries after they were changed in memory
+// (e.g. by MergeLiveResources), plus any new entries to add to the file.
+// Entries are matched by manifest ID. On each existing entry, resource_uuids[fqtn]
+// is set, attributes whose values differ are replaced, and attributes that are
+// no longer set are removed; everything else in the file is left as it was, as
+// far as the format allows. Entries that aren't in the file yet are appended to
+// its resources list. It returns the updated text along with the number of
+// entries that were changed or added; if nothing needed to change, the
+// original text is returned.
+func SyncResources(text []byte, format string, fqtn string, resources []Resource) ([]byte, int, error) {
+	switch format {
+	case ".json":
+		return syncResourcesJSON(text, fqtn, resources)
+	case ".yaml":
+		return syncResourcesYAML(text, fqtn, resources)
+	}
+	return nil, 0, ucerr.Errorf("unsupported manifest format %s, must be .json or .yaml", format)
+}
+
+// sameValue returns true if a and b are equal once encoded as JSON, so that
+// e.g. a json.Number and a float64 with the same value are considered equal
+func sameValue(a any, b any) bool {
+	normalize := func(v any) (any, bool) {
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var out any
+		if err := json.Unmarshal(encoded, &out); err != nil {
+			return nil, false
+		}
+		return out, true
+	}
+	na, ok := normalize(a)
+	if !ok {
+		return false
+	}
+	nb, ok := normalize(b)
+	if !ok {
+		return false
+	}
+	return reflect.DeepEqual(na, nb)
+}
+
+// unseenKeys returns the keys of attributes that aren't in seen, sorted
+func unseenKeys(attributes map[string]any, seen map[string]bool) []string {
+	var keys []string
+	for key := range attributes {
+		if !seen[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// syncYAMLAttributes updates the attributes of the resource entry at index i
+// of the resources list to match attributes, returning whether anything
+// changed
+func (e *yamlEditor) syncYAMLAttributes(i int, attributes map[string]any) (bool, error) {
+	entry := e.resources.Content[i]
+	k := yamlMappingIndex(entry, "attributes")
+	if k < 0 || !isYAMLBlockMapping(entry.Content[k+1]) {
+		if k >= 0 {
+			var existing map[string]any
+			if err := entry.Content[k+1].Decode(&existing); err == nil && sameValue(existing, attributes) {
+				return false, nil
+			}
+		}
+		val, err := yamlValue(attributes, nil)
+		if err != nil {
+			return false, ucerr.Wrap(err)
+		}
+		return true, ucerr.Wrap(e.setEntryValue(i, "attributes", val))
+	}
+
+	attrs := entry.Content[k+1]
+	attrsEnd := e.pairEnd(entry, k, e.entryEnd(i))
+	changed := false
+	seen := map[string]bool{}
+	for j := 0; j+1 < len(attrs.Content); j += 2 {
+		keyNode, valNode := attrs.Content[j], attrs.Content[j+1]
+		val, ok := attributes[keyNode.Value]
+		if !ok {
+			e.deletePair(attrs, j, attrsEnd)
+			changed = true
+			continue
+		}
+		seen[keyNode.Value] = true
+		var existing any
+		if err := valNode.Decode(&existing); err == nil && sameValue(existing, val) {
+			continue
+		}
+		replacement, err := yamlValue(val, valNode)
+		if err != nil {
+			return false, ucerr.Wrap(err)
+		}
+		if err := e.replacePair(attrs, j, attrsEnd, replacement); err != nil {
+			return false, ucerr.Wrap(err)
+		}
+		changed = true
+	}
+	var added []*yaml.Node
+	for _, key := range unseenKeys(attributes, seen) {
+		val, err := yamlValue(attributes[key], nil)
+		if err != nil {
+			return false, ucerr.Wrap(err)
+		}
+		added = append(added, yamlKey(key, nil), val)
+	}
+	if len(added) > 0 {
+		if err := e.appendPairs(attrs, attrsEnd, added); err != nil {
+			return false, ucerr.Wrap(err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// appendYAMLEntries adds resources to the end of the resources list, formatted
+// like the entries already in it
+func (e *yamlEditor) appendYAMLEntries(resources []Resource) error {
+	var nodes []*yaml.Node
+	for _, r := range resources {
+		node := &yaml.Node{}
+		if err := node.Encode(r); err != nil {
+			return ucerr.Errorf("error encoding YAML: %v", err)
+		}
+		nodes = append(nodes, node)
+	}
+
+	if len(e.resources.Content) == 0 || e.resources.Style&yaml.FlowStyle != 0 {
+		// e.g. `resources: []`: replace it with a block sequence
+		replacement := &yaml.Node{Kind: yaml.SequenceNode}
+		replacement.Content = append(append(replacement.Content, e.resources.Content...), nodes...)
+		return ucerr.Wrap(e.replacePair(e.root, yamlMappingIndex(e.root, "resources"), e.numLines, replacement))
+	}
+
+	last := e.resources.Content[len(e.resources.Content)-1]
+	prefix := e.linePrefix(last)
+	if strings.TrimSpace(prefix) != "-" {
+		prefix = strings.Repeat(" ", last.Column-1)
+	}
+	var lines []string
+	for _, node := range nodes {
+		rendered, err := e.render(prefix, node)
+		if err != nil {
+			return ucerr.Wrap(err)
+		}
+		lines = append(lines, rendered...)
+	}
+	at := e.resourcesEnd()
+	e.splice(at, at, lines)
+	return nil
+}
+
+func syncResourcesYAML(text []byte, fqtn string, resources []Resource) ([]byte, int, error) {
+	e, err := newYAMLEditor(text)
+	if err != nil {
+		return nil, 0, ucerr.Wrap(err)
+	}
+	entries := map[string]int{}
+	for i, entry := range e.resources.Content {
+		if manifestID := yamlMappingValue(entry, "manifest_id"); manifestID != nil {
+			entries[manifestID.Value] = i
+		}
+	}
+
+	changed := 0
+	var added []Resource
+	for _, r := range resources {
+		i, ok := entries[r.ManifestID]
+		if !ok {
+			added = append(added, r)
+			continue
+		}
+		// Attributes are edited first, since appending to them and adding a
+		// resource_uuids map can insert lines at the same place
+		entryChanged, err := e.syncYAMLAttributes(i, r.Attributes)
+		if err != nil {
+			return nil, 0, ucerr.Wrap(err)
+		}
+		if id := r.ResourceUUIDs[fqtn]; id != "" {
+			uuidChanged, err := e.setYAMLResourceUUID(i, fqtn, id)
+			if err != nil {
+				return nil, 0, ucerr.Wrap(err)
+			}
+			entryChanged = entryChanged || uuidChanged
+		}
+		if entryChanged {
+			changed++
+		}
+	}
+	if len(added) > 0 {
+		if err := e.appendYAMLEntries(added); err != nil {
+			return nil, 0, ucerr.Wrap(err)
+		}
+		changed += len(added)
+	}
+	if changed == 0 {
+		return text, 0, nil
+	}
+	return e.bytes(), changed, nil
+}
+
+// syncJSONAttributes updates the attributes of a resource entry to match
+// attributes, returning whether anything changed
+func syncJSONAttributes(resource *jsonObject, attributes map[string]any) bool {
+	attrs, ok := resource.values["attributes"].(*jsonObject)
+	if !ok {
+		resource.set("attributes", attributes)
+		return true
+	}
+
+	changed := false
+	seen := map[string]bool{}
+	for _, key := range append([]string{}, attrs.keys...) {
+		val, ok := attributes[key]
+		if !ok {
+			attrs.delete(key)
+			changed = true
+			continue
+		}
+		seen[key] = true
+		if !sameValue(attrs.values[key], val) {
+			attrs.set(key, val)
+			changed = true
+		}
+	}
+	for _, key := range unseenKeys(attributes, seen) {
+		attrs.set(key, attributes[key])
+		changed = true
+	}
+	return changed
+}
+
+func syncResourcesJSON(text []byte, fqtn string, resources []Resource) ([]byte, int, error) {
+	root, resourcesList, err := decodeJSONResources(text)
+	if err != nil {
+		return nil, 0, ucerr.Wrap(err)
+	}
+	entries := map[string]*jsonObject{}
+	for _, r := range resourcesList {
+		entry, ok := r.(*jsonObject)
+		if !ok {
+			continue
+		}
+		if manifestID, ok := entry.values["manifest_id"].(string); ok {
+			entries[manifestID] = entry
+		}
+	}
+
+	changed := 0
+	for _, r := range resources {
+		entry, ok := entries[r.ManifestID]
+		if !ok {
+			resourcesList = append(resourcesList, r)
+			changed++
+			continue
+		}
+		entryChanged := syncJSONAttributes(entry, r.Attributes)
+		if id := r.ResourceUUIDs[fqtn]; id != "" && setJSONResourceUUID(entry, fqtn, id) {
+			entryChanged = true
+		}
+		if entryChanged {
+			changed++
+		}
+	}
+	if changed == 0 {
+		return text, 0, nil
+	}
+
+	root.set("resources", resourcesList)
+	out, err := encodeJSON(root, text)
+	if err != nil {
+		return nil, 0, ucerr.Wrap(err)
+	}
+	return out, changed, nil
+}
@@ -0,0 +1,353 @@
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"userclouds.com/infra/assert"
+)
+
+func TestUpdateResourceUUIDsYAML(t *testing.T) {
+	text := `# Columns for the users table
+resources:
+    - uc_terraform_type: userstore_column
+      manifest_id: email # keep in sync with the accessor below
+      resource_uuids:
+        __DEFAULT: fe20fd48-a006-4ad8-9208-4aad540d8794
+      attributes:
+        name: email
+        type: string
+    - uc_terraform_type: userstore_column
+      manifest_id: phone
+      resource_uuids:
+        __DEFAULT: c860a6d7-c632-4f81-8f5f-597290a9f437
+        mycompany-prod: 633fac47-c6c1-4459-93e0-0bb4043e60a0
+      attributes:
+        name: phone
+        type: string
+`
+	updated, changed, err := UpdateResourceUUIDs([]byte(text), ".yaml", "mycompany-prod", map[string]string{
+		"email": "dc42da22-4c49-459d-9572-3b5db6d61959",
+		"phone": "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+	})
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 1)
+	assert.Equal(t, string(updated), `# Columns for the users table
+resources:
+    - uc_terraform_type: userstore_column
+      manifest_id: email # keep in sync with the accessor below
+      resource_uuids:
+        __DEFAULT: fe20fd48-a006-4ad8-9208-4aad540d8794
+        mycompany-prod: dc42da22-4c49-459d-9572-3b5db6d61959
+      attributes:
+        name: email
+        type: string
+    - uc_terraform_type: userstore_column
+      manifest_id: phone
+      resource_uuids:
+        __DEFAULT: c860a6d7-c632-4f81-8f5f-597290a9f437
+        mycompany-prod: 633fac47-c6c1-4459-93e0-0bb4043e60a0
+      attributes:
+        name: phone
+        type: string
+`)
+
+	// Nothing to change: the text should come back untouched
+	again, changed, err := UpdateResourceUUIDs(updated, ".yaml", "mycompany-prod", map[string]string{
+		"email": "dc42da22-4c49-459d-9572-3b5db6d61959",
+	})
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 0)
+	assert.Equal(t, string(again), string(updated))
+}
+
+func TestUpdateResourceUUIDsYAMLPreservesText(t *testing.T) {
+	// Not the way yaml.Marshal would write it: a list at column 0, 2-space
+	// indentation, blank lines, and quoted strings
+	text := `resources:
+- uc_terraform_type: userstore_column
+  manifest_id: email
+
+  resource_uuids:
+    "__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"
+
+  attributes:
+    name: 'email'
+    type: "string"
+
+# Phone numbers aren't verified
+- uc_terraform_type: userstore_column
+  manifest_id: phone
+  attributes:
+    name: phone
+
+- uc_terraform_type: userstore_column
+  manifest_id: address
+  resource_uuids: {__DEFAULT: 5e8ddf5b-5d0a-4dcb-b7bf-8d8ee6d1a8b0}
+  attributes:
+    name: address
+`
+	updated, changed, err := UpdateResourceUUIDs([]byte(text), ".yaml", "mycompany-prod", map[string]string{
+		"email":   "dc42da22-4c49-459d-9572-3b5db6d61959",
+		"phone":   "c860a6d7-c632-4f81-8f5f-597290a9f437",
+		"address": "5e8ddf5b-5d0a-4dcb-b7bf-8d8ee6d1a8b0",
+	})
+	assert.NoErr(t, err)
+	// address already has this UUID as its __DEFAULT, so it isn't recorded
+	assert.Equal(t, changed, 2)
+	assert.Equal(t, string(updated), `resources:
+- uc_terraform_type: userstore_column
+  manifest_id: email
+
+  resource_uuids:
+    "__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"
+    "mycompany-prod": "dc42da22-4c49-459d-9572-3b5db6d61959"
+
+  attributes:
+    name: 'email'
+    type: "string"
+
+# Phone numbers aren't verified
+- uc_terraform_type: userstore_column
+  manifest_id: phone
+  attributes:
+    name: phone
+  resource_uuids:
+    mycompany-prod: c860a6d7-c632-4f81-8f5f-597290a9f437
+
+- uc_terraform_type: userstore_column
+  manifest_id: address
+  resource_uuids: {__DEFAULT: 5e8ddf5b-5d0a-4dcb-b7bf-8d8ee6d1a8b0}
+  attributes:
+    name: address
+`)
+}
+
+func TestSyncResourcesYAMLPreservesText(t *testing.T) {
+	text := `resources:
+- uc_terraform_type: userstore_column
+  manifest_id: email
+
+  attributes:
+    name: "email"
+    # Switch to a structured type once there is one
+    type: string
+
+    index_type: none
+`
+	updated, changed, err := SyncResources([]byte(text), ".yaml", "mycompany-prod", []Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email",
+			Attributes:          map[string]any{"name": "email", "index_type": "indexed", "is_array": false},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "phone",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+			Attributes:          map[string]any{"name": "phone"},
+		},
+	})
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 2)
+	assert.Equal(t, string(updated), `resources:
+- uc_terraform_type: userstore_column
+  manifest_id: email
+
+  attributes:
+    name: "email"
+
+    index_type: indexed
+    is_array: false
+- uc_terraform_type: userstore_column
+  manifest_id: phone
+  resource_uuids:
+    __DEFAULT: c860a6d7-c632-4f81-8f5f-597290a9f437
+  attributes:
+    name: phone
+`)
+}
+
+func TestUpdateResourceUUIDsJSON(t *testing.T) {
+	text := `{
+  "resources": [
+    {
+      "uc_terraform_type": "userstore_column",
+      "manifest_id": "email",
+      "resource_uuids": {
+        "__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+        "mycompany-prod": "dc42da22-4c49-459d-9572-3b5db6d61959"
+      },
+      "attributes": {
+        "type": "string",
+        "name": "email",
+        "index_type": "none",
+        "constraints": {
+          "unique_required": true
+        }
+      }
+    }
+  ]
+}
+`
+	updated, changed, err := UpdateResourceUUIDs([]byte(text), ".json", "mycompany-prod", map[string]string{
+		"email": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+	})
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 1)
+	assert.Equal(t, string(updated), `{
+  "resources": [
+    {
+      "uc_terraform_type": "userstore_column",
+      "manifest_id": "email",
+      "resource_uuids": {
+        "__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+        "mycompany-prod": "fe20fd48-a006-4ad8-9208-4aad540d8794"
+      },
+      "attributes": {
+        "type": "string",
+        "name": "email",
+        "index_type": "none",
+        "constraints": {
+          "unique_required": true
+        }
+      }
+    }
+  ]
+}
+`)
+}
+
+func TestUpdateResourceUUIDsJSONPreservesText(t *testing.T) {
+	text := `{
+  "resources": [
+    {
+      "uc_terraform_type": "access_policy_template",
+      "manifest_id": "allow_adults",
+      "resource_uuids": {
+        "__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+        "mycompany-prod": "dc42da22-4c49-459d-9572-3b5db6d61959"
+      },
+      "attributes": {
+        "name": "allow_adults",
+        "function": "function policy(context, params) { return params.age > 18 && params.age < 200; }",
+        "description": "<b>adults</b> & their data",
+        "version": 1.50
+      }
+    }
+  ]
+}
+`
+	updated, changed, err := UpdateResourceUUIDs([]byte(text), ".json", "mycompany-prod", map[string]string{
+		"allow_adults": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+	})
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 1)
+	// everything except the updated UUID should be byte-for-byte unchanged
+	assert.Equal(t, string(updated), strings.Replace(text,
+		`"mycompany-prod": "dc42da22-4c49-459d-9572-3b5db6d61959"`,
+		`"mycompany-prod": "fe20fd48-a006-4ad8-9208-4aad540d8794"`, 1))
+}
+
+func TestSyncResourcesYAML(t *testing.T) {
+	text := `# Columns for the user profile
+resources:
+    # The user's email address
+    - uc_terraform_type: userstore_column
+      manifest_id: email
+      resource_uuids:
+        __DEFAULT: fe20fd48-a006-4ad8-9208-4aad540d8794
+      attributes:
+        name: email
+        type: string # no structured type yet
+        index_type: none
+`
+	resources := []Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794", "mycompany-prod": "dc42da22-4c49-459d-9572-3b5db6d61959"},
+			Attributes:          map[string]any{"name": "email", "type": "string", "index_type": "indexed"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "phone",
+			ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+			Attributes:          map[string]any{"name": "phone"},
+		},
+	}
+	updated, changed, err := SyncResources([]byte(text), ".yaml", "mycompany-prod", resources)
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 2)
+	assert.Equal(t, string(updated), `# Columns for the user profile
+resources:
+    # The user's email address
+    - uc_terraform_type: userstore_column
+      manifest_id: email
+      resource_uuids:
+        __DEFAULT: fe20fd48-a006-4ad8-9208-4aad540d8794
+        mycompany-prod: dc42da22-4c49-459d-9572-3b5db6d61959
+      attributes:
+        name: email
+        type: string # no structured type yet
+        index_type: indexed
+    - uc_terraform_type: userstore_column
+      manifest_id: phone
+      resource_uuids:
+        __DEFAULT: c860a6d7-c632-4f81-8f5f-597290a9f437
+      attributes:
+        name: phone
+`)
+
+	// Syncing again shouldn't change anything
+	again, changed, err := SyncResources(updated, ".yaml", "mycompany-prod", resources)
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 0)
+	assert.Equal(t, string(again), string(updated))
+}
+
+func TestSyncResourcesJSON(t *testing.T) {
+	text := `{
+  "variables": {
+    "region": {
+      "__DEFAULT": "us-east-1"
+    }
+  },
+  "resources": [
+    {
+      "uc_terraform_type": "userstore_column",
+      "manifest_id": "email",
+      "resource_uuids": {
+        "__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"
+      },
+      "attributes": {
+        "name": "email",
+        "type": "string",
+        "index_type": "none",
+        "default_value": "@VAR(\"region\")"
+      }
+    }
+  ]
+}
+`
+	updated, changed, err := SyncResources([]byte(text), ".json", "mycompany-prod", []Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "email",
+		ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		Attributes:          map[string]any{"name": "email", "type": "string", "index_type": "indexed", "default_value": `@VAR("region")`},
+	}})
+	assert.NoErr(t, err)
+	assert.Equal(t, changed, 1)
+	assert.Equal(t, string(updated), strings.Replace(text, `"index_type": "none"`, `"index_type": "indexed"`, 1))
+}
+
+func TestTenantResourceUUIDs(t *testing.T) {
+	mfest := Manifest{Resources: []Resource{
+		{ManifestID: "a", ResourceUUIDs: map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"}},
+		{ManifestID: "b", ResourceUUIDs: map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794", "prod": "633fac47-c6c1-4459-93e0-0bb4043e60a0"}},
+	}}
+	assert.Equal(t, mfest.TenantResourceUUIDs("prod"), map[string]string{
+		"a": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+		"b": "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+	})
+}
@@ -0,0 +1,372 @@
+package plan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/resourcetypes"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/infra/ucerr"
+)
+
+// Action describes what applying a manifest would do to a resource
+type Action string
+
+// Actions that can be taken on a resource
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	// ActionReplace deletes the live resource and creates it again, for
+	// changes to attributes that can't be updated in place
+	ActionReplace Action = "replace"
+	ActionDelete  Action = "delete"
+)
+
+// AttributeChange describes a single top-level attribute whose value differs
+// between the live tenant and the manifest. Before is nil for attributes that
+// are only set in the manifest, and After is nil for attributes that are only
+// set on the live resource.
+type AttributeChange struct {
+	Attribute string `json:"attribute" yaml:"attribute"`
+	Before    any    `json:"before" yaml:"before"`
+	After     any    `json:"after" yaml:"after"`
+}
+
+// ResourceChange describes a resource that would be created, updated,
+// replaced, or deleted by applying a manifest
+type ResourceChange struct {
+	Action              Action `json:"action" yaml:"action"`
+	TerraformTypeSuffix string `json:"uc_terraform_type" yaml:"uc_terraform_type"`
+	// ManifestID is blank for live resources that don't match any manifest
+	// entry (i.e. resources that will be deleted)
+	ManifestID   string            `json:"manifest_id,omitempty" yaml:"manifest_id,omitempty"`
+	ResourceUUID string            `json:"resource_uuid" yaml:"resource_uuid"`
+	Name         string            `json:"name,omitempty" yaml:"name,omitempty"`
+	Attributes   []AttributeChange `json:"attributes" yaml:"attributes"`
+}
+
+// Plan stores the set of changes needed to bring a live tenant in line with a
+// manifest
+type Plan struct {
+	FQTN    string           `json:"fqtn" yaml:"fqtn"`
+	Changes []ResourceChange `json:"changes" yaml:"changes"`
+}
+
+// Counts returns the number of resources that would be created, updated,
+// replaced, and deleted.
+func (p *Plan) Counts() (creates int, updates int, replaces int, deletes int) {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ActionCreate:
+			creates++
+		case ActionUpdate:
+			updates++
+		case ActionReplace:
+			replaces++
+		case ActionDelete:
+			deletes++
+		}
+	}
+	return creates, updates, replaces, deletes
+}
+
+// HasChanges returns true if applying the manifest would change anything.
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > 0
+}
+
+// normalize converts a value into the same representation that we'd get if we
+// decoded it from JSON, so that e.g. ints from YAML manifests compare equal to
+// float64s from JSON manifests, and pointers in live resources compare equal
+// to the values they point to.
+func normalize(val any) (any, error) {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	var out any
+	if err := json.Unmarshal(b, &out); err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	return out, nil
+}
+
+// isEmpty returns true for values that the UC API treats the same as an
+// omitted value. Live resources omit optional attributes with empty values
+// (see liveresource.MakeLiveResource), so a manifest that explicitly says e.g.
+// `is_array: false` shouldn't be treated as different from the live resource.
+func isEmpty(val any) bool {
+	if val == nil {
+		return true
+	}
+	v := reflect.ValueOf(val)
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// equivalent compares two normalized values, treating empty and missing values
+// as equal.
+func equivalent(a any, b any) bool {
+	if isEmpty(a) && isEmpty(b) {
+		return true
+	}
+	aMap, aIsMap := a.(map[string]any)
+	bMap, bIsMap := b.(map[string]any)
+	if aIsMap && bIsMap {
+		for k := range aMap {
+			if !equivalent(aMap[k], bMap[k]) {
+				return false
+			}
+		}
+		for k := range bMap {
+			if _, ok := aMap[k]; !ok && !equivalent(nil, bMap[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	aSlice, aIsSlice := a.([]any)
+	bSlice, bIsSlice := b.([]any)
+	if aIsSlice && bIsSlice {
+		if len(aSlice) != len(bSlice) {
+			return false
+		}
+		for i := range aSlice {
+			if !equivalent(aSlice[i], bSlice[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sortedKeys(maps ...map[string]any) []string {
+	seen := map[string]bool{}
+	var keys []string
+	for _, m := range maps {
+		for k := range m {
+			if !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func resourceName(attributes map[string]any) string {
+	if name, ok := attributes["name"].(string); ok {
+		return name
+	}
+	return ""
+}
+
+// resolveManifestAttributes returns the attributes of a manifest resource with
+// all function invocations resolved, normalized for comparison against live
+// resources.
+func resolveManifestAttributes(resource *manifest.Resource, ctx *tfconfig.GenerationContext) (map[string]any, error) {
+	resolved, err := tfconfig.ResolveValue(resource.Attributes, ctx.ForResource(resource))
+	if err != nil {
+		return nil, ucerr.Errorf("Manifest ID %s: %v", resource.ManifestID, err)
+	}
+	normalized, err := normalize(resolved)
+	if err != nil {
+		return nil, ucerr.Errorf("Manifest ID %s: %v", resource.ManifestID, err)
+	}
+	out, _ := normalized.(map[string]any)
+	return out, nil
+}
+
+// diffAttributes returns the changes needed to go from the live attributes to
+// the manifest attributes. Both maps must already be normalized.
+func diffAttributes(live map[string]any, desired map[string]any) []AttributeChange {
+	changes := []AttributeChange{}
+	for _, key := range sortedKeys(live, desired) {
+		if !equivalent(live[key], desired[key]) {
+			changes = append(changes, AttributeChange{
+				Attribute: key,
+				Before:    live[key],
+				After:     desired[key],
+			})
+		}
+	}
+	return changes
+}
+
+// forcesReplacement returns true if any of the changes is to an attribute that
+// the resource type can't update in place
+func forcesReplacement(resourceType resourcetypes.ResourceType, changes []AttributeChange) bool {
+	for _, c := range changes {
+		for _, attr := range resourceType.ReplaceAttributes {
+			if c.Attribute == attr {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Compute compares the manifest against the live resources in ctx and returns
+// the changes that applying the manifest would make. The live resources must
+// already have been matched against the manifest using
+// Manifest.MatchLiveResources.
+func Compute(ctx *tfconfig.GenerationContext) (*Plan, error) {
+	p := &Plan{FQTN: ctx.FQTN, Changes: []ResourceChange{}}
+
+	liveByManifestID := map[string]*liveresource.Resource{}
+	for i, r := range *ctx.LiveResources {
+		if !r.IsSystem && r.ManifestID != "" {
+			liveByManifestID[r.ManifestID] = &(*ctx.LiveResources)[i]
+		}
+	}
+
+	for i := range ctx.Manifest.Resources {
+		resource := &ctx.Manifest.Resources[i]
+		if !resource.AppliesToTenant(ctx.FQTN) {
+			continue
+		}
+		desired, err := resolveManifestAttributes(resource, ctx)
+		if err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+
+		live, ok := liveByManifestID[resource.ManifestID]
+		if !ok {
+			resourceUUID := resource.ResourceUUIDs[ctx.FQTN]
+			if resourceUUID == "" {
+				resourceUUID = resource.ResourceUUIDs["__DEFAULT"]
+			}
+			p.Changes = append(p.Changes, ResourceChange{
+				Action:              ActionCreate,
+				TerraformTypeSuffix: resource.TerraformTypeSuffix,
+				ManifestID:          resource.ManifestID,
+				ResourceUUID:        resourceUUID,
+				Name:                resourceName(desired),
+				Attributes:          diffAttributes(map[string]any{}, desired),
+			})
+			continue
+		}
+
+		normalizedLive, err := normalize(live.Attributes)
+		if err != nil {
+			return nil, ucerr.Errorf("error normalizing live %s resource %s: %v", live.TerraformTypeSuffix, live.ResourceUUID, err)
+		}
+		liveAttributes, _ := normalizedLive.(map[string]any)
+		// Live resources never include attributes that the resource type
+		// omits (e.g. derived names), so don't compare them
+		comparable := desired
+		resourceType := resourcetypes.GetByTerraformTypeSuffix(resource.TerraformTypeSuffix)
+		if resourceType != nil {
+			comparable = liveresource.OmitManifestAttributes(*resourceType, desired)
+		}
+		if changes := diffAttributes(liveAttributes, comparable); len(changes) > 0 {
+			action := ActionUpdate
+			if resourceType != nil && forcesReplacement(*resourceType, changes) {
+				action = ActionReplace
+			}
+			p.Changes = append(p.Changes, ResourceChange{
+				Action:              action,
+				TerraformTypeSuffix: resource.TerraformTypeSuffix,
+				ManifestID:          resource.ManifestID,
+				ResourceUUID:        live.ResourceUUID,
+				Name:                resourceName(desired),
+				Attributes:          changes,
+			})
+		}
+	}
+
+	var deletes []ResourceChange
+	for _, r := range *ctx.LiveResources {
+		if r.IsSystem || r.ManifestID != "" {
+			continue
+		}
+		normalizedLive, err := normalize(r.Attributes)
+		if err != nil {
+			return nil, ucerr.Errorf("error normalizing live %s resource %s: %v", r.TerraformTypeSuffix, r.ResourceUUID, err)
+		}
+		liveAttributes, _ := normalizedLive.(map[string]any)
+		deletes = append(deletes, ResourceChange{
+			Action:              ActionDelete,
+			TerraformTypeSuffix: r.TerraformTypeSuffix,
+			ResourceUUID:        r.ResourceUUID,
+			Name:                resourceName(liveAttributes),
+			Attributes:          diffAttributes(liveAttributes, map[string]any{}),
+		})
+	}
+	sort.SliceStable(deletes, func(i int, j int) bool {
+		if deletes[i].TerraformTypeSuffix != deletes[j].TerraformTypeSuffix {
+			return deletes[i].TerraformTypeSuffix < deletes[j].TerraformTypeSuffix
+		}
+		return deletes[i].ResourceUUID < deletes[j].ResourceUUID
+	})
+	p.Changes = append(p.Changes, deletes...)
+
+	return p, nil
+}
+
+// FormatValue renders an attribute value for display, as JSON, or "(unset)"
+// for nil.
+func FormatValue(val any) string {
+	if val == nil {
+		return "(unset)"
+	}
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%v", val)
+	}
+	return string(b)
+}
+
+// WriteText writes a human-readable rendering of the plan to w.
+func (p *Plan) WriteText(w io.Writer) error {
+	symbols := map[Action]string{
+		ActionCreate:  "+",
+		ActionUpdate:  "~",
+		ActionReplace: "-/+",
+		ActionDelete:  "-",
+	}
+	for _, c := range p.Changes {
+		label := c.ManifestID
+		if label == "" {
+			label = c.Name
+		}
+		if label == "" {
+			label = c.ResourceUUID
+		}
+		if _, err := fmt.Fprintf(w, "%s %s %s (%s, id %s)\n", symbols[c.Action], c.TerraformTypeSuffix, label, c.Action, c.ResourceUUID); err != nil {
+			return ucerr.Wrap(err)
+		}
+		for _, a := range c.Attributes {
+			var line string
+			switch c.Action {
+			case ActionCreate:
+				line = fmt.Sprintf("    + %s = %s\n", a.Attribute, FormatValue(a.After))
+			case ActionDelete:
+				line = fmt.Sprintf("    - %s = %s\n", a.Attribute, FormatValue(a.Before))
+			default:
+				line = fmt.Sprintf("    ~ %s: %s -> %s\n", a.Attribute, FormatValue(a.Before), FormatValue(a.After))
+			}
+			if _, err := io.WriteString(w, line); err != nil {
+				return ucerr.Wrap(err)
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return ucerr.Wrap(err)
+		}
+	}
+	creates, updates, replaces, deletes := p.Counts()
+	if _, err := fmt.Fprintf(w, "Plan for %s: %d to create, %d to update, %d to replace, %d to delete.\n", p.FQTN, creates, updates, replaces, deletes); err != nil {
+		return ucerr.Wrap(err)
+	}
+	return nil
+}
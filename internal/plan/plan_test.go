@@ -0,0 +1,207 @@
+package plan
+
+import (
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/tfconfig"
+	"userclouds.com/infra/assert"
+)
+
+func TestCompute(t *testing.T) {
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{
+			// Unchanged (live omits the empty is_array attribute)
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "unchanged",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "col1", "index_type": "none", "is_array": false},
+			},
+			// Updated
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "updated",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+				Attributes:          map[string]any{"name": "col2", "index_type": "unique"},
+			},
+			// Created, referencing another manifest resource
+			{
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "created",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "633fac47-c6c1-4459-93e0-0bb4043e60a0"},
+				Attributes: map[string]any{
+					"name":    "acc",
+					"columns": []any{map[string]any{"column": `@UC_MANIFEST_ID("unchanged").id`}},
+				},
+			},
+		},
+	}
+	live := []liveresource.Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "unchanged",
+			ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+			Attributes:          map[string]any{"name": "col1", "index_type": "none"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "updated",
+			ResourceUUID:        "c860a6d7-c632-4f81-8f5f-597290a9f437",
+			Attributes:          map[string]any{"name": "col2", "index_type": "none"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "dc42da22-4c49-459d-9572-3b5db6d61959",
+			Attributes:          map[string]any{"name": "col3"},
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "78733010-2a5b-469e-924e-50258db84db9",
+			IsSystem:            true,
+			Attributes:          map[string]any{"name": "id"},
+		},
+	}
+
+	p, err := Compute(&tfconfig.GenerationContext{
+		Manifest:      &mfest,
+		FQTN:          "prod",
+		LiveResources: &live,
+	})
+	assert.NoErr(t, err)
+	creates, updates, replaces, deletes := p.Counts()
+	assert.Equal(t, creates, 1)
+	assert.Equal(t, updates, 1)
+	assert.Equal(t, replaces, 0)
+	assert.Equal(t, deletes, 1)
+
+	assert.Equal(t, p.Changes[0].Action, ActionUpdate)
+	assert.Equal(t, p.Changes[0].ManifestID, "updated")
+	assert.Equal(t, p.Changes[0].Attributes, []AttributeChange{{Attribute: "index_type", Before: "none", After: "unique"}})
+
+	assert.Equal(t, p.Changes[1].Action, ActionCreate)
+	assert.Equal(t, p.Changes[1].ManifestID, "created")
+	assert.Equal(t, p.Changes[1].ResourceUUID, "633fac47-c6c1-4459-93e0-0bb4043e60a0")
+	assert.Equal(t, p.Changes[1].Attributes[0].Attribute, "columns")
+	assert.Equal(t, p.Changes[1].Attributes[0].After, []any{map[string]any{"column": "fe20fd48-a006-4ad8-9208-4aad540d8794"}})
+
+	assert.Equal(t, p.Changes[2].Action, ActionDelete)
+	assert.Equal(t, p.Changes[2].ResourceUUID, "dc42da22-4c49-459d-9572-3b5db6d61959")
+	assert.Equal(t, p.Changes[2].Name, "col3")
+}
+
+func TestComputeNumericTypes(t *testing.T) {
+	// YAML manifests decode numbers as ints, while live resources may use any
+	// numeric type. These should not show up as changes.
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{{
+			TerraformTypeSuffix: "userstore_column_soft_deleted_retention_duration",
+			ManifestID:          "retention",
+			ResourceUUIDs:       map[string]string{"prod": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+			Attributes:          map[string]any{"duration": map[string]any{"unit": "day", "duration": 30}},
+		}},
+	}
+	duration := 30.0
+	live := []liveresource.Resource{{
+		TerraformTypeSuffix: "userstore_column_soft_deleted_retention_duration",
+		ManifestID:          "retention",
+		ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+		Attributes:          map[string]any{"duration": map[string]any{"unit": "day", "duration": &duration}},
+	}}
+	p, err := Compute(&tfconfig.GenerationContext{Manifest: &mfest, FQTN: "prod", LiveResources: &live})
+	assert.NoErr(t, err)
+	assert.False(t, p.HasChanges())
+}
+
+func TestComputeSkipsExcludedResources(t *testing.T) {
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "debug_col",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "debug"},
+				ExceptTenants:       []string{"prod"},
+			},
+		},
+	}
+	live := []liveresource.Resource{}
+	p, err := Compute(&tfconfig.GenerationContext{Manifest: &mfest, FQTN: "prod", LiveResources: &live})
+	assert.NoErr(t, err)
+	assert.False(t, p.HasChanges())
+
+	p, err = Compute(&tfconfig.GenerationContext{Manifest: &mfest, FQTN: "staging", LiveResources: &live})
+	assert.NoErr(t, err)
+	assert.Equal(t, len(p.Changes), 1)
+	assert.Equal(t, p.Changes[0].Action, ActionCreate)
+}
+
+func TestComputeReplacements(t *testing.T) {
+	// A column's data type can't be changed in place, so the column has to be
+	// deleted and created again
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email_col",
+			ResourceUUIDs:       map[string]string{"prod": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+			Attributes:          map[string]any{"name": "email", "data_type": "d26b6d52-a8d7-4c2a-9efc-394eb90a3294"},
+		}},
+	}
+	live := []liveresource.Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "email_col",
+		ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+		Attributes:          map[string]any{"name": "email", "data_type": "3f65ba3b-2fed-4d0e-8d3f-12c1e7d01cd5"},
+	}}
+	p, err := Compute(&tfconfig.GenerationContext{Manifest: &mfest, FQTN: "prod", LiveResources: &live})
+	assert.NoErr(t, err)
+	assert.Equal(t, len(p.Changes), 1)
+	assert.Equal(t, p.Changes[0].Action, ActionReplace)
+	_, updates, replaces, _ := p.Counts()
+	assert.Equal(t, updates, 0)
+	assert.Equal(t, replaces, 1)
+}
+
+func TestWriteText(t *testing.T) {
+	p := Plan{
+		FQTN: "mycompany-prod",
+		Changes: []ResourceChange{{
+			Action:              ActionUpdate,
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email_col",
+			ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+			Attributes:          []AttributeChange{{Attribute: "index_type", Before: "none", After: "indexed"}},
+		}},
+	}
+	var b strings.Builder
+	assert.NoErr(t, p.WriteText(&b))
+	assert.Equal(t, b.String(), `~ userstore_column email_col (update, id fe20fd48-a006-4ad8-9208-4aad540d8794)
+    ~ index_type: "none" -> "indexed"
+
+Plan for mycompany-prod: 0 to create, 1 to update, 0 to replace, 0 to delete.
+`)
+}
+
+func TestComputeIgnoresOmittedAttributes(t *testing.T) {
+	// Live resources never include attributes that the resource type omits,
+	// so setting them in the manifest shouldn't show up as a change
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "email_col",
+			ResourceUUIDs:       map[string]string{"prod": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+			Attributes:          map[string]any{"name": "email", "camel_case_name": "Email"},
+		}},
+	}
+	live := []liveresource.Resource{{
+		TerraformTypeSuffix: "userstore_column",
+		ManifestID:          "email_col",
+		ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+		Attributes:          map[string]any{"name": "email"},
+	}}
+	p, err := Compute(&tfconfig.GenerationContext{Manifest: &mfest, FQTN: "prod", LiveResources: &live})
+	assert.NoErr(t, err)
+	assert.False(t, p.HasChanges())
+}
@@ -0,0 +1,117 @@
+package profile
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// Profile stores the settings for accessing a single tenant. At most one of
+// ClientSecret, ClientSecretFile, and ClientSecretCommand may be set.
+type Profile struct {
+	TenantURL string `yaml:"tenant_url"`
+	ClientID  string `yaml:"client_id"`
+	// FQTN optionally sets the fully-qualified tenant name, for tenants behind
+	// a custom domain
+	FQTN         string `yaml:"fqtn,omitempty"`
+	ClientSecret string `yaml:"client_secret,omitempty"`
+	// ClientSecretFile is the path to a file containing the client secret.
+	// Relative paths are relative to the profiles file.
+	ClientSecretFile string `yaml:"client_secret_file,omitempty"`
+	// ClientSecretCommand is a shell command that prints the client secret,
+	// e.g. a call to a password manager CLI
+	ClientSecretCommand string `yaml:"client_secret_command,omitempty"`
+}
+
+// File is the top-level object of a profiles file
+type File struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+	// Path is the file that the profiles were loaded from
+	Path string `yaml:"-"`
+}
+
+// DefaultPath returns the path that profiles are read from if no other path is
+// given: $XDG_CONFIG_HOME/ucconfig/profiles.yaml, or
+// ~/.config/ucconfig/profiles.yaml if XDG_CONFIG_HOME isn't set.
+func DefaultPath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", ucerr.Wrap(err)
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "ucconfig", "profiles.yaml"), nil
+}
+
+// Load reads a profiles file
+func Load(path string) (*File, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ucerr.Errorf("error reading profiles file %s: %v", path, err)
+	}
+	f := &File{}
+	if err := yaml.Unmarshal(text, f); err != nil {
+		return nil, ucerr.Errorf("error decoding YAML in profiles file %s: %v", path, err)
+	}
+	f.Path = path
+	return f, nil
+}
+
+// Get returns the profile with the given name
+func (f *File) Get(name string) (*Profile, error) {
+	p, ok := f.Profiles[name]
+	if !ok {
+		names := []string{}
+		for n := range f.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, ucerr.Errorf("profile \"%s\" is not defined in %s (defined profiles: %s)", name, f.Path, strings.Join(names, ", "))
+	}
+	numSecretSources := 0
+	for _, s := range []string{p.ClientSecret, p.ClientSecretFile, p.ClientSecretCommand} {
+		if s != "" {
+			numSecretSources++
+		}
+	}
+	if numSecretSources > 1 {
+		return nil, ucerr.Errorf("profile \"%s\" in %s may only set one of client_secret, client_secret_file, and client_secret_command", name, f.Path)
+	}
+	if p.ClientSecretFile != "" && !filepath.IsAbs(p.ClientSecretFile) {
+		p.ClientSecretFile = filepath.Join(filepath.Dir(f.Path), p.ClientSecretFile)
+	}
+	return &p, nil
+}
+
+// ResolveClientSecret returns the client secret for the profile, reading it
+// from ClientSecretFile or running ClientSecretCommand if needed. Leading and
+// trailing whitespace is trimmed from secrets read from a file or command. It
+// returns an empty string if the profile doesn't set a client secret.
+func (p *Profile) ResolveClientSecret(ctx context.Context) (string, error) {
+	switch {
+	case p.ClientSecretFile != "":
+		secret, err := os.ReadFile(p.ClientSecretFile)
+		if err != nil {
+			return "", ucerr.Errorf("error reading client secret file %s: %v", p.ClientSecretFile, err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	case p.ClientSecretCommand != "":
+		cmd := exec.CommandContext(ctx, "sh", "-c", p.ClientSecretCommand)
+		cmd.Stderr = os.Stderr
+		secret, err := cmd.Output()
+		if err != nil {
+			return "", ucerr.Errorf("error running client secret command \"%s\": %v", p.ClientSecretCommand, err)
+		}
+		return strings.TrimSpace(string(secret)), nil
+	}
+	return p.ClientSecret, nil
+}
@@ -0,0 +1,59 @@
+package profile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"userclouds.com/infra/assert"
+)
+
+func TestProfiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "profiles.yaml")
+	assert.NoErr(t, os.WriteFile(path, []byte(`
+profiles:
+  dev:
+    tenant_url: https://mycompany-dev.tenant.userclouds.com
+    client_id: dev-client
+    client_secret: dev-secret
+  staging:
+    tenant_url: https://mycompany-staging.tenant.userclouds.com
+    client_id: staging-client
+    client_secret_file: secrets/staging
+  prod:
+    tenant_url: https://mycompany-prod.tenant.userclouds.com
+    client_id: prod-client
+    client_secret_command: echo prod-secret
+  broken:
+    client_secret: a
+    client_secret_command: echo b
+`), 0644))
+	assert.NoErr(t, os.MkdirAll(filepath.Join(dir, "secrets"), 0755))
+	assert.NoErr(t, os.WriteFile(filepath.Join(dir, "secrets", "staging"), []byte("staging-secret\n"), 0600))
+
+	f, err := Load(path)
+	assert.NoErr(t, err)
+
+	for name, want := range map[string]string{"dev": "dev-secret", "staging": "staging-secret", "prod": "prod-secret"} {
+		p, err := f.Get(name)
+		assert.NoErr(t, err)
+		secret, err := p.ResolveClientSecret(ctx)
+		assert.NoErr(t, err)
+		assert.Equal(t, secret, want)
+	}
+
+	p, err := f.Get("dev")
+	assert.NoErr(t, err)
+	assert.Equal(t, p.TenantURL, "https://mycompany-dev.tenant.userclouds.com")
+	assert.Equal(t, p.ClientID, "dev-client")
+
+	_, err = f.Get("broken")
+	assert.NotNil(t, err)
+	_, err = f.Get("missing")
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "dev, prod, staging"))
+}
@@ -0,0 +1,123 @@
+package resourcetypes
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+
+	"github.com/gofrs/uuid"
+
+	"userclouds.com/idp/userstore"
+	"userclouds.com/infra/ucerr"
+)
+
+// ResourceData stores what we need to create, update, or delete a resource
+// through the UC API
+type ResourceData struct {
+	ID uuid.UUID
+	// Version is the current version of versioned resources (e.g. accessors),
+	// which must be sent back in update requests. Zero for new resources.
+	Version int
+	// Attributes uses the same representation as manifest and live resource
+	// attributes, i.e. keyed by API JSON field names, with references to other
+	// resources represented as UUID strings.
+	Attributes map[string]any
+}
+
+var resourceIDType = reflect.TypeOf(userstore.ResourceID{})
+
+// jsonFields maps the JSON keys of a struct type to the types of the
+// corresponding fields, including fields promoted from embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	out := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			for k, v := range jsonFields(field.Type) {
+				out[k] = v
+			}
+			continue
+		}
+		key := strings.Split(tag, ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		out[key] = field.Type
+	}
+	return out
+}
+
+// toAPIValue converts an attribute value into a value that will JSON-decode
+// into type t. This reverses liveresource.transformValue, which flattens
+// userstore.ResourceIDs into UUID strings.
+func toAPIValue(val any, t reflect.Type) any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == resourceIDType {
+		if s, ok := val.(string); ok {
+			return map[string]any{"id": s}
+		}
+		return val
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		items, ok := val.([]any)
+		if !ok {
+			return val
+		}
+		out := make([]any, len(items))
+		for i := range items {
+			out[i] = toAPIValue(items[i], t.Elem())
+		}
+		return out
+	case reflect.Map:
+		m, ok := val.(map[string]any)
+		if !ok {
+			return val
+		}
+		out := map[string]any{}
+		for k, v := range m {
+			out[k] = toAPIValue(v, t.Elem())
+		}
+		return out
+	case reflect.Struct:
+		m, ok := val.(map[string]any)
+		if !ok {
+			return val
+		}
+		fields := jsonFields(t)
+		out := map[string]any{}
+		for k, v := range m {
+			if fieldType, ok := fields[k]; ok {
+				out[k] = toAPIValue(v, fieldType)
+			} else {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	return val
+}
+
+// decodeAs converts resource data into the UC API model type T
+func decodeAs[T any](data ResourceData) (T, error) {
+	var out T
+	attributes := map[string]any{}
+	for k, v := range data.Attributes {
+		attributes[k] = v
+	}
+	attributes["id"] = data.ID.String()
+	if data.Version != 0 {
+		attributes["version"] = data.Version
+	}
+	serialized, err := json.Marshal(toAPIValue(attributes, reflect.TypeOf(out)))
+	if err != nil {
+		return out, ucerr.Wrap(err)
+	}
+	if err := json.Unmarshal(serialized, &out); err != nil {
+		return out, ucerr.Errorf("error decoding attributes into %T: %v", out, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,34 @@
+package resourcetypes
+
+import (
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"userclouds.com/idp/userstore"
+	"userclouds.com/infra/assert"
+)
+
+func TestDecodeAs(t *testing.T) {
+	accessor, err := decodeAs[userstore.Accessor](ResourceData{
+		ID:      uuid.Must(uuid.FromString("633fac47-c6c1-4459-93e0-0bb4043e60a0")),
+		Version: 2,
+		Attributes: map[string]any{
+			"name":          "acc",
+			"access_policy": "3f380e42-0b21-4570-a312-91e1b80386fa",
+			"columns": []any{map[string]any{
+				"column":      "fe20fd48-a006-4ad8-9208-4aad540d8794",
+				"transformer": "c0b5b2a1-0b1f-4b9f-8b1a-1b1f4b9f8b1a",
+			}},
+			"purposes": []any{"12b3f133-4ad1-4f11-9d7d-313eb7cb95fa"},
+		},
+	})
+	assert.NoErr(t, err)
+	assert.Equal(t, accessor.ID.String(), "633fac47-c6c1-4459-93e0-0bb4043e60a0")
+	assert.Equal(t, accessor.Version, 2)
+	assert.Equal(t, accessor.Name, "acc")
+	assert.Equal(t, accessor.AccessPolicy.ID.String(), "3f380e42-0b21-4570-a312-91e1b80386fa")
+	assert.Equal(t, accessor.Columns[0].Column.ID.String(), "fe20fd48-a006-4ad8-9208-4aad540d8794")
+	assert.Equal(t, accessor.Columns[0].Transformer.ID.String(), "c0b5b2a1-0b1f-4b9f-8b1a-1b1f4b9f8b1a")
+	assert.Equal(t, accessor.Purposes[0].ID.String(), "12b3f133-4ad1-4f11-9d7d-313eb7cb95fa")
+}
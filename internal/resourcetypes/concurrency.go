@@ -0,0 +1,110 @@
+package resourcetypes
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// DefaultConcurrency is the number of UC API calls that are made at once when
+// fetching live resources, unless a different limit is set with
+// WithConcurrency
+const DefaultConcurrency = 8
+
+type concurrencyKey struct{}
+
+type holdsSlotKey struct{}
+
+// WithConcurrency returns a context that limits fetching live resources to n
+// concurrent UC API calls in total. The limit is shared by nested calls to
+// RunConcurrently (e.g. the per-column calls for column retention durations,
+// which run while fetching a resource type).
+func WithConcurrency(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, concurrencyKey{}, make(chan struct{}, max(n, 1)))
+}
+
+// slots returns the semaphore set with WithConcurrency, or a new one with
+// DefaultConcurrency slots if none was set
+func slots(ctx context.Context) chan struct{} {
+	if s, ok := ctx.Value(concurrencyKey{}).(chan struct{}); ok {
+		return s
+	}
+	return make(chan struct{}, DefaultConcurrency)
+}
+
+// Concurrency returns the limit set with WithConcurrency, or
+// DefaultConcurrency if none was set
+func Concurrency(ctx context.Context) int {
+	return cap(slots(ctx))
+}
+
+// RunConcurrently calls fn for each index in [0, n), with calls running
+// concurrently as long as the total number of running calls (including those
+// of any RunConcurrently call that this one is nested in) stays within
+// Concurrency(ctx). fn is passed a context to use for nested calls to
+// RunConcurrently, so that they share the limit. Callers should store results
+// by index so that the output order doesn't depend on scheduling. Once a call
+// fails, calls that haven't started yet are skipped, and the error of the
+// lowest failing index is returned.
+func RunConcurrently(ctx context.Context, n int, fn func(ctx context.Context, i int) error) error {
+	sem := slots(ctx)
+	workerCtx := context.WithValue(context.WithValue(ctx, concurrencyKey{}, sem), holdsSlotKey{}, true)
+
+	errs := make([]error, n)
+	var next atomic.Int64
+	var failed atomic.Bool
+	exhausted := make(chan struct{})
+	var exhaustedOnce sync.Once
+	work := func() {
+		for {
+			i := int(next.Add(1) - 1)
+			if i >= n {
+				exhaustedOnce.Do(func() { close(exhausted) })
+				return
+			}
+			if failed.Load() {
+				continue
+			}
+			if err := fn(workerCtx, i); err != nil {
+				errs[i] = err
+				failed.Store(true)
+			}
+		}
+	}
+
+	// When nested in another RunConcurrently call, this goroutine already
+	// holds a slot, so it works through the indexes itself, and helpers only
+	// join in as other slots become free. Waiting for a slot here instead
+	// could deadlock once every slot is held by an outer call.
+	nestedCaller := ctx.Value(holdsSlotKey{}) != nil
+	helpers := min(cap(sem), n)
+	if nestedCaller && helpers > 0 {
+		helpers--
+	}
+	var wg sync.WaitGroup
+	for range helpers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				work()
+			case <-exhausted:
+			}
+		}()
+	}
+	if nestedCaller || n == 0 {
+		work()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return ucerr.Wrap(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package resourcetypes
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"userclouds.com/infra/assert"
+	"userclouds.com/infra/ucerr"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	ctx := WithConcurrency(context.Background(), 3)
+	assert.Equal(t, Concurrency(ctx), 3)
+	assert.Equal(t, Concurrency(context.Background()), DefaultConcurrency)
+
+	var running, maxRunning atomic.Int32
+	out := make([]int, 20)
+	err := RunConcurrently(ctx, len(out), func(_ context.Context, i int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			prev := maxRunning.Load()
+			if n <= prev || maxRunning.CompareAndSwap(prev, n) {
+				break
+			}
+		}
+		out[i] = i * i
+		return nil
+	})
+	assert.NoErr(t, err)
+	assert.True(t, maxRunning.Load() <= 3)
+	for i, v := range out {
+		assert.Equal(t, v, i*i)
+	}
+
+	// With a concurrency of 1, calls after the first failure are skipped
+	var calls atomic.Int32
+	err = RunConcurrently(WithConcurrency(context.Background(), 1), 5, func(_ context.Context, i int) error {
+		calls.Add(1)
+		if i == 1 {
+			return ucerr.Errorf("failed at %d", i)
+		}
+		return nil
+	})
+	assert.NotNil(t, err)
+	assert.Equal(t, calls.Load(), int32(2))
+
+	assert.NoErr(t, RunConcurrently(ctx, 0, func(context.Context, int) error { return nil }))
+}
+
+func TestRunConcurrentlyNested(t *testing.T) {
+	for _, limit := range []int{1, 2, 5} {
+		ctx := WithConcurrency(context.Background(), limit)
+		var outer, inner concurrencyTracker
+		var innerCalls atomic.Int32
+		err := RunConcurrently(ctx, 6, func(ctx context.Context, i int) error {
+			// The outer call holds its slot while the nested calls run, like
+			// fetching a resource type does
+			defer outer.start()()
+			return ucerr.Wrap(RunConcurrently(ctx, 10, func(context.Context, int) error {
+				defer inner.start()()
+				innerCalls.Add(1)
+				time.Sleep(time.Millisecond)
+				return nil
+			}))
+		})
+		assert.NoErr(t, err)
+		assert.Equal(t, innerCalls.Load(), int32(60))
+		assert.True(t, outer.max.Load() <= int32(limit))
+		assert.True(t, inner.max.Load() <= int32(limit))
+	}
+}
+
+// concurrencyTracker records the maximum number of calls running at once
+type concurrencyTracker struct {
+	running, max atomic.Int32
+}
+
+func (c *concurrencyTracker) start() func() {
+	n := c.running.Add(1)
+	for {
+		prev := c.max.Load()
+		if n <= prev || c.max.CompareAndSwap(prev, n) {
+			break
+		}
+	}
+	return func() { c.running.Add(-1) }
+}
@@ -4,7 +4,9 @@ import (
 	"context"
 
 	"userclouds.com/idp"
+	"userclouds.com/idp/policy"
 	"userclouds.com/idp/userstore"
+	"userclouds.com/infra/pagination"
 	"userclouds.com/infra/ucerr"
 )
 
@@ -25,20 +27,82 @@ type ResourceType struct {
 	// generation, e.g. if there are superfluous details returned in ListWhateverObject API calls
 	// that we don't need to include
 	OmitAttributes []string
+	// ReplaceAttributes lists the top-level attributes that can't be changed
+	// on an existing resource. Changing one of them deletes the resource and
+	// creates it again.
+	ReplaceAttributes []string
+	// CreateResource, UpdateResource, and DeleteResource modify resources of
+	// this type through the UC API. They are used by the native apply engine,
+	// which doesn't go through Terraform. For DeleteResource, the attributes
+	// are those of the live resource being deleted.
+	CreateResource func(ctx context.Context, client *idp.Client, data ResourceData) error
+	UpdateResource func(ctx context.Context, client *idp.Client, data ResourceData) error
+	DeleteResource func(ctx context.Context, client *idp.Client, data ResourceData) error
+}
+
+// pageLimit is the number of resources requested per page from List* calls
+const pageLimit = 100
+
+// listAllPages calls a paginated List* call with each page's cursor until
+// every page has been fetched, and returns the resources from all pages
+func listAllPages[T any](list func(opts ...idp.Option) ([]T, pagination.ResponseFields, error)) ([]T, error) {
+	var out []T
+	cursor := pagination.CursorBegin
+	for {
+		page, fields, err := list(idp.Pagination(pagination.StartingAfter(cursor), pagination.Limit(pageLimit)))
+		if err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+		out = append(out, page...)
+		if !fields.HasNext {
+			return out, nil
+		}
+		if fields.Next == cursor {
+			return nil, ucerr.Errorf("List call returned the same cursor %v for the next page", cursor)
+		}
+		cursor = fields.Next
+	}
+}
+
+func toAnySlice[T any](items []T) []any {
+	out := make([]any, 0, len(items))
+	for _, item := range items {
+		out = append(out, item)
+	}
+	return out
+}
+
+func listColumns(ctx context.Context, client *idp.Client) ([]userstore.Column, error) {
+	return listAllPages(func(opts ...idp.Option) ([]userstore.Column, pagination.ResponseFields, error) {
+		response, err := client.ListColumns(ctx, opts...)
+		if err != nil {
+			return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+		}
+		return response.Data, response.ResponseFields, nil
+	})
 }
 
 func getColumnRetentions(ctx context.Context, client *idp.Client, dt userstore.DataLifeCycleState) ([]any, error) {
-	response, err := client.ListColumns(ctx)
+	columns, err := listColumns(ctx, client)
 	if err != nil {
 		return nil, ucerr.Wrap(err)
 	}
-	out := []any{}
-	for _, column := range response.Data {
-		retentionResponse, err := client.GetColumnRetentionDurationsForColumn(ctx, dt, column.ID)
+	// Fetch the retentions for each column concurrently, keeping them in
+	// column order
+	retentionsByColumn := make([][]userstore.ColumnRetentionDuration, len(columns))
+	if err := RunConcurrently(ctx, len(columns), func(ctx context.Context, i int) error {
+		retentionResponse, err := client.GetColumnRetentionDurationsForColumn(ctx, dt, columns[i].ID)
 		if err != nil {
-			return nil, ucerr.Wrap(err)
+			return ucerr.Wrap(err)
 		}
-		for _, retention := range retentionResponse.RetentionDurations {
+		retentionsByColumn[i] = retentionResponse.RetentionDurations
+		return nil
+	}); err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	out := []any{}
+	for _, retentions := range retentionsByColumn {
+		for _, retention := range retentions {
 			if retention.UseDefault {
 				// Skip default retentions inherited from elsewhere
 				continue
@@ -49,6 +113,36 @@ func getColumnRetentions(ctx context.Context, client *idp.Client, dt userstore.D
 	return out, nil
 }
 
+func createColumnRetention(ctx context.Context, client *idp.Client, dt userstore.DataLifeCycleState, data ResourceData) error {
+	retention, err := decodeAs[userstore.ColumnRetentionDuration](data)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	_, err = client.CreateColumnRetentionDurationForColumn(ctx, dt, retention.ColumnID, retention)
+	return ucerr.Wrap(err)
+}
+
+func updateColumnRetention(ctx context.Context, client *idp.Client, dt userstore.DataLifeCycleState, data ResourceData) error {
+	retention, err := decodeAs[userstore.ColumnRetentionDuration](data)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	_, err = client.UpdateColumnRetentionDurationForColumn(ctx, dt, retention.ColumnID, data.ID, retention)
+	return ucerr.Wrap(err)
+}
+
+func deleteColumnRetention(ctx context.Context, client *idp.Client, dt userstore.DataLifeCycleState, data ResourceData) error {
+	retention, err := decodeAs[userstore.ColumnRetentionDuration](data)
+	if err != nil {
+		return ucerr.Wrap(err)
+	}
+	return ucerr.Wrap(client.DeleteColumnRetentionDurationForColumn(ctx, dt, retention.ColumnID, data.ID))
+}
+
+// Passing this version to the tokenizer Delete* calls deletes all versions of
+// a versioned object
+const allVersions = -1
+
 var omitRetentionAttributes = []string{
 	// The default is computed from tenant/purpose retention settings (i.e. subject to change, would
 	// create TF drift) and only used display in the console UI.
@@ -63,15 +157,17 @@ var ResourceTypes = []ResourceType{
 	{
 		TerraformTypeSuffix: "userstore_column_data_type",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.ListDataTypes(ctx)
+			dataTypes, err := listAllPages(func(opts ...idp.Option) ([]userstore.ColumnDataType, pagination.ResponseFields, error) {
+				response, err := client.ListDataTypes(ctx, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, dataType := range response.Data {
-				out = append(out, dataType)
-			}
-			return out, nil
+			return toAnySlice(dataTypes), nil
 		},
 		OmitAttributes: []string{
 			// these are fields that are derived in the backend from the provided name
@@ -81,19 +177,34 @@ var ResourceTypes = []ResourceType{
 		References: map[string]string{
 			"composite_attributes.fields.data_type": "userstore_column_data_type",
 		},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			dataType, err := decodeAs[userstore.ColumnDataType](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.CreateDataType(ctx, dataType)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			dataType, err := decodeAs[userstore.ColumnDataType](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.UpdateDataType(ctx, data.ID, dataType)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.DeleteDataType(ctx, data.ID))
+		},
 	},
 	{
 		TerraformTypeSuffix: "userstore_column",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.ListColumns(ctx)
+			columns, err := listColumns(ctx, client)
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, column := range response.Data {
-				out = append(out, column)
-			}
-			return out, nil
+			return toAnySlice(columns), nil
 		},
 		OmitAttributes: []string{
 			// these are fields that are derived in the backend from the provided name
@@ -103,6 +214,26 @@ var ResourceTypes = []ResourceType{
 		References: map[string]string{
 			"data_type": "userstore_column_data_type",
 		},
+		ReplaceAttributes: []string{"data_type", "is_array"},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			column, err := decodeAs[userstore.Column](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.CreateColumn(ctx, column)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			column, err := decodeAs[userstore.Column](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.UpdateColumn(ctx, data.ID, column)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.DeleteColumn(ctx, data.ID))
+		},
 	},
 	{
 		TerraformTypeSuffix: "userstore_column_soft_deleted_retention_duration",
@@ -113,20 +244,32 @@ var ResourceTypes = []ResourceType{
 			"column_id":  "userstore_column",
 			"purpose_id": "userstore_purpose",
 		},
-		OmitAttributes: omitRetentionAttributes,
+		OmitAttributes:    omitRetentionAttributes,
+		ReplaceAttributes: []string{"column_id", "purpose_id"},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return createColumnRetention(ctx, client, userstore.DataLifeCycleStateSoftDeleted, data)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return updateColumnRetention(ctx, client, userstore.DataLifeCycleStateSoftDeleted, data)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return deleteColumnRetention(ctx, client, userstore.DataLifeCycleStateSoftDeleted, data)
+		},
 	},
 	{
 		TerraformTypeSuffix: "userstore_accessor",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.ListAccessors(ctx, false)
+			accessors, err := listAllPages(func(opts ...idp.Option) ([]userstore.Accessor, pagination.ResponseFields, error) {
+				response, err := client.ListAccessors(ctx, false, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, d := range response.Data {
-				out = append(out, d)
-			}
-			return out, nil
+			return toAnySlice(accessors), nil
 		},
 		References: map[string]string{
 			"access_policy":       "access_policy",
@@ -134,16 +277,42 @@ var ResourceTypes = []ResourceType{
 			"columns.transformer": "transformer",
 			"purposes":            "userstore_purpose",
 		},
+		ReplaceAttributes: []string{"columns"},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			accessor, err := decodeAs[userstore.Accessor](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.CreateAccessor(ctx, accessor)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			accessor, err := decodeAs[userstore.Accessor](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.UpdateAccessor(ctx, data.ID, accessor)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.DeleteAccessor(ctx, data.ID))
+		},
 	},
 	{
 		TerraformTypeSuffix: "userstore_mutator",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.ListMutators(ctx, false)
+			mutators, err := listAllPages(func(opts ...idp.Option) ([]userstore.Mutator, pagination.ResponseFields, error) {
+				response, err := client.ListMutators(ctx, false, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
 			out := []any{}
-			for _, d := range response.Data {
+			for _, d := range mutators {
 				// TODO: this is a temporary workaround to suppress duplicate validator/normalizer fields
 				// Only keep normalizer, remove when server no longer returns validator
 				for i := range d.Columns {
@@ -158,70 +327,154 @@ var ResourceTypes = []ResourceType{
 			"columns.column":     "userstore_column",
 			"columns.normalizer": "transformer",
 		},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			mutator, err := decodeAs[userstore.Mutator](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.CreateMutator(ctx, mutator)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			mutator, err := decodeAs[userstore.Mutator](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.UpdateMutator(ctx, data.ID, mutator)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.DeleteMutator(ctx, data.ID))
+		},
 	},
 	{
 		TerraformTypeSuffix: "userstore_purpose",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.ListPurposes(ctx)
+			purposes, err := listAllPages(func(opts ...idp.Option) ([]userstore.Purpose, pagination.ResponseFields, error) {
+				response, err := client.ListPurposes(ctx, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, d := range response.Data {
-				out = append(out, d)
+			return toAnySlice(purposes), nil
+		},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			purpose, err := decodeAs[userstore.Purpose](data)
+			if err != nil {
+				return ucerr.Wrap(err)
 			}
-			return out, nil
+			_, err = client.CreatePurpose(ctx, purpose)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			purpose, err := decodeAs[userstore.Purpose](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.UpdatePurpose(ctx, purpose)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.DeletePurpose(ctx, data.ID))
 		},
 	},
 	{
 		TerraformTypeSuffix: "access_policy",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.TokenizerClient.ListAccessPolicies(ctx, false)
+			accessPolicies, err := listAllPages(func(opts ...idp.Option) ([]policy.AccessPolicy, pagination.ResponseFields, error) {
+				response, err := client.TokenizerClient.ListAccessPolicies(ctx, false, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, d := range response.Data {
-				out = append(out, d)
-			}
-			return out, nil
+			return toAnySlice(accessPolicies), nil
 		},
 		References: map[string]string{
 			"components.policy":   "access_policy",
 			"components.template": "access_policy_template",
 		},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			accessPolicy, err := decodeAs[policy.AccessPolicy](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.TokenizerClient.CreateAccessPolicy(ctx, accessPolicy)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			accessPolicy, err := decodeAs[policy.AccessPolicy](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.TokenizerClient.UpdateAccessPolicy(ctx, accessPolicy)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.TokenizerClient.DeleteAccessPolicy(ctx, data.ID, allVersions))
+		},
 	},
 	{
 		TerraformTypeSuffix: "access_policy_template",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.TokenizerClient.ListAccessPolicyTemplates(ctx, false)
+			templates, err := listAllPages(func(opts ...idp.Option) ([]policy.AccessPolicyTemplate, pagination.ResponseFields, error) {
+				response, err := client.TokenizerClient.ListAccessPolicyTemplates(ctx, false, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, d := range response.Data {
-				out = append(out, d)
-			}
-			return out, nil
+			return toAnySlice(templates), nil
 		},
 		WriteAttributesExternally: map[string]string{
 			// The JS function should be stored separately to facilitate linting
 			// and syntax highlighting
 			"function": ".js",
 		},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			template, err := decodeAs[policy.AccessPolicyTemplate](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.TokenizerClient.CreateAccessPolicyTemplate(ctx, template)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			template, err := decodeAs[policy.AccessPolicyTemplate](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.TokenizerClient.UpdateAccessPolicyTemplate(ctx, template)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.TokenizerClient.DeleteAccessPolicyTemplate(ctx, data.ID, allVersions))
+		},
 	},
 	{
 		TerraformTypeSuffix: "transformer",
 		ListResources: func(ctx context.Context, client *idp.Client) ([]any, error) {
-			response, err := client.TokenizerClient.ListTransformers(ctx)
+			transformers, err := listAllPages(func(opts ...idp.Option) ([]policy.Transformer, pagination.ResponseFields, error) {
+				response, err := client.TokenizerClient.ListTransformers(ctx, opts...)
+				if err != nil {
+					return nil, pagination.ResponseFields{}, ucerr.Wrap(err)
+				}
+				return response.Data, response.ResponseFields, nil
+			})
 			if err != nil {
 				return nil, ucerr.Wrap(err)
 			}
-			out := []any{}
-			for _, d := range response.Data {
-				out = append(out, d)
-			}
-			return out, nil
+			return toAnySlice(transformers), nil
 		},
 		References: map[string]string{
 			"input_data_type":  "userstore_column_data_type",
@@ -232,6 +485,25 @@ var ResourceTypes = []ResourceType{
 			// and syntax highlighting
 			"function": ".js",
 		},
+		CreateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			transformer, err := decodeAs[policy.Transformer](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.TokenizerClient.CreateTransformer(ctx, transformer)
+			return ucerr.Wrap(err)
+		},
+		UpdateResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			transformer, err := decodeAs[policy.Transformer](data)
+			if err != nil {
+				return ucerr.Wrap(err)
+			}
+			_, err = client.TokenizerClient.UpdateTransformer(ctx, data.ID, transformer)
+			return ucerr.Wrap(err)
+		},
+		DeleteResource: func(ctx context.Context, client *idp.Client, data ResourceData) error {
+			return ucerr.Wrap(client.TokenizerClient.DeleteTransformer(ctx, data.ID))
+		},
 	},
 }
 
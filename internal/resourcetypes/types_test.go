@@ -0,0 +1,77 @@
+package resourcetypes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofrs/uuid"
+
+	"userclouds.com/idp"
+	"userclouds.com/idp/userstore"
+	"userclouds.com/infra/assert"
+)
+
+// newPaginatedColumnServer returns a server that lists the given columns two
+// at a time, and records the starting_after cursor of each request
+func newPaginatedColumnServer(t *testing.T, ids []uuid.UUID, cursors *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startingAfter := r.URL.Query().Get("starting_after")
+		*cursors = append(*cursors, startingAfter)
+		start := 0
+		for i, id := range ids {
+			if startingAfter == "id:"+id.String() {
+				start = i + 1
+			}
+		}
+		end := min(start+2, len(ids))
+		data := []map[string]any{}
+		for i := start; i < end; i++ {
+			data = append(data, map[string]any{"id": ids[i].String(), "name": fmt.Sprintf("col%d", i)})
+		}
+		response := map[string]any{"data": data, "has_next": end < len(ids)}
+		if end < len(ids) {
+			response["next"] = "id:" + ids[end-1].String()
+		}
+		// Failures are reported in the response rather than with t, which
+		// mustn't be used to fail the test outside of its own goroutine; the
+		// client then returns an error that the test asserts on
+		body, err := json.Marshal(response)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err := w.Write(body); err != nil {
+			t.Logf("failed to write response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestListResourcesFetchesAllPages(t *testing.T) {
+	var ids []uuid.UUID
+	for range 5 {
+		ids = append(ids, uuid.Must(uuid.NewV4()))
+	}
+	var cursors []string
+	server := newPaginatedColumnServer(t, ids, &cursors)
+	client, err := idp.NewClient(server.URL, idp.OrganizationID(uuid.Nil), idp.JSONClient())
+	assert.NoErr(t, err)
+
+	resources, err := GetByTerraformTypeSuffix("userstore_column").ListResources(context.Background(), client)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(resources), len(ids))
+	for i, r := range resources {
+		assert.Equal(t, r.(userstore.Column).ID, ids[i])
+	}
+	// One request per page, each starting after the last column of the
+	// previous page
+	assert.Equal(t, len(cursors), 3)
+	assert.Equal(t, cursors[1], "id:"+ids[1].String())
+	assert.Equal(t, cursors[2], "id:"+ids[3].String())
+}
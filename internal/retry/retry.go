@@ -0,0 +1,192 @@
+// Package retry provides an http.RoundTripper that retries UC API requests
+// that fail with transient errors, so that a single 502 or rate limit doesn't
+// abort fetching a tenant's live resources.
+package retry
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"userclouds.com/infra/ucerr"
+	"userclouds.com/infra/uclog"
+)
+
+// Defaults for the delay between retries
+const (
+	DefaultBaseDelay = 500 * time.Millisecond
+	DefaultMaxDelay  = 30 * time.Second
+)
+
+// Transport is an http.RoundTripper that retries requests that get a rate
+// limit (429) response, a server error (5xx) response, or a network error,
+// with exponential backoff and jitter. A Retry-After header in the response
+// overrides the backoff. Server and network errors are only retried for
+// idempotent requests (e.g. GET, or fetching an access token), since the
+// server may have acted on others.
+type Transport struct {
+	// Base makes the actual requests. If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+	// MaxRetries is the number of times a request is retried before giving up
+	MaxRetries int
+	// RequestTimeout, if set, limits how long each attempt may take
+	RequestTimeout time.Duration
+	// BaseDelay is the maximum delay before the first retry, which doubles
+	// with each retry up to MaxDelay. The actual delay is chosen randomly up
+	// to that maximum.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// NewHTTPClient returns an HTTP client that uses a Transport with the given
+// settings and the default delays
+func NewHTTPClient(maxRetries int, requestTimeout time.Duration) *http.Client {
+	return &http.Client{Transport: &Transport{
+		MaxRetries:     maxRetries,
+		RequestTimeout: requestTimeout,
+		BaseDelay:      DefaultBaseDelay,
+		MaxDelay:       DefaultMaxDelay,
+	}}
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base == nil {
+		return http.DefaultTransport
+	}
+	return t.Base
+}
+
+// cancelOnClose cancels the context of a request once its response body is
+// closed, since cancelling it earlier would abort reading the body
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return ucerr.Wrap(err)
+}
+
+// roundTrip makes a single attempt at a request, applying RequestTimeout
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	if t.RequestTimeout <= 0 {
+		resp, err := t.base().RoundTrip(req)
+		return resp, ucerr.Wrap(err)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.RequestTimeout)
+	resp, err := t.base().RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, ucerr.Wrap(err)
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// tokenPath is the OIDC token endpoint. Requesting a token with client
+// credentials doesn't change anything, so it can be retried like a read even
+// though it is a POST.
+const tokenPath = "/oidc/token"
+
+func isIdempotent(req *http.Request) bool {
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, tokenPath) {
+		return true
+	}
+	return req.Method == http.MethodGet || req.Method == http.MethodHead || req.Method == http.MethodOptions
+}
+
+// shouldRetry returns true if a request that got the given response or error
+// may be retried
+func shouldRetry(req *http.Request, resp *http.Response, err error) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		// The body can't be sent again
+		return false
+	}
+	if err != nil {
+		return isIdempotent(req)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	return resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented && isIdempotent(req)
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(header); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// backoff returns the delay before the given retry (starting from 0)
+func (t *Transport) backoff(retry int) time.Duration {
+	maxDelay := t.BaseDelay
+	for range retry {
+		maxDelay *= 2
+		if maxDelay >= t.MaxDelay {
+			maxDelay = t.MaxDelay
+			break
+		}
+	}
+	if maxDelay <= 0 {
+		return 0
+	}
+	return rand.N(maxDelay) + 1
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	for retry := 0; ; retry++ {
+		attemptReq := req
+		if retry > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, ucerr.Wrap(err)
+			}
+			attemptReq = req.Clone(ctx)
+			attemptReq.Body = body
+		}
+		resp, err := t.roundTrip(attemptReq)
+		if retry >= t.MaxRetries || ctx.Err() != nil || !shouldRetry(req, resp, err) {
+			return resp, ucerr.Wrap(err)
+		}
+
+		delay := t.backoff(retry)
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = min(retryAfter, t.MaxDelay)
+			}
+			// Drain the body so that the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		uclog.Warningf(ctx, "%s %s failed (%s), retrying in %v (retry %d of %d)", req.Method, req.URL.Path, reason, delay.Round(time.Millisecond), retry+1, t.MaxRetries)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ucerr.Wrap(ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
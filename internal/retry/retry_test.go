@@ -0,0 +1,115 @@
+package retry
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"userclouds.com/infra/assert"
+	"userclouds.com/test/testlogtransport"
+)
+
+func newTestClient(maxRetries int) *http.Client {
+	return &http.Client{Transport: &Transport{
+		MaxRetries: maxRetries,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   10 * time.Millisecond,
+	}}
+}
+
+// newFlakyServer returns a server that responds with the given status codes
+// in order, and then with 200
+func newFlakyServer(t *testing.T, headers http.Header, statuses ...int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(requests.Add(1))
+		if n <= len(statuses) {
+			for k, v := range headers {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n-1])
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("ok"), body...))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestRetriesTransientErrors(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	server, requests := newFlakyServer(t, nil, http.StatusBadGateway, http.StatusServiceUnavailable)
+	resp, err := newTestClient(3).Get(server.URL)
+	assert.NoErr(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	assert.Equal(t, requests.Load(), int32(3))
+}
+
+func TestGivesUpAfterMaxRetries(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	server, requests := newFlakyServer(t, nil, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	resp, err := newTestClient(1).Get(server.URL)
+	assert.NoErr(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusBadGateway)
+	assert.Equal(t, requests.Load(), int32(2))
+}
+
+func TestDoesNotRetryClientErrorsOrNonIdempotentServerErrors(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	server, requests := newFlakyServer(t, nil, http.StatusBadRequest)
+	resp, err := newTestClient(3).Get(server.URL)
+	assert.NoErr(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusBadRequest)
+	assert.Equal(t, requests.Load(), int32(1))
+
+	server, requests = newFlakyServer(t, nil, http.StatusBadGateway)
+	resp, err = newTestClient(3).Post(server.URL, "application/json", strings.NewReader("{}"))
+	assert.NoErr(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusBadGateway)
+	assert.Equal(t, requests.Load(), int32(1))
+}
+
+func TestRetriesTokenRequests(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	server, requests := newFlakyServer(t, nil, http.StatusBadGateway)
+	resp, err := newTestClient(3).Post(server.URL+"/oidc/token", "application/x-www-form-urlencoded", strings.NewReader("grant_type=client_credentials"))
+	assert.NoErr(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	assert.Equal(t, requests.Load(), int32(2))
+}
+
+func TestRetriesRateLimitedRequestsWithBody(t *testing.T) {
+	testlogtransport.InitLoggerAndTransportsForTests(t)
+	server, requests := newFlakyServer(t, http.Header{"Retry-After": []string{"0"}}, http.StatusTooManyRequests)
+	resp, err := newTestClient(3).Post(server.URL, "application/json", strings.NewReader("{}"))
+	assert.NoErr(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoErr(t, err)
+	assert.Equal(t, string(body), "ok{}")
+	assert.Equal(t, requests.Load(), int32(2))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d, ok := parseRetryAfter("5", now)
+	assert.True(t, ok)
+	assert.Equal(t, d, 5*time.Second)
+	d, ok = parseRetryAfter(now.Add(10*time.Second).Format(http.TimeFormat), now)
+	assert.True(t, ok)
+	assert.Equal(t, d, 10*time.Second)
+	_, ok = parseRetryAfter("", now)
+	assert.False(t, ok)
+	_, ok = parseRetryAfter("soon", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,202 @@
+package tfconfig
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// ejectedValuesDir is the directory in an ejected module that files referenced
+// with @FILE are copied to
+const ejectedValuesDir = "values"
+
+var invalidIdentifierChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// ejectState collects the files and system objects that are referenced while
+// generating an ejected module, so that they can be written out afterwards
+type ejectState struct {
+	// copiedFiles maps source file paths to their paths in the module
+	copiedFiles map[string]string
+	usedPaths   map[string]bool
+	// systemObjects maps "<type>/<name>" to the name of the local value with
+	// the object's UUID
+	systemObjects map[string]string
+	locals        map[string]string
+}
+
+func newEjectState() *ejectState {
+	return &ejectState{
+		copiedFiles:   map[string]string{},
+		usedPaths:     map[string]bool{},
+		systemObjects: map[string]string{},
+		locals:        map[string]string{},
+	}
+}
+
+// uniqueName returns name, or name with a numeric suffix if it is already
+// used
+func uniqueName(name string, used func(string) bool) string {
+	out := name
+	for i := 2; used(out); i++ {
+		out = fmt.Sprintf("%s_%d", name, i)
+	}
+	return out
+}
+
+// systemObjectLocal returns the name of the local value that holds the UUID of
+// a system object
+func (s *ejectState) systemObjectLocal(terraformTypeSuffix string, objectName string, resourceUUID string) string {
+	key := terraformTypeSuffix + "/" + objectName
+	if name, ok := s.systemObjects[key]; ok {
+		return name
+	}
+	name := uniqueName(terraformTypeSuffix+"_"+invalidIdentifierChars.ReplaceAllString(objectName, "_"), func(n string) bool {
+		_, ok := s.locals[n]
+		return ok
+	})
+	s.systemObjects[key] = name
+	s.locals[name] = resourceUUID
+	return name
+}
+
+// fileTokens returns the tokens for reading a file that is copied into the
+// module's values directory. chomp() removes the trailing newline, like @FILE
+// does.
+func (s *ejectState) fileTokens(sourcePath string) hclwrite.Tokens {
+	modulePath, ok := s.copiedFiles[sourcePath]
+	if !ok {
+		ext := filepath.Ext(sourcePath)
+		base := strings.TrimSuffix(filepath.Base(sourcePath), ext)
+		modulePath = uniqueName(ejectedValuesDir+"/"+base, func(n string) bool { return s.usedPaths[n+ext] }) + ext
+		s.copiedFiles[sourcePath] = modulePath
+		s.usedPaths[modulePath] = true
+	}
+	// TokensForValue would escape the ${} sequence, so the path string is
+	// written out by hand
+	pathTokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenOQuote, Bytes: []byte(`"`)},
+		{Type: hclsyntax.TokenQuotedLit, Bytes: []byte("${path.module}/" + modulePath)},
+		{Type: hclsyntax.TokenCQuote, Bytes: []byte(`"`)},
+	}
+	return funcCallTokens("chomp", funcCallTokens("file", pathTokens))
+}
+
+func funcCallTokens(name string, arg hclwrite.Tokens) hclwrite.Tokens {
+	tokens := hclwrite.Tokens{
+		{Type: hclsyntax.TokenIdent, Bytes: []byte(name)},
+		{Type: hclsyntax.TokenOParen, Bytes: []byte("(")},
+	}
+	tokens = append(tokens, arg...)
+	return append(tokens, &hclwrite.Token{Type: hclsyntax.TokenCParen, Bytes: []byte(")")})
+}
+
+// EjectedModule is a standalone Terraform module generated from a manifest by
+// GenEjectedModule
+type EjectedModule struct {
+	// Files maps the paths of the generated files, relative to the module
+	// directory, to their contents
+	Files map[string]string
+	// CopiedFiles maps paths relative to the module directory to the files
+	// referenced with @FILE that should be copied there
+	CopiedFiles map[string]string
+}
+
+func varTraversal(name string) hcl.Traversal {
+	return hcl.Traversal{hcl.TraverseRoot{Name: "var"}, hcl.TraverseAttr{Name: name}}
+}
+
+var stringTypeTokens = hclwrite.TokensForTraversal(hcl.Traversal{hcl.TraverseRoot{Name: "string"}})
+
+// genEjectedVariables generates variables.tf, which declares the tenant
+// credentials that the provider is configured with
+func genEjectedVariables(tenantURL string) string {
+	file := hclwrite.NewEmptyFile()
+	tenantURLBody := file.Body().AppendNewBlock("variable", []string{"tenant_url"}).Body()
+	tenantURLBody.SetAttributeRaw("type", stringTypeTokens)
+	tenantURLBody.SetAttributeValue("default", cty.StringVal(tenantURL))
+	file.Body().AppendNewline()
+	clientIDBody := file.Body().AppendNewBlock("variable", []string{"client_id"}).Body()
+	clientIDBody.SetAttributeRaw("type", stringTypeTokens)
+	file.Body().AppendNewline()
+	clientSecretBody := file.Body().AppendNewBlock("variable", []string{"client_secret"}).Body()
+	clientSecretBody.SetAttributeRaw("type", stringTypeTokens)
+	clientSecretBody.SetAttributeValue("sensitive", cty.True)
+	return string(hclwrite.Format(file.Bytes()))
+}
+
+// GenEjectedModule generates a Terraform module from a ucconfig manifest that
+// can be maintained by hand, without ucconfig. Unlike GenConfig, resources are
+// named by their manifest IDs, files referenced with @FILE are read with
+// file() instead of being inlined, @UC_SYSTEM_OBJECT UUIDs are kept in locals,
+// the provider is configured with variables (defaulting to tenantURL for the
+// tenant URL), and the live resources that were matched to manifest entries
+// are brought under management with import blocks in imports.tf.
+func GenEjectedModule(ctx *GenerationContext, tenantURL string) (*EjectedModule, error) {
+	ejectCtx := *ctx
+	ejectCtx.eject = newEjectState()
+
+	resources := hclwrite.NewEmptyFile()
+	for _, resource := range ctx.Manifest.Resources {
+		if !resource.AppliesToTenant(ctx.FQTN) {
+			continue
+		}
+		if err := genResourceConfig(&resource, &ejectCtx, resources.Body()); err != nil {
+			return nil, ucerr.Wrap(err)
+		}
+	}
+
+	mainFile := hclwrite.NewEmptyFile()
+	mainFile.Body().
+		AppendNewBlock("terraform", []string{}).Body().
+		AppendNewBlock("required_providers", []string{}).Body().
+		SetAttributeValue("userclouds", cty.ObjectVal(map[string]cty.Value{
+			"source":  cty.StringVal("registry.terraform.io/userclouds/userclouds"),
+			"version": cty.StringVal(ctx.TFProviderVersionConstraint),
+		}))
+	mainFile.Body().AppendNewline()
+	provider := mainFile.Body().AppendNewBlock("provider", []string{"userclouds"}).Body()
+	provider.SetAttributeTraversal("tenant_url", varTraversal("tenant_url"))
+	provider.SetAttributeTraversal("client_id", varTraversal("client_id"))
+	provider.SetAttributeTraversal("client_secret", varTraversal("client_secret"))
+	mainFile.Body().AppendNewline()
+	if len(ejectCtx.eject.locals) > 0 {
+		var names []string
+		for name := range ejectCtx.eject.locals {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		locals := mainFile.Body().AppendNewBlock("locals", []string{}).Body()
+		for _, name := range names {
+			locals.SetAttributeValue(name, cty.StringVal(ejectCtx.eject.locals[name]))
+		}
+		mainFile.Body().AppendNewline()
+	}
+
+	module := &EjectedModule{
+		Files: map[string]string{
+			"main.tf":      string(hclwrite.Format(append(mainFile.Bytes(), resources.Bytes()...))),
+			"variables.tf": genEjectedVariables(tenantURL),
+		},
+		CopiedFiles: map[string]string{},
+	}
+	if ctx.LiveResources != nil {
+		imports := hclwrite.NewEmptyFile()
+		genImportBlocks(&ejectCtx, imports.Body())
+		if len(imports.Body().Blocks()) > 0 {
+			module.Files["imports.tf"] = string(hclwrite.Format(imports.Bytes()))
+		}
+	}
+	for sourcePath, modulePath := range ejectCtx.eject.copiedFiles {
+		module.CopiedFiles[modulePath] = sourcePath
+	}
+	return module, nil
+}
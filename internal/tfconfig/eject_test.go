@@ -0,0 +1,84 @@
+package tfconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+)
+
+func TestGenEjectedModule(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoErr(t, os.WriteFile(filepath.Join(dir, "transform.js"), []byte("function transform(data) { return data; }\n"), 0644))
+
+	config := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "email"},
+			},
+			{
+				TerraformTypeSuffix: "transformer",
+				ManifestID:          "email_transformer",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+				Attributes:          map[string]any{"name": "EmailTransformer", "function": `@FILE("transform.js")`},
+			},
+			{
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "get_email",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "2ee4497e-c326-4068-94ed-3dcdaaaa53bc"},
+				Attributes: map[string]any{
+					"name": "GetEmail",
+					"columns": []any{
+						map[string]any{
+							"column":      `@UC_MANIFEST_ID("email").id`,
+							"transformer": `@UC_SYSTEM_OBJECT("transformer", "PassthroughUnchangedData")`,
+						},
+					},
+				},
+			},
+		},
+	}
+	live := []liveresource.Resource{
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "email", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		{TerraformTypeSuffix: "transformer", ResourceUUID: "633fac47-c6c1-4459-93e0-0bb4043e60a0", IsSystem: true, Attributes: map[string]any{"name": "PassthroughUnchangedData"}},
+	}
+	module, err := GenEjectedModule(&GenerationContext{
+		ManifestFilePath:            filepath.Join(dir, "manifest.yaml"),
+		Manifest:                    &config,
+		FQTN:                        "mycompany-prod",
+		LiveResources:               &live,
+		TFProviderVersionConstraint: ">= 0.1.8",
+	}, "https://mycompany-prod.tenant.userclouds.com")
+	assert.NoErr(t, err)
+
+	mainTF := module.Files["main.tf"]
+	assert.True(t, strings.Contains(mainTF, `provider "userclouds" {
+  tenant_url    = var.tenant_url
+  client_id     = var.client_id
+  client_secret = var.client_secret
+}`))
+	assert.True(t, strings.Contains(mainTF, `locals {
+  transformer_PassthroughUnchangedData = "633fac47-c6c1-4459-93e0-0bb4043e60a0"
+}`))
+	assert.True(t, strings.Contains(mainTF, `resource "userclouds_userstore_column" "email" {`))
+	assert.True(t, strings.Contains(mainTF, `function = chomp(file("${path.module}/values/transform.js"))`))
+	assert.True(t, strings.Contains(mainTF, `= userclouds_userstore_column.email.id`))
+	assert.True(t, strings.Contains(mainTF, `= local.transformer_PassthroughUnchangedData`))
+	assert.False(t, strings.Contains(mainTF, "manifestid-"))
+	assert.False(t, strings.Contains(mainTF, "function transform"))
+
+	assert.True(t, strings.Contains(module.Files["variables.tf"], `default = "https://mycompany-prod.tenant.userclouds.com"`))
+	assert.True(t, strings.Contains(module.Files["variables.tf"], `sensitive = true`))
+	assert.Equal(t, strings.TrimSpace(module.Files["imports.tf"]), `import {
+  to = userclouds_userstore_column.email
+  id = "fe20fd48-a006-4ad8-9208-4aad540d8794"
+}`)
+	assert.Equal(t, module.CopiedFiles, map[string]string{"values/transform.js": filepath.Join(dir, "transform.js")})
+}
@@ -33,9 +33,31 @@ func (i *functionInvocation) dispatch(ctx *GenerationContext) (hclwrite.Tokens,
 	if i.Name == "FILE" {
 		return readFile(i, ctx)
 	}
+	if i.Name == "VAR" {
+		return variable(i, ctx)
+	}
 	return []*hclwrite.Token{}, ucerr.Errorf("unknown function %s", i.Name)
 }
 
+// resolve evaluates the function invocation to a concrete value, rather than
+// to HCL tokens. This is used when comparing manifest values against live
+// resources without going through Terraform.
+func (i *functionInvocation) resolve(ctx *GenerationContext) (any, error) {
+	if i.Name == "UC_MANIFEST_ID" {
+		return resolveUCManifestID(i, ctx)
+	}
+	if i.Name == "UC_SYSTEM_OBJECT" {
+		return resolveUCSystemObject(i, ctx)
+	}
+	if i.Name == "FILE" {
+		return resolveFile(i, ctx)
+	}
+	if i.Name == "VAR" {
+		return resolveVariable(i, ctx)
+	}
+	return nil, ucerr.Errorf("unknown function %s", i.Name)
+}
+
 func parseFunctionInvocation(invocation string) *functionInvocation {
 	baseRegex := regexp.MustCompile(`^@(?P<funcname>[A-Z_]+)\((?P<params>.*?)?\)(?P<pathsuffix>(?:\.[A-Za-z0-9_-]+)*)$`)
 	groups := baseRegex.FindStringSubmatch(invocation)
@@ -46,20 +68,22 @@ func parseFunctionInvocation(invocation string) *functionInvocation {
 		Name: groups[1],
 	}
 	params := groups[2]
-	for _, param := range strings.Split(params, ",") {
-		param = strings.TrimSpace(param)
-		if param[0] == '"' && param[len(param)-1] == '"' {
-			out.Params = append(out.Params, param[1:len(param)-1])
-		} else if b, err := strconv.ParseBool(param); err != nil {
-			out.Params = append(out.Params, b)
-		} else if u, err := strconv.ParseUint(param, 10, 64); err != nil {
-			out.Params = append(out.Params, u)
-		} else if i, err := strconv.ParseInt(param, 10, 64); err != nil {
-			out.Params = append(out.Params, i)
-		} else if f, err := strconv.ParseFloat(param, 64); err != nil {
-			out.Params = append(out.Params, f)
-		} else {
-			return nil
+	if strings.TrimSpace(params) != "" {
+		for _, param := range strings.Split(params, ",") {
+			param = strings.TrimSpace(param)
+			if len(param) >= 2 && param[0] == '"' && param[len(param)-1] == '"' {
+				out.Params = append(out.Params, param[1:len(param)-1])
+			} else if b, err := strconv.ParseBool(param); err == nil {
+				out.Params = append(out.Params, b)
+			} else if u, err := strconv.ParseUint(param, 10, 64); err == nil {
+				out.Params = append(out.Params, u)
+			} else if i, err := strconv.ParseInt(param, 10, 64); err == nil {
+				out.Params = append(out.Params, i)
+			} else if f, err := strconv.ParseFloat(param, 64); err == nil {
+				out.Params = append(out.Params, f)
+			} else {
+				return nil
+			}
 		}
 	}
 	pathsuffix := groups[3]
@@ -67,30 +91,37 @@ func parseFunctionInvocation(invocation string) *functionInvocation {
 	return &out
 }
 
-func ucManifestID(invocation *functionInvocation, ctx *GenerationContext) (hclwrite.Tokens, error) {
+func findManifestIDTarget(invocation *functionInvocation, ctx *GenerationContext) (*manifest.Resource, error) {
 	if len(invocation.Params) != 1 {
-		return []*hclwrite.Token{}, ucerr.Errorf("UC_MANIFEST_ID takes exactly 1 parameter")
+		return nil, ucerr.Errorf("UC_MANIFEST_ID takes exactly 1 parameter")
 	}
 	if reflect.ValueOf(invocation.Params[0]).Kind() != reflect.String {
-		return []*hclwrite.Token{}, ucerr.Errorf("UC_MANIFEST_ID takes a string parameter")
+		return nil, ucerr.Errorf("UC_MANIFEST_ID takes a string parameter")
 	}
 	manifestID := invocation.Params[0].(string)
-	var matchingResource *manifest.Resource
 	for i := range ctx.Manifest.Resources {
 		if ctx.Manifest.Resources[i].ManifestID == manifestID {
-			matchingResource = &ctx.Manifest.Resources[i]
-			break
+			// ctx.FQTN is blank when validating a manifest without a tenant
+			if ctx.FQTN != "" && !ctx.Manifest.Resources[i].AppliesToTenant(ctx.FQTN) {
+				return nil, ucerr.Errorf("resource with manifest ID %s is excluded from tenant %s by only_tenants or except_tenants, so it can't be referenced there", manifestID, ctx.FQTN)
+			}
+			return &ctx.Manifest.Resources[i], nil
 		}
 	}
-	if matchingResource == nil {
-		return []*hclwrite.Token{}, ucerr.Errorf("could not find resource with manifest ID %s for UC_MANIFEST_ID invocation", manifestID)
+	return nil, ucerr.Errorf("could not find resource with manifest ID %s for UC_MANIFEST_ID invocation", manifestID)
+}
+
+func ucManifestID(invocation *functionInvocation, ctx *GenerationContext) (hclwrite.Tokens, error) {
+	matchingResource, err := findManifestIDTarget(invocation, ctx)
+	if err != nil {
+		return []*hclwrite.Token{}, ucerr.Wrap(err)
 	}
 	if len(invocation.PathSuffix) == 0 {
 		return []*hclwrite.Token{}, ucerr.Errorf("expected manifest to access attributes of resource returned by UC_MANIFEST_ID")
 	}
 	traversal := hcl.Traversal{
 		hcl.TraverseRoot{Name: "userclouds_" + matchingResource.TerraformTypeSuffix},
-		hcl.TraverseAttr{Name: "manifestid-" + matchingResource.ManifestID},
+		hcl.TraverseAttr{Name: ctx.resourceName(matchingResource.ManifestID)},
 	}
 	for _, pathPart := range invocation.PathSuffix {
 		traversal = append(traversal, hcl.TraverseAttr{Name: pathPart})
@@ -98,48 +129,172 @@ func ucManifestID(invocation *functionInvocation, ctx *GenerationContext) (hclwr
 	return hclwrite.TokensForTraversal(traversal), nil
 }
 
-func ucSystemObject(invocation *functionInvocation, ctx *GenerationContext) (hclwrite.Tokens, error) {
+func resolveUCManifestID(invocation *functionInvocation, ctx *GenerationContext) (any, error) {
+	matchingResource, err := findManifestIDTarget(invocation, ctx)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	if len(invocation.PathSuffix) == 0 {
+		return nil, ucerr.Errorf("expected manifest to access attributes of resource returned by UC_MANIFEST_ID")
+	}
+	if len(invocation.PathSuffix) == 1 && invocation.PathSuffix[0] == "id" {
+		if matchingResource.ResourceUUIDs[ctx.FQTN] != "" {
+			return matchingResource.ResourceUUIDs[ctx.FQTN], nil
+		}
+		return matchingResource.ResourceUUIDs["__DEFAULT"], nil
+	}
+	var val any = matchingResource.Attributes
+	for _, pathPart := range invocation.PathSuffix {
+		m, ok := val.(map[string]any)
+		if !ok {
+			return nil, ucerr.Errorf("could not resolve attribute path %s on resource with manifest ID %s", strings.Join(invocation.PathSuffix, "."), matchingResource.ManifestID)
+		}
+		val = m[pathPart]
+	}
+	return ResolveValue(val, ctx)
+}
+
+func findSystemObject(invocation *functionInvocation, ctx *GenerationContext) (*liveresource.Resource, error) {
 	if len(invocation.Params) != 2 {
-		return []*hclwrite.Token{}, ucerr.Errorf("UC_SYSTEM_OBJECT takes exactly 2 parameters")
+		return nil, ucerr.Errorf("UC_SYSTEM_OBJECT takes exactly 2 parameters")
 	}
 	if reflect.ValueOf(invocation.Params[0]).Kind() != reflect.String ||
 		reflect.ValueOf(invocation.Params[1]).Kind() != reflect.String {
-		return []*hclwrite.Token{}, ucerr.Errorf("UC_SYSTEM_OBJECT parameters must be strings")
+		return nil, ucerr.Errorf("UC_SYSTEM_OBJECT parameters must be strings")
 	}
 	terraformTypeSuffix := invocation.Params[0].(string)
 	objectName := invocation.Params[1].(string)
-	var matchingResource *liveresource.Resource
-	for _, resource := range *ctx.LiveResources {
+	for i, resource := range *ctx.LiveResources {
 		if resource.TerraformTypeSuffix == terraformTypeSuffix && resource.IsSystem && resource.Attributes["name"].(string) == objectName {
-			matchingResource = &resource
-			break
+			return &(*ctx.LiveResources)[i], nil
 		}
 	}
-	if matchingResource == nil {
-		return []*hclwrite.Token{}, ucerr.Errorf("could not find system object with type %s and name %s for UC_SYSTEM_OBJECT invocation", terraformTypeSuffix, objectName)
+	return nil, ucerr.Errorf("could not find system object with type %s and name %s for UC_SYSTEM_OBJECT invocation", terraformTypeSuffix, objectName)
+}
+
+func ucSystemObject(invocation *functionInvocation, ctx *GenerationContext) (hclwrite.Tokens, error) {
+	val, err := resolveUCSystemObject(invocation, ctx)
+	if err != nil {
+		return []*hclwrite.Token{}, ucerr.Wrap(err)
+	}
+	if ctx.eject != nil {
+		name := ctx.eject.systemObjectLocal(invocation.Params[0].(string), invocation.Params[1].(string), val.(string))
+		return hclwrite.TokensForTraversal(hcl.Traversal{
+			hcl.TraverseRoot{Name: "local"},
+			hcl.TraverseAttr{Name: name},
+		}), nil
+	}
+	return hclwrite.TokensForValue(cty.StringVal(val.(string))), nil
+}
+
+func resolveUCSystemObject(invocation *functionInvocation, ctx *GenerationContext) (any, error) {
+	matchingResource, err := findSystemObject(invocation, ctx)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
 	}
 	if len(invocation.PathSuffix) != 0 {
-		return []*hclwrite.Token{}, ucerr.Errorf("UC_SYSTEM_OBJECT returns a string, so path suffixes may not be used")
+		return nil, ucerr.Errorf("UC_SYSTEM_OBJECT returns a string, so path suffixes may not be used")
 	}
-	return hclwrite.TokensForValue(cty.StringVal(matchingResource.ResourceUUID)), nil
+	return matchingResource.ResourceUUID, nil
 }
 
 func readFile(invocation *functionInvocation, ctx *GenerationContext) (hclwrite.Tokens, error) {
+	if ctx.eject != nil {
+		filePath, err := findFile(invocation, ctx)
+		if err != nil {
+			return []*hclwrite.Token{}, ucerr.Wrap(err)
+		}
+		if _, err := os.Stat(filePath); err != nil {
+			return []*hclwrite.Token{}, ucerr.Errorf("error reading file %s: %v", filePath, err)
+		}
+		return ctx.eject.fileTokens(filePath), nil
+	}
+	val, err := resolveFile(invocation, ctx)
+	if err != nil {
+		return []*hclwrite.Token{}, ucerr.Wrap(err)
+	}
+	return hclwrite.TokensForValue(cty.StringVal(val.(string))), nil
+}
+
+// findFile checks a FILE invocation and returns the path of the file, resolving
+// relative paths against the manifest file
+func findFile(invocation *functionInvocation, ctx *GenerationContext) (string, error) {
 	if len(invocation.Params) != 1 {
-		return []*hclwrite.Token{}, ucerr.Errorf("FILE takes exactly 1 parameter")
+		return "", ucerr.Errorf("FILE takes exactly 1 parameter")
 	}
 	if reflect.ValueOf(invocation.Params[0]).Kind() != reflect.String {
-		return []*hclwrite.Token{}, ucerr.Errorf("FILE takes a string parameter")
+		return "", ucerr.Errorf("FILE takes a string parameter")
 	}
 	filePath := invocation.Params[0].(string)
 	if !strings.HasPrefix(filePath, "/") {
 		filePath = filepath.Dir(ctx.ManifestFilePath) + "/" + filePath
 	}
+	return filePath, nil
+}
+
+func resolveFile(invocation *functionInvocation, ctx *GenerationContext) (any, error) {
+	filePath, err := findFile(invocation, ctx)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
+	}
 	contents, err := os.ReadFile(filePath)
 	if err != nil {
-		return []*hclwrite.Token{}, ucerr.Errorf("error reading file %s: %v", filePath, err)
+		return nil, ucerr.Errorf("error reading file %s: %v", filePath, err)
 	}
 	// Remove trailing newline if present (inserted by many editors, and by our
 	// manifest generation)
-	return hclwrite.TokensForValue(cty.StringVal(strings.TrimSuffix(string(contents), "\n"))), nil
+	return strings.TrimSuffix(string(contents), "\n"), nil
+}
+
+// findVariable checks a VAR invocation and returns the name of the variable
+// along with the context to use for generating its value. Variable values may
+// use other functions (e.g. @FILE, with paths relative to the file declaring
+// the variable), but not @VAR.
+func findVariable(invocation *functionInvocation, ctx *GenerationContext) (string, *GenerationContext, error) {
+	if len(invocation.Params) != 1 {
+		return "", nil, ucerr.Errorf("VAR takes exactly 1 parameter")
+	}
+	name, ok := invocation.Params[0].(string)
+	if !ok {
+		return "", nil, ucerr.Errorf("VAR takes a string parameter")
+	}
+	if len(invocation.PathSuffix) != 0 {
+		return "", nil, ucerr.Errorf("path suffixes may not be used with VAR")
+	}
+	if ctx.resolvingVariable != "" {
+		return "", nil, ucerr.Errorf("the value of variable %s uses VAR(\"%s\"), but variable values may not use other variables", ctx.resolvingVariable, name)
+	}
+	if _, ok := ctx.Manifest.Variables[name]; !ok {
+		return "", nil, ucerr.Errorf("variable %s is not defined in the manifest", name)
+	}
+	varCtx := *ctx
+	varCtx.resolvingVariable = name
+	if source := ctx.Manifest.VariableSources[name]; source != "" {
+		varCtx.ManifestFilePath = source
+	}
+	return name, &varCtx, nil
+}
+
+func variable(invocation *functionInvocation, ctx *GenerationContext) (hclwrite.Tokens, error) {
+	name, varCtx, err := findVariable(invocation, ctx)
+	if err != nil {
+		return []*hclwrite.Token{}, ucerr.Wrap(err)
+	}
+	val, err := ctx.Manifest.VariableValue(name, ctx.FQTN)
+	if err != nil {
+		return []*hclwrite.Token{}, ucerr.Wrap(err)
+	}
+	return toHclTokens(val, varCtx)
+}
+
+func resolveVariable(invocation *functionInvocation, ctx *GenerationContext) (any, error) {
+	name, varCtx, err := findVariable(invocation, ctx)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	val, err := ctx.Manifest.VariableValue(name, ctx.FQTN)
+	if err != nil {
+		return nil, ucerr.Wrap(err)
+	}
+	return ResolveValue(val, varCtx)
 }
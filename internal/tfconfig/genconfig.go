@@ -4,11 +4,13 @@ import (
 	"sort"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/zclconf/go-cty/cty"
 
 	"userclouds.com/cmd/ucconfig/internal/liveresource"
 	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/tfstate"
 	"userclouds.com/infra/ucerr"
 )
 
@@ -21,10 +23,51 @@ type GenerationContext struct {
 	LiveResources    *[]liveresource.Resource
 	// TFProviderVersionConstraint specifies the version constraint that should be used for the terraform-provider-userclouds provider instantiation
 	TFProviderVersionConstraint string // e.g. "~> 1.0"
+	// ImportLiveResources adds an `import` block (supported by Terraform 1.5
+	// and later) for each live resource that was matched to a manifest
+	// resource, so that the Terraform state for those resources doesn't need
+	// to be synthesized
+	ImportLiveResources bool
+	// ManagedResourceNames maps the resources that are already in a persistent
+	// Terraform state (keyed by tfstate.ManagedResourceKey) to their names.
+	// Matched live resources in it don't need import blocks, but get a
+	// `moved` block if their name in the state is different.
+	ManagedResourceNames map[string]string
+	// Backend is the source of a `backend` block (e.g. `backend "s3" {...}`)
+	// to add to the `terraform` block, for keeping state in a remote backend
+	Backend string
+	// resolvingVariable is set to the variable name while generating a
+	// variable's value, since variable values may not use other variables
+	resolvingVariable string
+	// eject is set while generating a standalone module with GenEjectedModule
+	eject *ejectState
+}
+
+// resourceName returns the Terraform name of the resource with the given
+// manifest ID
+func (ctx *GenerationContext) resourceName(manifestID string) string {
+	if ctx.eject != nil {
+		return manifestID
+	}
+	return "manifestid-" + manifestID
+}
+
+// ForResource returns the context to use for the attribute values of the given
+// resource. Relative @FILE paths are resolved against the file that the
+// resource was loaded from, which differs from ManifestFilePath for resources
+// from included files.
+func (ctx *GenerationContext) ForResource(resource *manifest.Resource) *GenerationContext {
+	if resource.SourceFile == "" || resource.SourceFile == ctx.ManifestFilePath {
+		return ctx
+	}
+	resourceCtx := *ctx
+	resourceCtx.ManifestFilePath = resource.SourceFile
+	return &resourceCtx
 }
 
 func genResourceConfig(resource *manifest.Resource, ctx *GenerationContext, body *hclwrite.Body) error {
-	block := body.AppendNewBlock("resource", []string{"userclouds_" + resource.TerraformTypeSuffix, "manifestid-" + resource.ManifestID})
+	ctx = ctx.ForResource(resource)
+	block := body.AppendNewBlock("resource", []string{"userclouds_" + resource.TerraformTypeSuffix, ctx.resourceName(resource.ManifestID)})
 	var resourceUUID string
 	if resource.ResourceUUIDs[ctx.FQTN] != "" {
 		resourceUUID = resource.ResourceUUIDs[ctx.FQTN]
@@ -44,22 +87,86 @@ func genResourceConfig(resource *manifest.Resource, ctx *GenerationContext, body
 		}
 		block.Body().SetAttributeRaw(key, tokens)
 	}
+	if resource.Lifecycle != nil && resource.Lifecycle.PreventDestroy {
+		block.Body().AppendNewBlock("lifecycle", []string{}).Body().
+			SetAttributeValue("prevent_destroy", cty.True)
+	}
 	body.AppendNewline()
 
 	return nil
 }
 
+// genImportBlocks adds an import block for each live resource that was
+// matched to a manifest resource, unless it is already in ManagedResourceNames.
+// Live resources that weren't matched are going to be deleted, and import
+// blocks can only import resources that are in the configuration, so those
+// still need to be added to the Terraform state (see
+// tfstate.CreateUnmatchedState).
+func genImportBlocks(ctx *GenerationContext, body *hclwrite.Body) {
+	for _, live := range *ctx.LiveResources {
+		if live.IsSystem || live.ManifestID == "" {
+			continue
+		}
+		terraformType := "userclouds_" + live.TerraformTypeSuffix
+		to := hcl.Traversal{
+			hcl.TraverseRoot{Name: terraformType},
+			hcl.TraverseAttr{Name: ctx.resourceName(live.ManifestID)},
+		}
+		if managedName, ok := ctx.ManagedResourceNames[tfstate.ManagedResourceKey(terraformType, live.ResourceUUID)]; ok {
+			if managedName == ctx.resourceName(live.ManifestID) {
+				continue
+			}
+			// e.g. a resource that would have been deleted by a previous
+			// apply, which has since been added to the manifest
+			block := body.AppendNewBlock("moved", []string{})
+			block.Body().SetAttributeTraversal("from", hcl.Traversal{
+				hcl.TraverseRoot{Name: terraformType},
+				hcl.TraverseAttr{Name: managedName},
+			})
+			block.Body().SetAttributeTraversal("to", to)
+			body.AppendNewline()
+			continue
+		}
+		block := body.AppendNewBlock("import", []string{})
+		block.Body().SetAttributeTraversal("to", to)
+		block.Body().SetAttributeValue("id", cty.StringVal(live.ResourceUUID))
+		body.AppendNewline()
+	}
+}
+
+// parseBackend parses the source of a `backend` block, checking that it
+// contains exactly one backend block and nothing else
+func parseBackend(src string) (*hclwrite.Block, error) {
+	file, diags := hclwrite.ParseConfig([]byte(src), "backend", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, ucerr.Errorf("error parsing backend config: %v", diags)
+	}
+	blocks := file.Body().Blocks()
+	if len(file.Body().Attributes()) != 0 || len(blocks) != 1 || blocks[0].Type() != "backend" || len(blocks[0].Labels()) != 1 {
+		return nil, ucerr.Errorf(`backend config must contain a single backend block, e.g. backend "s3" { ... }`)
+	}
+	return blocks[0], nil
+}
+
 // GenConfig generates a terraform config file from a ucconfig manifest
 func GenConfig(ctx *GenerationContext) (string, error) {
 	// required providers
 	file := hclwrite.NewEmptyFile()
-	file.Body().
-		AppendNewBlock("terraform", []string{}).Body().
+	terraformBody := file.Body().AppendNewBlock("terraform", []string{}).Body()
+	terraformBody.
 		AppendNewBlock("required_providers", []string{}).Body().
 		SetAttributeValue("userclouds", cty.ObjectVal(map[string]cty.Value{
 			"source":  cty.StringVal("registry.terraform.io/userclouds/userclouds"),
 			"version": cty.StringVal(ctx.TFProviderVersionConstraint),
 		}))
+	if ctx.Backend != "" {
+		backend, err := parseBackend(ctx.Backend)
+		if err != nil {
+			return "", ucerr.Wrap(err)
+		}
+		terraformBody.AppendNewline()
+		terraformBody.AppendBlock(backend)
+	}
 	file.Body().AppendNewline()
 
 	// provider initialization
@@ -68,11 +175,18 @@ func GenConfig(ctx *GenerationContext) (string, error) {
 
 	// gen resources
 	for _, resource := range ctx.Manifest.Resources {
+		if !resource.AppliesToTenant(ctx.FQTN) {
+			continue
+		}
 		if err := genResourceConfig(&resource, ctx, file.Body()); err != nil {
 			return "", ucerr.Wrap(err)
 		}
 	}
 
+	if ctx.ImportLiveResources && ctx.LiveResources != nil {
+		genImportBlocks(ctx, file.Body())
+	}
+
 	var b strings.Builder
 	if _, err := file.WriteTo(&b); err != nil {
 		return "", ucerr.Wrap(err)
@@ -4,6 +4,7 @@ import (
 	"strings"
 	"testing"
 
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
 	"userclouds.com/cmd/ucconfig/internal/manifest"
 	"userclouds.com/infra/assert"
 )
@@ -74,3 +75,133 @@ resource "userclouds_userstore_column" "manifestid-entry2" {
   type       = "string"
 }`))
 }
+
+func TestGenConfigSkipsExcludedResources(t *testing.T) {
+	config := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "debug_col",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "debug"},
+				OnlyTenants:         []string{"mycompany-dev"},
+			},
+		},
+	}
+	terraform, err := GenConfig(&GenerationContext{Manifest: &config, FQTN: "mycompany-prod"})
+	assert.NoErr(t, err)
+	assert.False(t, strings.Contains(terraform, "manifestid-debug_col"))
+
+	terraform, err = GenConfig(&GenerationContext{Manifest: &config, FQTN: "mycompany-dev"})
+	assert.NoErr(t, err)
+	assert.True(t, strings.Contains(terraform, "manifestid-debug_col"))
+
+	// References to an excluded resource are an error
+	_, err = ResolveValue(`@UC_MANIFEST_ID("debug_col").id`, &GenerationContext{Manifest: &config, FQTN: "mycompany-prod"})
+	assert.NotNil(t, err)
+}
+
+func TestGenConfigPreventDestroy(t *testing.T) {
+	config := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "email"},
+				Lifecycle:           &manifest.Lifecycle{PreventDestroy: true},
+			},
+		},
+	}
+	terraform, err := GenConfig(&GenerationContext{Manifest: &config, FQTN: "mycompany-prod"})
+	assert.NoErr(t, err)
+	assert.True(t, strings.Contains(terraform, `resource "userclouds_userstore_column" "manifestid-email" {
+  id   = "fe20fd48-a006-4ad8-9208-4aad540d8794"
+  name = "email"
+  lifecycle {
+    prevent_destroy = true
+  }
+}`))
+}
+
+func TestGenConfigImportBlocks(t *testing.T) {
+	config := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "email"},
+			},
+		},
+	}
+	live := []liveresource.Resource{
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "email", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		// Unmatched and system resources don't get import blocks
+		{TerraformTypeSuffix: "userstore_column", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+		{TerraformTypeSuffix: "userstore_column", ResourceUUID: "633fac47-c6c1-4459-93e0-0bb4043e60a0", IsSystem: true},
+	}
+	terraform, err := GenConfig(&GenerationContext{Manifest: &config, FQTN: "mycompany-prod", LiveResources: &live, ImportLiveResources: true})
+	assert.NoErr(t, err)
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(terraform), `import {
+  to = userclouds_userstore_column.manifestid-email
+  id = "fe20fd48-a006-4ad8-9208-4aad540d8794"
+}`))
+	assert.Equal(t, strings.Count(terraform, "import {"), 1)
+
+	terraform, err = GenConfig(&GenerationContext{Manifest: &config, FQTN: "mycompany-prod", LiveResources: &live})
+	assert.NoErr(t, err)
+	assert.False(t, strings.Contains(terraform, "import {"))
+}
+
+func TestGenConfigPersistentState(t *testing.T) {
+	config := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+				Attributes:          map[string]any{"name": "email"},
+			},
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "phone",
+				ResourceUUIDs:       map[string]string{"__DEFAULT": "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+				Attributes:          map[string]any{"name": "phone"},
+			},
+		},
+	}
+	live := []liveresource.Resource{
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "email", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "phone", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+	}
+	terraform, err := GenConfig(&GenerationContext{
+		Manifest:            &config,
+		FQTN:                "mycompany-prod",
+		LiveResources:       &live,
+		ImportLiveResources: true,
+		ManagedResourceNames: map[string]string{
+			"userclouds_userstore_column/fe20fd48-a006-4ad8-9208-4aad540d8794": "manifestid-email",
+			"userclouds_userstore_column/c860a6d7-c632-4f81-8f5f-597290a9f437": "unmatched-c860a6d7-c632-4f81-8f5f-597290a9f437",
+		},
+		Backend: `backend "http" {
+  address = "https://state.example.com/mycompany-prod"
+}`,
+	})
+	assert.NoErr(t, err)
+	assert.True(t, strings.Contains(terraform, `
+  backend "http" {
+    address = "https://state.example.com/mycompany-prod"
+  }
+}`))
+	// Resources already in the state under the right name aren't imported,
+	// and resources under another name are moved
+	assert.False(t, strings.Contains(terraform, "import {"))
+	assert.True(t, strings.HasSuffix(strings.TrimSpace(terraform), `moved {
+  from = userclouds_userstore_column.unmatched-c860a6d7-c632-4f81-8f5f-597290a9f437
+  to   = userclouds_userstore_column.manifestid-phone
+}`))
+
+	_, err = GenConfig(&GenerationContext{Manifest: &config, FQTN: "mycompany-prod", Backend: `terraform {}`})
+	assert.NotNil(t, err)
+}
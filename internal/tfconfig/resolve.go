@@ -0,0 +1,66 @@
+package tfconfig
+
+import (
+	"reflect"
+
+	"userclouds.com/infra/ucerr"
+)
+
+// ResolveValue takes an attribute value from the manifest and returns it with
+// all ucconfig function invocations (e.g. `@UC_MANIFEST_ID("foo").id`)
+// replaced by the concrete values they refer to. This is the counterpart of
+// toHclTokens for callers that want to compare manifest values against live
+// resources directly, rather than generating Terraform configuration.
+//
+// References to manifest resources resolve to the UUID that the resource has
+// (or will be created with) in ctx.FQTN.
+func ResolveValue(val any, ctx *GenerationContext) (any, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	reflectVal := reflect.ValueOf(val)
+
+	if reflectVal.Kind() == reflect.Ptr {
+		if reflectVal.IsNil() {
+			return nil, nil
+		}
+		return ResolveValue(reflectVal.Elem().Interface(), ctx)
+	}
+
+	if reflectVal.Kind() == reflect.Array || reflectVal.Kind() == reflect.Slice {
+		out := make([]any, 0, reflectVal.Len())
+		for i := 0; i < reflectVal.Len(); i++ {
+			resolved, err := ResolveValue(reflectVal.Index(i).Interface(), ctx)
+			if err != nil {
+				return nil, ucerr.Errorf("error resolving array value at index %d: %v", i, err)
+			}
+			out = append(out, resolved)
+		}
+		return out, nil
+	}
+
+	if reflectVal.Kind() == reflect.Map {
+		out := map[string]any{}
+		for _, key := range reflectVal.MapKeys() {
+			resolved, err := ResolveValue(reflectVal.MapIndex(key).Interface(), ctx)
+			if err != nil {
+				return nil, ucerr.Errorf("error resolving map value under key %s: %v", key.String(), err)
+			}
+			out[key.String()] = resolved
+		}
+		return out, nil
+	}
+
+	if reflectVal.Kind() == reflect.String {
+		if invocation := parseFunctionInvocation(reflectVal.String()); invocation != nil {
+			resolved, err := invocation.resolve(ctx)
+			if err != nil {
+				return nil, ucerr.Wrap(err)
+			}
+			return resolved, nil
+		}
+	}
+
+	return val, nil
+}
@@ -0,0 +1,91 @@
+package tfconfig
+
+import (
+	"os"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/liveresource"
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+)
+
+func TestResolveValue(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "TestResolveValue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if os.RemoveAll(tmpdir) != nil {
+			t.Fatal(err)
+		}
+	}()
+	err = os.WriteFile(tmpdir+"/hello.js", []byte("function hi() {}\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := &GenerationContext{
+		ManifestFilePath: tmpdir + "/manifest.yaml",
+		FQTN:             "prod",
+		Manifest: &manifest.Manifest{
+			Resources: []manifest.Resource{{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "tenantspecific",
+				ResourceUUIDs: map[string]string{
+					"__DEFAULT": "fe20fd48-a006-4ad8-9208-4aad540d8794",
+					"prod":      "c860a6d7-c632-4f81-8f5f-597290a9f437",
+				},
+			}, {
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "default",
+				ResourceUUIDs: map[string]string{
+					"__DEFAULT": "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+				},
+			}},
+		},
+		LiveResources: &[]liveresource.Resource{{
+			TerraformTypeSuffix: "access_policy",
+			ResourceUUID:        "78733010-2a5b-469e-924e-50258db84db9",
+			IsSystem:            true,
+			Attributes: map[string]any{
+				"name": "AllowAll",
+			},
+		}},
+	}
+	resolved, err := ResolveValue(map[string]any{
+		"columns":       []any{`@UC_MANIFEST_ID("tenantspecific").id`, `@UC_MANIFEST_ID("default").id`},
+		"access_policy": `@UC_SYSTEM_OBJECT("access_policy", "AllowAll")`,
+		"function":      `@FILE("./hello.js")`,
+		"plain":         7,
+	}, ctx)
+	assert.NoErr(t, err)
+	assert.Equal(t, resolved, map[string]any{
+		"columns":       []any{"c860a6d7-c632-4f81-8f5f-597290a9f437", "633fac47-c6c1-4459-93e0-0bb4043e60a0"},
+		"access_policy": "78733010-2a5b-469e-924e-50258db84db9",
+		"function":      "function hi() {}",
+		"plain":         7,
+	})
+}
+
+func TestResolveFileRelativeToSourceFile(t *testing.T) {
+	tmpdir := t.TempDir()
+	assert.NoErr(t, os.MkdirAll(tmpdir+"/included", 0755))
+	assert.NoErr(t, os.WriteFile(tmpdir+"/included/hello.js", []byte("function hi() {}\n"), 0644))
+
+	resource := manifest.Resource{
+		TerraformTypeSuffix: "transformer",
+		ManifestID:          "hello",
+		SourceFile:          tmpdir + "/included/transformers.yaml",
+	}
+	ctx := &GenerationContext{
+		ManifestFilePath: tmpdir + "/manifest.yaml",
+		Manifest:         &manifest.Manifest{Resources: []manifest.Resource{resource}},
+		LiveResources:    &[]liveresource.Resource{},
+	}
+	resolved, err := ResolveValue(`@FILE("./hello.js")`, ctx.ForResource(&resource))
+	assert.NoErr(t, err)
+	assert.Equal(t, resolved, "function hi() {}")
+
+	_, err = ResolveValue(`@FILE("./hello.js")`, ctx)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,143 @@
+package tfconfig
+
+import (
+	"encoding/json"
+	"sort"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/ucerr"
+)
+
+// providerAddress is the address that the userclouds provider's schema is
+// listed under in `terraform providers schema -json` output
+const providerAddress = "registry.terraform.io/userclouds/userclouds"
+
+// The types below contain the parts of the `terraform providers schema -json`
+// output that we use. The full format is documented at
+// https://developer.hashicorp.com/terraform/cli/commands/providers/schema
+
+type schemaNestedType struct {
+	Attributes  map[string]schemaAttribute `json:"attributes"`
+	NestingMode string                     `json:"nesting_mode"`
+}
+
+type schemaAttribute struct {
+	NestedType *schemaNestedType `json:"nested_type,omitempty"`
+}
+
+type schemaBlockType struct {
+	Block       schemaBlock `json:"block"`
+	NestingMode string      `json:"nesting_mode"`
+}
+
+type schemaBlock struct {
+	Attributes map[string]schemaAttribute `json:"attributes"`
+	BlockTypes map[string]schemaBlockType `json:"block_types"`
+}
+
+// ResourceSchema describes a single resource type in the provider schema
+type ResourceSchema struct {
+	Block schemaBlock `json:"block"`
+}
+
+// ProviderSchema stores the schemas for the resource types of the userclouds
+// provider, keyed by Terraform type (e.g. "userclouds_userstore_column")
+type ProviderSchema struct {
+	ResourceSchemas map[string]ResourceSchema `json:"resource_schemas"`
+}
+
+// ParseProviderSchema extracts the userclouds provider's schema from the output
+// of `terraform providers schema -json`
+func ParseProviderSchema(schemaJSON []byte) (*ProviderSchema, error) {
+	var parsed struct {
+		ProviderSchemas map[string]ProviderSchema `json:"provider_schemas"`
+	}
+	if err := json.Unmarshal(schemaJSON, &parsed); err != nil {
+		return nil, ucerr.Errorf("error decoding provider schema JSON: %v", err)
+	}
+	schema, ok := parsed.ProviderSchemas[providerAddress]
+	if !ok {
+		return nil, ucerr.Errorf("provider schema JSON does not include %s", providerAddress)
+	}
+	return &schema, nil
+}
+
+// nestedValues returns the objects inside an attribute or block value,
+// according to its nesting mode. Values that aren't shaped as expected (e.g.
+// function invocations) are skipped.
+func nestedValues(val any, nestingMode string) []map[string]any {
+	var out []map[string]any
+	switch nestingMode {
+	case "list", "set":
+		items, _ := val.([]any)
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				out = append(out, m)
+			}
+		}
+	case "map":
+		items, _ := val.(map[string]any)
+		for _, item := range items {
+			if m, ok := item.(map[string]any); ok {
+				out = append(out, m)
+			}
+		}
+	default:
+		if m, ok := val.(map[string]any); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// unknownAttributes returns the paths of the keys in values that aren't
+// attributes or nested blocks in the schema
+func unknownAttributes(values map[string]any, attributes map[string]schemaAttribute, blockTypes map[string]schemaBlockType, pathPrefix string) []string {
+	var keys []string
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var unknown []string
+	for _, key := range keys {
+		path := pathPrefix + key
+		if attr, ok := attributes[key]; ok {
+			if attr.NestedType != nil {
+				for _, nested := range nestedValues(values[key], attr.NestedType.NestingMode) {
+					unknown = append(unknown, unknownAttributes(nested, attr.NestedType.Attributes, nil, path+".")...)
+				}
+			}
+			continue
+		}
+		if blockType, ok := blockTypes[key]; ok {
+			for _, nested := range nestedValues(values[key], blockType.NestingMode) {
+				unknown = append(unknown, unknownAttributes(nested, blockType.Block.Attributes, blockType.Block.BlockTypes, path+".")...)
+			}
+			continue
+		}
+		unknown = append(unknown, path)
+	}
+	return unknown
+}
+
+// ValidateAgainstSchema checks that every attribute of the manifest resources
+// that apply to the given tenant exists in the provider schema for its
+// resource type, and returns an error for each one that doesn't.
+func ValidateAgainstSchema(mfest *manifest.Manifest, fqtn string, schema *ProviderSchema) []error {
+	var errs []error
+	for i, resource := range mfest.Resources {
+		if !resource.AppliesToTenant(fqtn) {
+			continue
+		}
+		resourceSchema, ok := schema.ResourceSchemas["userclouds_"+resource.TerraformTypeSuffix]
+		if !ok {
+			errs = append(errs, ucerr.Errorf("error validating %s (manifest ID %s): the provider does not support resource type %s", resource.Location(i), resource.ManifestID, resource.TerraformTypeSuffix))
+			continue
+		}
+		for _, path := range unknownAttributes(resource.Attributes, resourceSchema.Block.Attributes, resourceSchema.Block.BlockTypes, "") {
+			errs = append(errs, ucerr.Errorf("error validating %s (manifest ID %s): the provider's %s resource has no attribute %s", resource.Location(i), resource.ManifestID, resource.TerraformTypeSuffix, path))
+		}
+	}
+	return errs
+}
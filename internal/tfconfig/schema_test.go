@@ -0,0 +1,74 @@
+package tfconfig
+
+import (
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+)
+
+const testSchemaJSON = `{
+  "format_version": "1.0",
+  "provider_schemas": {
+    "registry.terraform.io/userclouds/userclouds": {
+      "resource_schemas": {
+        "userclouds_userstore_accessor": {
+          "version": 1,
+          "block": {
+            "attributes": {
+              "id": {"type": "string"},
+              "name": {"type": "string"},
+              "columns": {
+                "nested_type": {
+                  "attributes": {
+                    "column": {"type": "string"},
+                    "transformer": {"type": "string"}
+                  },
+                  "nesting_mode": "list"
+                }
+              },
+              "selector_config": {
+                "nested_type": {
+                  "attributes": {"where_clause": {"type": "string"}},
+                  "nesting_mode": "single"
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func TestValidateAgainstSchema(t *testing.T) {
+	schema, err := ParseProviderSchema([]byte(testSchemaJSON))
+	assert.NoErr(t, err)
+	assert.Equal(t, len(schema.ResourceSchemas), 1)
+
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "accessor",
+				Attributes: map[string]any{
+					"name":            "acc",
+					"nmae":            "typo",
+					"columns":         []any{map[string]any{"column": `@UC_MANIFEST_ID("col").id`, "transfromer": "x"}},
+					"selector_config": map[string]any{"where_clause": "{id} = ANY(?)"},
+				},
+			},
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "col",
+				Attributes:          map[string]any{"name": "email"},
+			},
+		},
+	}
+	errs := ValidateAgainstSchema(&mfest, "mycompany-prod", schema)
+	assert.Equal(t, len(errs), 3)
+	assert.True(t, strings.Contains(errs[0].Error(), "manifest ID accessor): the provider's userstore_accessor resource has no attribute columns.transfromer"))
+	assert.True(t, strings.Contains(errs[1].Error(), "has no attribute nmae"))
+	assert.True(t, strings.Contains(errs[2].Error(), "does not support resource type userstore_column"))
+}
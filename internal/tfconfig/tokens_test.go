@@ -133,3 +133,59 @@ func TestToHclTokensFile(t *testing.T) {
 	assert.NoErr(t, err)
 	assert.Equal(t, string(hclwrite.Format(tokens.Bytes())), `"Hello world"`)
 }
+
+func TestParseFunctionInvocation(t *testing.T) {
+	invocation := parseFunctionInvocation(`@UC_SYSTEM_OBJECT("access_policy", "AllowAll")`)
+	assert.NotNil(t, invocation)
+	assert.Equal(t, invocation.Name, "UC_SYSTEM_OBJECT")
+	assert.Equal(t, invocation.Params, []any{"access_policy", "AllowAll"})
+
+	invocation = parseFunctionInvocation(`@UC_MANIFEST_ID("col").id`)
+	assert.NotNil(t, invocation)
+	assert.Equal(t, invocation.PathSuffix, []string{"id"})
+
+	invocation = parseFunctionInvocation(`@FUNC(true, 7)`)
+	assert.NotNil(t, invocation)
+	assert.Equal(t, invocation.Params, []any{true, uint64(7)})
+
+	invocation = parseFunctionInvocation(`@FUNC()`)
+	assert.NotNil(t, invocation)
+	assert.Equal(t, len(invocation.Params), 0)
+
+	// Unquoted strings are not valid parameters
+	assert.True(t, parseFunctionInvocation(`@FUNC(unquoted)`) == nil)
+}
+
+func TestToHclTokensVar(t *testing.T) {
+	mfest := &manifest.Manifest{
+		Variables: map[string]map[string]any{
+			"threshold": {"__DEFAULT": 5, "mycompany-prod": 50},
+			"where":     {"mycompany-prod": "{email} = ?"},
+			"nested":    {"__DEFAULT": `@VAR("threshold")`},
+		},
+	}
+
+	tokens, err := toHclTokens(`@VAR("threshold")`, &GenerationContext{Manifest: mfest, FQTN: "mycompany-prod"})
+	assert.NoErr(t, err)
+	assert.Equal(t, string(hclwrite.Format(tokens.Bytes())), `50`)
+
+	tokens, err = toHclTokens(`@VAR("threshold")`, &GenerationContext{Manifest: mfest, FQTN: "mycompany-staging"})
+	assert.NoErr(t, err)
+	assert.Equal(t, string(hclwrite.Format(tokens.Bytes())), `5`)
+
+	resolved, err := ResolveValue(map[string]any{"where_clause": `@VAR("where")`}, &GenerationContext{Manifest: mfest, FQTN: "mycompany-prod"})
+	assert.NoErr(t, err)
+	assert.Equal(t, resolved, map[string]any{"where_clause": "{email} = ?"})
+
+	// No value for this tenant and no __DEFAULT
+	_, err = toHclTokens(`@VAR("where")`, &GenerationContext{Manifest: mfest, FQTN: "mycompany-staging"})
+	assert.NotNil(t, err)
+
+	// Undefined variable
+	_, err = toHclTokens(`@VAR("missing")`, &GenerationContext{Manifest: mfest, FQTN: "mycompany-prod"})
+	assert.NotNil(t, err)
+
+	// Variables can't use other variables
+	_, err = toHclTokens(`@VAR("nested")`, &GenerationContext{Manifest: mfest, FQTN: "mycompany-prod"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,184 @@
+package tfconfig
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/gofrs/uuid"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/cmd/ucconfig/internal/resourcetypes"
+	"userclouds.com/infra/ucerr"
+)
+
+// Matches strings that look like they were meant to be function invocations,
+// so that we can report syntax errors instead of silently treating them as
+// string literals
+var functionLikeRegexp = regexp.MustCompile(`^@[A-Z_]+\(`)
+
+// validateFunctionInvocation checks a single function invocation without
+// needing any live resources. refType is the resource type that the attribute
+// is expected to reference, or "" if the attribute isn't a reference.
+func validateFunctionInvocation(invocation *functionInvocation, refType string, ctx *GenerationContext) error {
+	switch invocation.Name {
+	case "UC_MANIFEST_ID":
+		target, err := findManifestIDTarget(invocation, ctx)
+		if err != nil {
+			return ucerr.Wrap(err)
+		}
+		if len(invocation.PathSuffix) == 0 {
+			return ucerr.Errorf("expected manifest to access attributes of resource returned by UC_MANIFEST_ID")
+		}
+		if refType != "" && target.TerraformTypeSuffix != refType {
+			return ucerr.Errorf("UC_MANIFEST_ID(\"%s\") refers to a %s resource, but this attribute must reference a %s resource", target.ManifestID, target.TerraformTypeSuffix, refType)
+		}
+	case "UC_SYSTEM_OBJECT":
+		if len(invocation.Params) != 2 {
+			return ucerr.Errorf("UC_SYSTEM_OBJECT takes exactly 2 parameters")
+		}
+		typeSuffix, ok := invocation.Params[0].(string)
+		if _, nameOK := invocation.Params[1].(string); !ok || !nameOK {
+			return ucerr.Errorf("UC_SYSTEM_OBJECT parameters must be strings")
+		}
+		if !resourcetypes.ValidateTerraformTypeSuffix(typeSuffix) {
+			return ucerr.Errorf("UC_SYSTEM_OBJECT type \"%s\" is not a valid userclouds resource type suffix", typeSuffix)
+		}
+		if refType != "" && typeSuffix != refType {
+			return ucerr.Errorf("UC_SYSTEM_OBJECT refers to a %s resource, but this attribute must reference a %s resource", typeSuffix, refType)
+		}
+		if len(invocation.PathSuffix) != 0 {
+			return ucerr.Errorf("UC_SYSTEM_OBJECT returns a string, so path suffixes may not be used")
+		}
+	case "FILE":
+		if refType != "" {
+			return ucerr.Errorf("this attribute must reference a %s resource, so FILE may not be used", refType)
+		}
+		if _, err := resolveFile(invocation, ctx); err != nil {
+			return ucerr.Wrap(err)
+		}
+	default:
+		return ucerr.Errorf("unknown function %s", invocation.Name)
+	}
+	return nil
+}
+
+func validateValue(val any, attrPath string, resourceType *resourcetypes.ResourceType, ctx *GenerationContext) []error {
+	if val == nil {
+		return nil
+	}
+	v := reflect.ValueOf(val)
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		return validateValue(v.Elem().Interface(), attrPath, resourceType, ctx)
+	}
+
+	if v.Kind() == reflect.Array || v.Kind() == reflect.Slice {
+		var errs []error
+		for i := 0; i < v.Len(); i++ {
+			errs = append(errs, validateValue(v.Index(i).Interface(), attrPath, resourceType, ctx)...)
+		}
+		return errs
+	}
+
+	if v.Kind() == reflect.Map {
+		var errs []error
+		keys := v.MapKeys()
+		sort.SliceStable(keys, func(i int, j int) bool { return keys[i].String() < keys[j].String() })
+		for _, key := range keys {
+			errs = append(errs, validateValue(v.MapIndex(key).Interface(), attrPath+"."+key.String(), resourceType, ctx)...)
+		}
+		return errs
+	}
+
+	refType := ""
+	if resourceType != nil {
+		refType = resourceType.References[attrPath]
+	}
+
+	if v.Kind() != reflect.String {
+		if refType != "" {
+			return []error{ucerr.Errorf("attribute %s must reference a %s resource, but has a non-string value", attrPath, refType)}
+		}
+		return nil
+	}
+
+	s := v.String()
+	if invocation := parseFunctionInvocation(s); invocation != nil {
+		if invocation.Name == "VAR" {
+			return validateVariableUse(invocation, attrPath, resourceType, ctx)
+		}
+		if err := validateFunctionInvocation(invocation, refType, ctx); err != nil {
+			return []error{ucerr.Errorf("attribute %s: %v", attrPath, err)}
+		}
+		return nil
+	}
+	if functionLikeRegexp.MatchString(s) {
+		return []error{ucerr.Errorf("attribute %s: could not parse function invocation %s", attrPath, s)}
+	}
+	if refType != "" {
+		if _, err := uuid.FromString(s); err != nil {
+			return []error{ucerr.Errorf("attribute %s must reference a %s resource using @UC_MANIFEST_ID, @UC_SYSTEM_OBJECT, or a UUID, but has value \"%s\"", attrPath, refType, s)}
+		}
+	}
+	return nil
+}
+
+// validateVariableUse checks a VAR invocation, and checks every value of the
+// variable as if it were written in place of the invocation
+func validateVariableUse(invocation *functionInvocation, attrPath string, resourceType *resourcetypes.ResourceType, ctx *GenerationContext) []error {
+	name, varCtx, err := findVariable(invocation, ctx)
+	if err != nil {
+		return []error{ucerr.Errorf("attribute %s: %v", attrPath, err)}
+	}
+	values := ctx.Manifest.Variables[name]
+	var tenants []string
+	for tenant := range values {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	var errs []error
+	for _, tenant := range tenants {
+		for _, err := range validateValue(values[tenant], attrPath, resourceType, varCtx) {
+			errs = append(errs, ucerr.Errorf("variable %s value for %s: %v", name, tenant, err))
+		}
+	}
+	return errs
+}
+
+// ValidateFunctionCalls checks every attribute value in the manifest for
+// problems with ucconfig function invocations, without contacting a tenant:
+// invocations must parse, @UC_MANIFEST_ID targets must exist in the manifest,
+// @FILE paths must exist, @VAR variables must be defined, and attributes that
+// reference other resources must use a function invocation or a UUID. Each
+// value of a variable is checked where the variable is used. Since there are no live resources to
+// check against, @UC_SYSTEM_OBJECT names are not verified.
+func ValidateFunctionCalls(ctx *GenerationContext) []error {
+	var errs []error
+	for i, resource := range ctx.Manifest.Resources {
+		if ctx.FQTN != "" && !resource.AppliesToTenant(ctx.FQTN) {
+			continue
+		}
+		resourceType := resourcetypes.GetByTerraformTypeSuffix(resource.TerraformTypeSuffix)
+		for _, err := range validateResourceFunctionCalls(&ctx.Manifest.Resources[i], resourceType, ctx.ForResource(&ctx.Manifest.Resources[i])) {
+			errs = append(errs, ucerr.Errorf("error validating %s (manifest ID %s): %v", resource.Location(i), resource.ManifestID, err))
+		}
+	}
+	return errs
+}
+
+func validateResourceFunctionCalls(resource *manifest.Resource, resourceType *resourcetypes.ResourceType, ctx *GenerationContext) []error {
+	var keys []string
+	for key := range resource.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		errs = append(errs, validateValue(resource.Attributes[key], key, resourceType, ctx)...)
+	}
+	return errs
+}
@@ -0,0 +1,101 @@
+package tfconfig
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"userclouds.com/cmd/ucconfig/internal/manifest"
+	"userclouds.com/infra/assert"
+)
+
+func TestValidateFunctionCalls(t *testing.T) {
+	tmpdir, err := os.MkdirTemp("", "TestValidateFunctionCalls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if os.RemoveAll(tmpdir) != nil {
+			t.Fatal(err)
+		}
+	}()
+	err = os.WriteFile(tmpdir+"/exists.js", []byte("function id(data) { return data; }\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mfest := manifest.Manifest{
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_column",
+				ManifestID:          "email_col",
+				Attributes:          map[string]any{"name": "email"},
+			},
+			{
+				TerraformTypeSuffix: "transformer",
+				ManifestID:          "good_transformer",
+				Attributes:          map[string]any{"function": `@FILE("./exists.js")`},
+			},
+			{
+				TerraformTypeSuffix: "transformer",
+				ManifestID:          "bad_transformer",
+				Attributes:          map[string]any{"function": `@FILE("./missing.js")`},
+			},
+			{
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "accessor",
+				Attributes: map[string]any{
+					"access_policy": `@UC_SYSTEM_OBJECT("access_policy", "AllowAll")`,
+					"columns": []any{
+						map[string]any{
+							"column":      `@UC_MANIFEST_ID("email_col").id`,
+							"transformer": `@UC_MANIFEST_ID("missing").id`,
+						},
+						map[string]any{
+							"column":      "not-a-uuid",
+							"transformer": `@UC_MANIFEST_ID("email_col").id`,
+						},
+					},
+					"purposes": []any{`@UC_SYSTEM_OBJECT("userstore_purpose", operational)`},
+				},
+			},
+		},
+	}
+	errs := ValidateFunctionCalls(&GenerationContext{
+		ManifestFilePath: tmpdir + "/manifest.yaml",
+		Manifest:         &mfest,
+	})
+	assert.Equal(t, len(errs), 5)
+	assert.True(t, strings.Contains(errs[0].Error(), "manifest ID bad_transformer"))
+	assert.True(t, strings.Contains(errs[0].Error(), "missing.js"))
+	assert.True(t, strings.Contains(errs[1].Error(), "could not find resource with manifest ID missing"))
+	assert.True(t, strings.Contains(errs[2].Error(), "attribute columns.column must reference a userstore_column resource"))
+	assert.True(t, strings.Contains(errs[3].Error(), "refers to a userstore_column resource, but this attribute must reference a transformer resource"))
+	assert.True(t, strings.Contains(errs[4].Error(), "attribute purposes: could not parse function invocation"))
+}
+
+func TestValidateVariables(t *testing.T) {
+	mfest := manifest.Manifest{
+		Variables: map[string]map[string]any{
+			"policy": {
+				"__DEFAULT":      "633fac47-c6c1-4459-93e0-0bb4043e60a0",
+				"mycompany-prod": "not-a-uuid",
+			},
+		},
+		Resources: []manifest.Resource{
+			{
+				TerraformTypeSuffix: "userstore_accessor",
+				ManifestID:          "accessor",
+				Attributes: map[string]any{
+					"access_policy":  `@VAR("policy")`,
+					"selector_where": `@VAR("undefined")`,
+				},
+			},
+		},
+	}
+	errs := ValidateFunctionCalls(&GenerationContext{Manifest: &mfest})
+	assert.Equal(t, len(errs), 2)
+	assert.True(t, strings.Contains(errs[0].Error(), "variable policy value for mycompany-prod"))
+	assert.True(t, strings.Contains(errs[0].Error(), "must reference a access_policy resource"))
+	assert.True(t, strings.Contains(errs[1].Error(), "variable undefined is not defined"))
+}
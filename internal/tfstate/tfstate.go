@@ -1,7 +1,10 @@
 package tfstate
 
 import (
+	"bytes"
+	"encoding/json"
 	"reflect"
+	"strings"
 
 	"github.com/gofrs/uuid"
 
@@ -30,6 +33,11 @@ import (
 //
 // In practice, the tfstate file doesn't change format often, and since ucconfig generates the
 // config *and* invokes Terraform, we should be able to write tests that catch any issues.
+//
+// Terraform 1.5 added `import` blocks, which avoid both problems for resources that are in the
+// config. When the installed Terraform supports them, ucconfig imports the resources matched to the
+// manifest that way, and only synthesizes state for the resources that will be deleted (see
+// CreateUnmatchedState).
 
 // State is the top-level struct for a terraform.tfstate file
 type State struct {
@@ -114,7 +122,10 @@ func getDependenciesFromAttribute(attrVal any, currAttrPath string, forTfTypeSuf
 			}
 		}
 		if referenced == nil {
-			return []string{}, ucerr.Errorf("could not find referenced live resource for attrPath %s with UUID %v", currAttrPath, v.String())
+			// The referenced resource is outside of the manifest's scope, so
+			// it was left out of the live resources and isn't managed by
+			// Terraform. There's nothing in the state to depend on.
+			return []string{}, nil
 		}
 		if referenced.IsSystem {
 			// Don't write dependencies on system resources, since those are
@@ -153,6 +164,96 @@ func getDependenciesFromAttribute(attrVal any, currAttrPath string, forTfTypeSuf
 
 // CreateState creates a State struct from a list of live resources
 func CreateState(resources *[]liveresource.Resource) (State, error) {
+	return createState(resources, func(*liveresource.Resource) bool { return true })
+}
+
+// CreateUnmatchedState creates a State struct containing only the live
+// resources that weren't matched to a manifest resource (i.e. the ones that
+// applying the manifest will delete). It is used along with Terraform import
+// blocks for the matched resources, which can't import resources that aren't
+// in the configuration.
+func CreateUnmatchedState(resources *[]liveresource.Resource) (State, error) {
+	return createState(resources, func(r *liveresource.Resource) bool { return r.ManifestID == "" })
+}
+
+// ManagedResourceKey returns the key that ExistingResourceNames uses for a
+// resource, e.g. "userclouds_userstore_column/<uuid>"
+func ManagedResourceKey(terraformType string, resourceUUID string) string {
+	return terraformType + "/" + resourceUUID
+}
+
+// ExistingResourceNames returns the names of the userclouds resources in an
+// existing state file (e.g. the output of `terraform state pull` for a
+// persistent working directory or remote backend), keyed by
+// ManagedResourceKey. An empty stateJSON is treated as an empty state.
+func ExistingResourceNames(stateJSON []byte) (map[string]string, error) {
+	names := map[string]string{}
+	if len(bytes.TrimSpace(stateJSON)) == 0 {
+		return names, nil
+	}
+	var state State
+	if err := json.Unmarshal(stateJSON, &state); err != nil {
+		return nil, ucerr.Errorf("error decoding Terraform state: %v", err)
+	}
+	for _, r := range state.Resources {
+		if r.Module != "" || r.Mode != "managed" || !strings.HasPrefix(r.Type, "userclouds_") {
+			continue
+		}
+		for _, instance := range r.Instances {
+			if id, ok := instance.Attributes["id"].(string); ok {
+				names[ManagedResourceKey(r.Type, id)] = r.Name
+			}
+		}
+	}
+	return names, nil
+}
+
+// CreateMissingState creates a State struct containing the live resources that
+// weren't matched to a manifest resource and aren't already in an existing
+// state, whose resources are given by ExistingResourceNames. Along with import
+// blocks for the matched resources, these are what a persistent state needs in
+// order for Terraform to delete the unmatched resources.
+func CreateMissingState(resources *[]liveresource.Resource, existing map[string]string) (State, error) {
+	return createState(resources, func(r *liveresource.Resource) bool {
+		_, ok := existing[ManagedResourceKey("userclouds_"+r.TerraformTypeSuffix, r.ResourceUUID)]
+		return r.ManifestID == "" && !ok
+	})
+}
+
+// MergeInto returns the given existing state file with the resources of s
+// added and its serial incremented, for use with `terraform state push`. The
+// existing state is otherwise left as-is, so that fields that State doesn't
+// know about are kept. If existingJSON is empty, s is returned as-is.
+func (s State) MergeInto(existingJSON []byte) ([]byte, error) {
+	if len(bytes.TrimSpace(existingJSON)) == 0 {
+		out, err := json.MarshalIndent(s, "", "  ")
+		return out, ucerr.Wrap(err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(existingJSON))
+	dec.UseNumber()
+	var existing map[string]any
+	if err := dec.Decode(&existing); err != nil {
+		return nil, ucerr.Errorf("error decoding Terraform state: %v", err)
+	}
+	serialNumber, ok := existing["serial"].(json.Number)
+	if !ok {
+		return nil, ucerr.Errorf("Terraform state has no serial")
+	}
+	serial, err := serialNumber.Int64()
+	if err != nil {
+		return nil, ucerr.Errorf("error reading serial of Terraform state: %v", err)
+	}
+	existing["serial"] = serial + 1
+	resources, _ := existing["resources"].([]any)
+	for _, r := range s.Resources {
+		resources = append(resources, r)
+	}
+	existing["resources"] = resources
+	out, err := json.MarshalIndent(existing, "", "  ")
+	return out, ucerr.Wrap(err)
+}
+
+func createState(resources *[]liveresource.Resource, include func(*liveresource.Resource) bool) (State, error) {
 	lineage, err := uuid.NewV4()
 	if err != nil {
 		return State{}, ucerr.Wrap(err)
@@ -161,7 +262,7 @@ func CreateState(resources *[]liveresource.Resource) (State, error) {
 	var stateResources []Resource
 	for _, resource := range *resources {
 		// Omit system resources from state, since they are also omitted from the configuration
-		if resource.IsSystem {
+		if resource.IsSystem || !include(&resource) {
 			continue
 		}
 		attributes := map[string]any{}
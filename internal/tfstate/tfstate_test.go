@@ -189,3 +189,109 @@ func TestCreateStateWithDependencies(t *testing.T) {
   "check_results": []
 }`)
 }
+
+func TestCreateUnmatchedState(t *testing.T) {
+	resources := []liveresource.Resource{
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ManifestID:          "entry1",
+			ResourceUUID:        "fe20fd48-a006-4ad8-9208-4aad540d8794",
+		},
+		{
+			TerraformTypeSuffix: "userstore_column",
+			ResourceUUID:        "c860a6d7-c632-4f81-8f5f-597290a9f437",
+		},
+	}
+	state, err := CreateUnmatchedState(&resources)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(state.Resources), 1)
+	assert.Equal(t, state.Resources[0].Name, "unmatched-c860a6d7-c632-4f81-8f5f-597290a9f437")
+}
+
+func TestMergeIntoExistingState(t *testing.T) {
+	existingJSON := []byte(`{
+  "version": 4,
+  "terraform_version": "1.6.0",
+  "serial": 7,
+  "lineage": "existing-lineage",
+  "outputs": {},
+  "resources": [
+    {
+      "mode": "managed",
+      "type": "userclouds_userstore_column",
+      "name": "manifestid-email",
+      "provider": "provider[\"registry.terraform.io/userclouds/userclouds\"]",
+      "instances": [
+        {
+          "schema_version": 0,
+          "attributes": {"id": "fe20fd48-a006-4ad8-9208-4aad540d8794", "name": "email"},
+          "sensitive_attributes": [],
+          "private": "bnVsbA=="
+        }
+      ]
+    }
+  ],
+  "check_results": null
+}`)
+	existing, err := ExistingResourceNames(existingJSON)
+	assert.NoErr(t, err)
+	assert.Equal(t, existing, map[string]string{"userclouds_userstore_column/fe20fd48-a006-4ad8-9208-4aad540d8794": "manifestid-email"})
+
+	resources := []liveresource.Resource{
+		// Matched resources are imported rather than added to the state
+		{TerraformTypeSuffix: "userstore_column", ManifestID: "phone", ResourceUUID: "c860a6d7-c632-4f81-8f5f-597290a9f437"},
+		// Unmatched resources that are already in the state aren't added again
+		{TerraformTypeSuffix: "userstore_column", ResourceUUID: "fe20fd48-a006-4ad8-9208-4aad540d8794"},
+		{TerraformTypeSuffix: "userstore_column", ResourceUUID: "633fac47-c6c1-4459-93e0-0bb4043e60a0"},
+	}
+	state, err := CreateMissingState(&resources, existing)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(state.Resources), 1)
+	assert.Equal(t, state.Resources[0].Name, "unmatched-633fac47-c6c1-4459-93e0-0bb4043e60a0")
+
+	merged, err := state.MergeInto(existingJSON)
+	assert.NoErr(t, err)
+	var decoded map[string]any
+	assert.NoErr(t, json.Unmarshal(merged, &decoded))
+	assert.Equal(t, decoded["serial"], float64(8))
+	assert.Equal(t, decoded["lineage"], "existing-lineage")
+	assert.Equal(t, len(decoded["resources"].([]any)), 2)
+	// Fields that State doesn't know about are kept
+	firstInstance := decoded["resources"].([]any)[0].(map[string]any)["instances"].([]any)[0].(map[string]any)
+	assert.Equal(t, firstInstance["private"], "bnVsbA==")
+
+	// With no existing state, the new state is used as-is
+	merged, err = state.MergeInto(nil)
+	assert.NoErr(t, err)
+	assert.NoErr(t, json.Unmarshal(merged, &decoded))
+	assert.Equal(t, decoded["serial"], float64(1))
+}
+
+func TestCreateStateWithOutOfScopeReference(t *testing.T) {
+	ctx := context.Background()
+	colID := uuid.Must(uuid.FromString("fe20fd48-a006-4ad8-9208-4aad540d8794"))
+	col, err := liveresource.MakeLiveResource(ctx, *resourcetypes.GetByTerraformTypeSuffix("userstore_column"), userstore.Column{
+		ID:        colID,
+		Name:      "app_email",
+		IndexType: "none",
+	})
+	assert.NoErr(t, err)
+	accessor, err := liveresource.MakeLiveResource(ctx, *resourcetypes.GetByTerraformTypeSuffix("userstore_accessor"), userstore.Accessor{
+		ID:   uuid.Must(uuid.FromString("a12b3c4d-5e67-8901-2f34-567890123456")),
+		Name: "app_accessor",
+		Columns: []userstore.ColumnOutputConfig{
+			{Column: userstore.ResourceID{ID: colID}},
+			// A column outside of the manifest's scope, which was filtered out
+			// of the live resources
+			{Column: userstore.ResourceID{ID: uuid.Must(uuid.FromString("c860a6d7-c632-4f81-8f5f-597290a9f437"))}},
+		},
+	})
+	assert.NoErr(t, err)
+	resources := []liveresource.Resource{col, accessor}
+	state, err := CreateState(&resources)
+	assert.NoErr(t, err)
+	assert.Equal(t, len(state.Resources), 2)
+	assert.Equal(t, state.Resources[1].Instances[0].Dependencies, []string{
+		"userclouds_userstore_column.unmatched-fe20fd48-a006-4ad8-9208-4aad540d8794",
+	})
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
-	"net/url"
+	"errors"
+	"os"
 	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/gofrs/uuid"
 
 	"userclouds.com/cmd/ucconfig/internal/cmd"
+	"userclouds.com/cmd/ucconfig/internal/profile"
+	"userclouds.com/cmd/ucconfig/internal/resourcetypes"
+	"userclouds.com/cmd/ucconfig/internal/retry"
 	"userclouds.com/idp"
 	"userclouds.com/infra/jsonclient"
 	"userclouds.com/infra/logtransports"
@@ -20,28 +25,143 @@ type cliContext struct {
 	Context context.Context
 }
 
-// CLI flags for subcommands that access a tenant
+// CLI flags for subcommands that access a tenant. The tenant URL, credentials,
+// and tenant name fall back to the USERCLOUDS_* environment variables, but
+// only when no profile is selected, so that they are read in resolveProfile
+// rather than through kong.
 type tenantConfig struct {
-	TenantURL    string `env:"USERCLOUDS_TENANT_URL" required:"" help:"Tenant URL."`
-	ClientID     string `env:"USERCLOUDS_CLIENT_ID" required:"" help:"Client ID."`
-	ClientSecret string `env:"USERCLOUDS_CLIENT_SECRET" required:"" help:"Client secret."`
+	Profile      string `env:"UCCONFIG_PROFILE" help:"Name of a tenant profile in the profiles file to use for the tenant URL and credentials. The USERCLOUDS_* environment variables are ignored when a profile is selected, but the other tenant flags take precedence over the profile."`
+	ProfilesFile string `env:"UCCONFIG_PROFILES_FILE" help:"Path to the profiles file. Defaults to $XDG_CONFIG_HOME/ucconfig/profiles.yaml or ~/.config/ucconfig/profiles.yaml." type:"path"`
+	TenantURL    string `help:"Tenant URL. Defaults to $USERCLOUDS_TENANT_URL if no profile is selected."`
+	ClientID     string `help:"Client ID. Defaults to $USERCLOUDS_CLIENT_ID if no profile is selected."`
+	ClientSecret string `help:"Client secret. Defaults to $USERCLOUDS_CLIENT_SECRET if no profile is selected."`
+	FQTN         string `name:"fqtn" help:"Fully-qualified tenant name (e.g. mycompany-mytenant), as used in resource_uuids. Defaults to $USERCLOUDS_FQTN if no profile is selected. Otherwise, this is derived from the tenant URL, or looked up from the tenant for custom domains."`
+	// skipEnvironment is set for tenants named by --tenants, --from, or --to,
+	// which are given their credentials explicitly
+	skipEnvironment bool `kong:"-"`
 }
 
-func (cfg tenantConfig) initTenantContext(ctx context.Context) tenantContext {
-	tenantURL, err := url.Parse(cfg.TenantURL)
+// envOr returns value if it is set, and otherwise the value of the given
+// environment variable
+func envOr(value string, envVar string) string {
+	if value != "" {
+		return value
+	}
+	return os.Getenv(envVar)
+}
+
+// resolveProfile fills in the settings from the selected profile (or, without
+// a profile, from the USERCLOUDS_* environment variables), and checks that all
+// of the settings are present. Flags take precedence over both. With a
+// profile, the environment variables aren't used at all, since they may be
+// left over from working with another tenant, and credentials from two
+// different sources would fail in confusing ways.
+func (cfg tenantConfig) resolveProfile(ctx context.Context) tenantConfig {
+	if cfg.Profile == "" {
+		if !cfg.skipEnvironment {
+			cfg.TenantURL = envOr(cfg.TenantURL, "USERCLOUDS_TENANT_URL")
+			cfg.ClientID = envOr(cfg.ClientID, "USERCLOUDS_CLIENT_ID")
+			cfg.ClientSecret = envOr(cfg.ClientSecret, "USERCLOUDS_CLIENT_SECRET")
+			cfg.FQTN = envOr(cfg.FQTN, "USERCLOUDS_FQTN")
+		}
+		if cfg.TenantURL == "" || cfg.ClientID == "" || cfg.ClientSecret == "" {
+			uclog.Fatalf(ctx, "A tenant URL, client ID, and client secret are required. Set them with --profile, or with the USERCLOUDS_TENANT_URL, USERCLOUDS_CLIENT_ID, and USERCLOUDS_CLIENT_SECRET environment variables.")
+		}
+		return cfg
+	}
+
+	profilesPath := cfg.ProfilesFile
+	if profilesPath == "" {
+		defaultPath, err := profile.DefaultPath()
+		if err != nil {
+			uclog.Fatalf(ctx, "Failed to find profiles file: %v", err)
+		}
+		profilesPath = defaultPath
+	}
+	profiles, err := profile.Load(profilesPath)
 	if err != nil {
-		uclog.Fatalf(ctx, "Failed to parse tenant URL: %v", err)
+		uclog.Fatalf(ctx, "Failed to load profiles: %v", err)
+	}
+	p, err := profiles.Get(cfg.Profile)
+	if err != nil {
+		uclog.Fatalf(ctx, "Failed to load profile: %v", err)
+	}
+	if cfg.TenantURL == "" {
+		cfg.TenantURL = p.TenantURL
+	}
+	if cfg.FQTN == "" {
+		cfg.FQTN = p.FQTN
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = p.ClientID
+	}
+	if cfg.ClientSecret == "" {
+		secret, err := p.ResolveClientSecret(ctx)
+		if err != nil {
+			uclog.Fatalf(ctx, "Failed to get client secret for profile %s: %v", cfg.Profile, err)
+		}
+		cfg.ClientSecret = secret
+	}
+	var missing []string
+	if cfg.TenantURL == "" {
+		missing = append(missing, "tenant_url")
+	}
+	if cfg.ClientID == "" {
+		missing = append(missing, "client_id")
+	}
+	if cfg.ClientSecret == "" {
+		missing = append(missing, "a client secret")
+	}
+	if len(missing) > 0 {
+		uclog.Fatalf(ctx, "Profile %s doesn't set %s. Add it to the profile or pass it as a flag; the USERCLOUDS_* environment variables aren't used when a profile is selected.", cfg.Profile, strings.Join(missing, ", "))
+	}
+	return cfg
+}
+
+// tenantConfigFor returns the tenantConfig for a tenant named on the command
+// line, which is either a tenant URL or a profile name. The client ID and
+// secret are only used for tenant URLs.
+func tenantConfigFor(tenant string, profilesFile string, clientID string, clientSecret string) tenantConfig {
+	if strings.Contains(tenant, "://") {
+		return tenantConfig{TenantURL: tenant, ClientID: clientID, ClientSecret: clientSecret, skipEnvironment: true}
+	}
+	return tenantConfig{Profile: tenant, ProfilesFile: profilesFile, skipEnvironment: true}
+}
+
+func (cfg tenantConfig) initTenantContext(ctx context.Context) tenantContext {
+	cfg = cfg.resolveProfile(ctx)
+	// Retry transient failures (e.g. 502s and rate limits) from the tenant
+	retryingClient := retry.NewHTTPClient(cli.MaxRetries, cli.RequestTimeout)
+	fqtn := cfg.FQTN
+	fqtnDerived := false
+	if fqtn == "" {
+		var err error
+		fqtn, fqtnDerived, err = cmd.ResolveFQTN(ctx, retryingClient, cfg.TenantURL)
+		if err != nil {
+			uclog.Fatalf(ctx, "Failed to determine tenant name: %v", err)
+		}
 	}
-	fqtn := strings.Split(tenantURL.Hostname(), ".")[0]
 
-	// Initialize IDP client based on env vars
-	tokenSource := jsonclient.ClientCredentialsTokenSource(cfg.TenantURL+"/oidc/token", cfg.ClientID, cfg.ClientSecret, nil)
-	idpClient, err := idp.NewClient(cfg.TenantURL, idp.OrganizationID(uuid.Nil), idp.JSONClient(tokenSource))
+	// Initialize IDP client based on env vars. The access token is fetched
+	// with the retrying client too, since that is the first request that
+	// every command makes.
+	httpClient := jsonclient.HTTPClient(retryingClient)
+	tokenSource := jsonclient.ClientCredentialsTokenSource(cfg.TenantURL+"/oidc/token", cfg.ClientID, cfg.ClientSecret, nil, httpClient)
+	idpClient, err := idp.NewClient(cfg.TenantURL, idp.OrganizationID(uuid.Nil), idp.JSONClient(tokenSource, httpClient))
 	if err != nil {
 		uclog.Fatalf(ctx, "Failed to initialize IDP client: %v", err)
 	}
 
-	return tenantContext{FQTN: fqtn, IDPClient: idpClient}
+	return tenantContext{FQTN: fqtn, FQTNDerived: fqtnDerived, IDPClient: idpClient, TenantURL: cfg.TenantURL, ClientID: cfg.ClientID, ClientSecret: cfg.ClientSecret}
+}
+
+// checkFQTN returns an error if the tenant name was guessed from the tenant URL
+// and doesn't appear in the manifest, since it is likely wrong
+func (tc tenantContext) checkFQTN(ctx context.Context, manifestPath string) error {
+	if !tc.FQTNDerived {
+		return nil
+	}
+	return ucerr.Wrap(cmd.CheckFQTN(ctx, manifestPath, tc.FQTN))
 }
 
 // for subcommands that access a tenant
@@ -49,38 +169,230 @@ type tenantContext struct {
 	IDPClient *idp.Client
 	// fully-qualified tenant name, e.g. "mycompany-mytenant"
 	FQTN string
+	// FQTNDerived is true if the FQTN is only a guess based on the tenant URL,
+	// and should be checked against the manifest
+	FQTNDerived bool
+	// The tenant URL and credentials, after applying any profile
+	TenantURL    string
+	ClientID     string
+	ClientSecret string
 }
 
 type applyCmd struct {
 	tenantConfig
-	ManifestPath                string `arg:"" name:"manifest-path" help:"Path to UC JSON manifest file" type:"path"`
-	DryRun                      bool   `help:"Don't actually apply the manifest, just print what would be done."`
-	AutoApprove                 bool   `help:"Don't prompt for confirmation before applying the manifest."`
-	TFProviderVersionConstraint string `help:"Version constraint that should be used for the terraform-provider-userclouds provider instantiation, e.g. \"~> 1.0\" or \"= 1.2.3\""`
-	TFProviderDevDirPath        string `help:"Path to the directory containing the terraform-provider-userclouds binary for local provider development"`
+	ManifestPath                string   `arg:"" name:"manifest-path" help:"Path to UC manifest file (JSON or YAML)" type:"path"`
+	DryRun                      bool     `help:"Don't actually apply the manifest, just print what would be done."`
+	AutoApprove                 bool     `help:"Don't prompt for confirmation before applying the manifest."`
+	TFProviderVersionConstraint string   `help:"Version constraint that should be used for the terraform-provider-userclouds provider instantiation, e.g. \"~> 1.0\" or \"= 1.2.3\""`
+	TFProviderDevDirPath        string   `help:"Path to the directory containing the terraform-provider-userclouds binary for local provider development"`
+	Output                      string   `enum:"text,json" default:"text" help:"Output format. \"json\" prints a machine-readable report of the changes to stdout, and requires --dry-run or --auto-approve."`
+	Engine                      string   `enum:"terraform,native" default:"terraform" help:"How to apply changes. \"native\" calls the UserClouds API directly instead of running Terraform, so no terraform binary or provider download is needed."`
+	WriteBack                   bool     `help:"After a successful apply, record this tenant's resource UUIDs in the manifest file. Only the resource_uuids maps are changed; comments and formatting are preserved."`
+	MaxDeletes                  int      `default:"-1" help:"Abort without making any changes if applying the manifest would delete (or replace) more than this many resources. The default of -1 means no limit."`
+	BackupDir                   string   `env:"UCCONFIG_BACKUP_DIR" help:"Before making changes, save a snapshot of the tenant's live resources to a timestamped directory under this directory. The snapshot can be restored with the rollback subcommand." type:"path"`
+	Tenants                     []string `sep:"," help:"Comma-separated list of tenants (profile names or tenant URLs) to apply the manifest to, in order. Every tenant is planned first, and then the approved plans are applied to each tenant, stopping at the first failure. Tenant URLs use the --client-id and --client-secret credentials."`
+	WorkDir                     string   `env:"UCCONFIG_WORKDIR" help:"Directory to generate Terraform files in, which is reused across runs to keep the provider cache and Terraform state. With --tenants, each tenant uses a subdirectory named after it." type:"path"`
+	BackendConfig               string   `env:"UCCONFIG_BACKEND_CONFIG" help:"Path to a file containing a Terraform backend block (e.g. backend \"s3\" { ... }) to keep the Terraform state in." type:"path"`
 }
 
 // Run implements the apply subcommand
 func (c *applyCmd) Run(ctx *cliContext) error {
+	var maxDeletes *int
+	if c.MaxDeletes >= 0 {
+		maxDeletes = &c.MaxDeletes
+	}
+	opts := cmd.ApplyOptions{
+		DryRun:                      c.DryRun,
+		AutoApprove:                 c.AutoApprove,
+		ManifestPath:                c.ManifestPath,
+		TFProviderVersionConstraint: c.TFProviderVersionConstraint,
+		TFProviderDevDirPath:        c.TFProviderDevDirPath,
+		OutputFormat:                c.Output,
+		Engine:                      c.Engine,
+		WriteBack:                   c.WriteBack,
+		MaxDeletes:                  maxDeletes,
+		BackupDir:                   c.BackupDir,
+		WorkDir:                     c.WorkDir,
+		BackendConfigPath:           c.BackendConfig,
+	}
+	if len(c.Tenants) > 0 {
+		// Tenant URLs use the --client-id and --client-secret credentials
+		clientID := envOr(c.ClientID, "USERCLOUDS_CLIENT_ID")
+		clientSecret := envOr(c.ClientSecret, "USERCLOUDS_CLIENT_SECRET")
+		var tenants []cmd.Tenant
+		for _, t := range c.Tenants {
+			tenantCtx := tenantConfigFor(t, c.ProfilesFile, clientID, clientSecret).initTenantContext(ctx.Context)
+			if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+				return ucerr.Wrap(err)
+			}
+			tenants = append(tenants, cmd.Tenant{
+				FQTN:         tenantCtx.FQTN,
+				IDPClient:    tenantCtx.IDPClient,
+				TenantURL:    tenantCtx.TenantURL,
+				ClientID:     tenantCtx.ClientID,
+				ClientSecret: tenantCtx.ClientSecret,
+			})
+		}
+		return ucerr.Wrap(cmd.ApplyToTenants(ctx.Context, tenants, opts))
+	}
 	tenantCtx := c.initTenantContext(ctx.Context)
-	return ucerr.Wrap(cmd.Apply(ctx.Context, c.DryRun, c.AutoApprove, tenantCtx.IDPClient, tenantCtx.FQTN, c.TenantURL, c.ClientID, c.ClientSecret, c.ManifestPath, c.TFProviderVersionConstraint, c.TFProviderDevDirPath))
+	if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+		return ucerr.Wrap(err)
+	}
+	opts.TenantURL = tenantCtx.TenantURL
+	opts.ClientID = tenantCtx.ClientID
+	opts.ClientSecret = tenantCtx.ClientSecret
+	return ucerr.Wrap(cmd.Apply(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, opts))
+}
+
+type rollbackCmd struct {
+	tenantConfig
+	SnapshotPath                string `arg:"" name:"snapshot" help:"Path to a snapshot directory saved by apply --backup-dir" type:"path"`
+	DryRun                      bool   `help:"Don't actually roll back, just print what would be done."`
+	AutoApprove                 bool   `help:"Don't prompt for confirmation before rolling back."`
+	TFProviderVersionConstraint string `help:"Version constraint that should be used for the terraform-provider-userclouds provider instantiation, e.g. \"~> 1.0\" or \"= 1.2.3\""`
+	TFProviderDevDirPath        string `help:"Path to the directory containing the terraform-provider-userclouds binary for local provider development"`
+	Engine                      string `enum:"terraform,native" default:"terraform" help:"How to apply changes. \"native\" calls the UserClouds API directly instead of running Terraform."`
+	BackupDir                   string `env:"UCCONFIG_BACKUP_DIR" help:"Before rolling back, save a snapshot of the tenant's current live resources to a timestamped directory under this directory." type:"path"`
+	WorkDir                     string `env:"UCCONFIG_WORKDIR" help:"Directory to generate Terraform files in, which is reused across runs to keep the provider cache and Terraform state." type:"path"`
+	BackendConfig               string `env:"UCCONFIG_BACKEND_CONFIG" help:"Path to a file containing a Terraform backend block (e.g. backend \"s3\" { ... }) to keep the Terraform state in." type:"path"`
+}
+
+// Run implements the rollback subcommand
+func (c *rollbackCmd) Run(ctx *cliContext) error {
+	tenantCtx := c.initTenantContext(ctx.Context)
+	return ucerr.Wrap(cmd.Rollback(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, c.SnapshotPath, cmd.ApplyOptions{
+		DryRun:                      c.DryRun,
+		AutoApprove:                 c.AutoApprove,
+		TenantURL:                   tenantCtx.TenantURL,
+		ClientID:                    tenantCtx.ClientID,
+		ClientSecret:                tenantCtx.ClientSecret,
+		TFProviderVersionConstraint: c.TFProviderVersionConstraint,
+		TFProviderDevDirPath:        c.TFProviderDevDirPath,
+		OutputFormat:                cmd.OutputFormatText,
+		Engine:                      c.Engine,
+		BackupDir:                   c.BackupDir,
+		WorkDir:                     c.WorkDir,
+		BackendConfigPath:           c.BackendConfig,
+	}))
+}
+
+type planCmd struct {
+	tenantConfig
+	ManifestPath string `arg:"" name:"manifest-path" help:"Path to UC manifest file (JSON or YAML)" type:"path"`
+	Output       string `enum:"text,json" default:"text" help:"Output format for the plan (text or json)."`
+}
+
+// Run implements the plan subcommand
+func (c *planCmd) Run(ctx *cliContext) error {
+	tenantCtx := c.initTenantContext(ctx.Context)
+	if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+		return ucerr.Wrap(err)
+	}
+	return ucerr.Wrap(cmd.Plan(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, c.ManifestPath, c.Output))
+}
+
+type driftCmd struct {
+	tenantConfig
+	ManifestPath string `arg:"" name:"manifest-path" help:"Path to UC manifest file (JSON or YAML)" type:"path"`
+	Output       string `enum:"text,json" default:"text" help:"Output format for the drift report (text or json)."`
+}
+
+// Run implements the drift subcommand
+func (c *driftCmd) Run(ctx *cliContext) error {
+	tenantCtx := c.initTenantContext(ctx.Context)
+	if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+		return ucerr.Wrap(err)
+	}
+	return ucerr.Wrap(cmd.Drift(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, c.ManifestPath, c.Output))
+}
+
+type promoteCmd struct {
+	From             string `required:"" env:"USERCLOUDS_FROM_TENANT" help:"Tenant to promote configuration from: either a profile name or a tenant URL."`
+	FromClientID     string `env:"USERCLOUDS_FROM_CLIENT_ID" help:"Client ID for the tenant to promote from, if --from is a URL."`
+	FromClientSecret string `env:"USERCLOUDS_FROM_CLIENT_SECRET" help:"Client secret for the tenant to promote from, if --from is a URL."`
+	To               string `required:"" env:"USERCLOUDS_TO_TENANT" help:"Tenant to promote configuration to: either a profile name or a tenant URL."`
+	ToClientID       string `env:"USERCLOUDS_TO_CLIENT_ID" help:"Client ID for the tenant to promote to, if --to is a URL."`
+	ToClientSecret   string `env:"USERCLOUDS_TO_CLIENT_SECRET" help:"Client secret for the tenant to promote to, if --to is a URL."`
+	ProfilesFile     string `env:"UCCONFIG_PROFILES_FILE" help:"Path to the profiles file. Defaults to $XDG_CONFIG_HOME/ucconfig/profiles.yaml or ~/.config/ucconfig/profiles.yaml." type:"path"`
+	ManifestPath     string `arg:"" name:"manifest-path" help:"Path to UC manifest file (JSON or YAML)" type:"path"`
+	Output           string `enum:"text,json" default:"text" help:"Output format for the plan against the target tenant (text or json)."`
+}
+
+// Run implements the promote subcommand
+func (c *promoteCmd) Run(ctx *cliContext) error {
+	from := tenantConfigFor(c.From, c.ProfilesFile, c.FromClientID, c.FromClientSecret).initTenantContext(ctx.Context)
+	to := tenantConfigFor(c.To, c.ProfilesFile, c.ToClientID, c.ToClientSecret).initTenantContext(ctx.Context)
+	for _, tenantCtx := range []tenantContext{from, to} {
+		if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+			return ucerr.Wrap(err)
+		}
+	}
+	return ucerr.Wrap(cmd.Promote(ctx.Context, from.IDPClient, from.FQTN, to.IDPClient, to.FQTN, c.ManifestPath, c.Output))
 }
 
 type genManifestCmd struct {
 	tenantConfig
-	ManifestPath string `arg:"" name:"manifest-path" help:"Path to UC JSON manifest file" type:"path"`
+	ManifestPath string `arg:"" name:"manifest-path" help:"Path to write the UC manifest file to. Its extension (.json or .yaml) selects the format." type:"path"`
+	Output       string `enum:"text,json" default:"text" help:"Output format. \"json\" prints a machine-readable report of the generated resources to stdout."`
+	SplitBy      string `enum:"none,type" default:"none" help:"How to split the manifest across files. \"type\" writes one file per resource type next to the manifest (e.g. columns.yaml, accessors.yaml), and a manifest that includes them."`
+	Merge        bool   `help:"Update the existing manifest at manifest-path instead of overwriting it, keeping its manifest IDs and the resource_uuids of other tenants."`
 }
 
 // Run implements the gen-manifest subcommand
 func (c *genManifestCmd) Run(ctx *cliContext) error {
+	if c.Merge && c.SplitBy != cmd.SplitByNone {
+		return ucerr.Friendlyf(nil, "--merge can't be combined with --split-by; merged resources are written back to the files they were loaded from")
+	}
+	tenantCtx := c.initTenantContext(ctx.Context)
+	if c.Merge {
+		if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+			return ucerr.Wrap(err)
+		}
+		return ucerr.Wrap(cmd.MergeManifest(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, c.ManifestPath, c.Output))
+	}
+	return ucerr.Wrap(cmd.GenerateNewManifest(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, c.ManifestPath, c.SplitBy, c.Output))
+}
+
+type ejectCmd struct {
+	tenantConfig
+	ManifestPath                string `arg:"" name:"manifest-path" help:"Path to UC manifest file (JSON or YAML)" type:"path"`
+	OutDir                      string `arg:"" name:"out-dir" help:"Directory to write the Terraform module to. It must not exist yet, or be empty." type:"path"`
+	TFProviderVersionConstraint string `help:"Version constraint that should be used for the terraform-provider-userclouds provider instantiation, e.g. \"~> 1.0\" or \"= 1.2.3\""`
+}
+
+// Run implements the eject subcommand
+func (c *ejectCmd) Run(ctx *cliContext) error {
 	tenantCtx := c.initTenantContext(ctx.Context)
-	return ucerr.Wrap(cmd.GenerateNewManifest(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, c.ManifestPath))
+	if err := tenantCtx.checkFQTN(ctx.Context, c.ManifestPath); err != nil {
+		return ucerr.Wrap(err)
+	}
+	return ucerr.Wrap(cmd.Eject(ctx.Context, tenantCtx.IDPClient, tenantCtx.FQTN, tenantCtx.TenantURL, c.ManifestPath, c.OutDir, c.TFProviderVersionConstraint))
+}
+
+type validateCmd struct {
+	ManifestPath string `arg:"" name:"manifest-path" help:"Path to UC manifest file (JSON or YAML)" type:"path"`
+	FQTN         string `name:"fqtn" help:"If set, also check that every resource has a UUID for this fully-qualified tenant name (or a __DEFAULT UUID)."`
+}
+
+// Run implements the validate subcommand
+func (c *validateCmd) Run(ctx *cliContext) error {
+	return ucerr.Wrap(cmd.Validate(ctx.Context, c.ManifestPath, c.FQTN))
 }
 
 var cli struct {
-	LogFile     string         `name:"logfile" help:"Path to the log file." type:"path"`
-	Apply       applyCmd       `cmd:"" help:"Apply a config manifest file, modifying the live tenant to match what the manifest describes."`
-	GenManifest genManifestCmd `cmd:"" help:"Generate a JSON manifest file from a live tenant."`
+	LogFile        string         `name:"logfile" help:"Path to the log file." type:"path"`
+	Concurrency    int            `default:"8" env:"UCCONFIG_CONCURRENCY" help:"Maximum number of concurrent UserClouds API calls when fetching live resources."`
+	MaxRetries     int            `default:"3" env:"UCCONFIG_MAX_RETRIES" help:"Number of times to retry UserClouds API calls that fail with a rate limit, server error, or network error. Only reads are retried after server and network errors."`
+	RequestTimeout time.Duration  `default:"60s" env:"UCCONFIG_REQUEST_TIMEOUT" help:"Timeout for each attempt at a UserClouds API call, e.g. 30s. 0 means no timeout."`
+	Apply          applyCmd       `cmd:"" help:"Apply a config manifest file, modifying the live tenant to match what the manifest describes."`
+	Plan           planCmd        `cmd:"" help:"Show the changes that applying a config manifest file would make to the live tenant."`
+	Drift          driftCmd       `cmd:"" help:"Report live resources that differ from a config manifest file. Exits with status 2 if there are any."`
+	Rollback       rollbackCmd    `cmd:"" help:"Restore a tenant to a snapshot saved by apply --backup-dir."`
+	GenManifest    genManifestCmd `cmd:"" help:"Generate a manifest file (JSON or YAML, depending on its extension) from a live tenant."`
+	Promote        promoteCmd     `cmd:"" help:"Merge the resources of one tenant into a config manifest file, and show the changes that applying it to another tenant would make."`
+	Eject          ejectCmd       `cmd:"" help:"Write a standalone Terraform module for the resources in a config manifest file, to manage them with Terraform directly instead of with ucconfig."`
+	Validate       validateCmd    `cmd:"" help:"Check a config manifest file for problems, without connecting to a tenant."`
 }
 
 func main() {
@@ -92,6 +404,13 @@ func main() {
 	}
 	logtransports.InitLoggerAndTransportsForTools(ctx, uclog.LogLevelInfo, uclog.LogLevelVerbose, "ucconfig", opts...)
 	defer logtransports.Close()
+	ctx = resourcetypes.WithConcurrency(ctx, cli.Concurrency)
 	err := cliCtx.Run(&cliContext{Context: ctx})
+	if errors.Is(err, cmd.ErrDriftDetected) {
+		// Exit with a distinct status so that CI jobs can tell drift apart
+		// from failures
+		logtransports.Close()
+		os.Exit(2)
+	}
 	cliCtx.FatalIfErrorf(err)
 }